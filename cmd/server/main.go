@@ -5,18 +5,28 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"orchids-api/internal/api"
+	"orchids-api/internal/audit"
+	"orchids-api/internal/builtintools"
+	"orchids-api/internal/client"
 	"orchids-api/internal/config"
 	"orchids-api/internal/debug"
 	"orchids-api/internal/handler"
+	"orchids-api/internal/handler/metrics"
 	"orchids-api/internal/keeper"
 	"orchids-api/internal/loadbalancer"
 	"orchids-api/internal/logger"
 	"orchids-api/internal/middleware"
+	"orchids-api/internal/modelroute"
+	"orchids-api/internal/respcache"
 	"orchids-api/internal/store"
+	"orchids-api/internal/tenant"
+	"orchids-api/internal/tools"
 	"orchids-api/web"
 )
 
@@ -64,43 +74,164 @@ func main() {
 	}
 	defer s.Close()
 
+	// 首次启动时从配置种子默认超级管理员
+	if err := s.BootstrapSuperadmin(cfg.AdminUser, cfg.AdminPass); err != nil {
+		log.Printf("Failed to bootstrap superadmin: %v", err)
+	}
+
 	lb := loadbalancer.New(s)
 	defer lb.Close() // 确保程序退出时关闭负载均衡器，刷新待更新的计数
 
+	// Token 缓存后端：TOKENCACHE_BACKEND=etcd 时多副本部署共享同一份 JWT 缓存和刷新协调锁，
+	// 不设置时默认退化为进程内缓存，单实例部署行为不变
+	client.InitGlobalCacheFromEnv()
+
 	// 启动账号保活服务
 	accountKeeper := keeper.New(s)
+	if statusStore := client.StatusStoreFromEnv("/orchids/keeper/"); statusStore != nil {
+		accountKeeper.SetStatusStore(statusStore)
+	}
 	accountKeeper.Start()
 	defer accountKeeper.Stop()
 
-	// 创建请求日志收集器
+	// 创建请求日志收集器，并装载滚动 JSONL 持久化后端
 	requestLogger := logger.New()
+	logStore, err := logger.NewFileStore(filepath.Join(dataDir, "logs"))
+	if err != nil {
+		log.Printf("Failed to initialize log store: %v", err)
+	} else {
+		requestLogger.SetStore(logStore)
+		defer logStore.Close()
+	}
+
+	if lokiForwarder := logger.NewLokiForwarder(logger.LokiConfig{
+		Enabled:       cfg.LokiEnabled,
+		URL:           cfg.LokiURL,
+		ServiceLabel:  cfg.LokiServiceLabel,
+		BatchSize:     cfg.LokiBatchSize,
+		FlushInterval: cfg.LokiFlushInterval,
+	}); lokiForwarder != nil {
+		requestLogger.SetLokiForwarder(lokiForwarder)
+		defer lokiForwarder.Close()
+	}
+
+	if otelExporter := logger.NewOTelExporter(logger.OTelConfig{
+		Enabled:       cfg.OTelEnabled,
+		Endpoint:      cfg.OTelEndpoint,
+		ServiceName:   cfg.OTelServiceName,
+		BatchSize:     cfg.OTelBatchSize,
+		FlushInterval: cfg.OTelFlushInterval,
+	}); otelExporter != nil {
+		requestLogger.SetOTelExporter(otelExporter)
+		defer otelExporter.Close()
+	}
+
 	log.Println("请求日志系统已初始化")
 
+	// 让账号保活刷新和 Token 缓存的 span 也能经由同一个 requestLogger 导出（装了 OTel 的话）
+	accountKeeper.SetRequestLogger(requestLogger)
+	client.GetGlobalCache().SetRequestLogger(requestLogger)
+
 	apiHandler := api.NewWithKeeperAndLogger(s, accountKeeper, requestLogger)
+	apiHandler.SetSelector(lb.Selector())
+	apiHandler.SetConfig(cfg)
+	apiHandler.SetLoadBalancer(lb)
 	h := handler.NewWithAll(cfg, lb, accountKeeper, requestLogger)
+	h.SetStore(s)
+	// 审计账单：默认落滚动 JSONL 文件，记录每次请求的 token 用量、账号、耗时等，供运营方
+	// 做用量/计费分析；需要 SQLite 或者推到 Kafka/NSQ 的话替换成 audit.NewSQLiteSink/
+	// audit.NewNetworkSink 即可，Handler 侧不需要改动
+	if auditSink, err := audit.NewJSONLSink(filepath.Join(dataDir, "audit")); err != nil {
+		log.Printf("Failed to initialize audit sink: %v", err)
+	} else {
+		h.SetAuditSink(auditSink)
+		defer auditSink.Close()
+	}
+	// 本地工具注册表：内置 may_http_get/may_weather/may_search/may_read_url 这几个工具，
+	// 客户端带 X-Orchids-Local-Tools 请求头时才会真正在本地执行 may_ 前缀的 tool_use
+	toolRegistry := tools.NewRegistry()
+	builtintools.Register(toolRegistry)
+	h.SetToolRegistry(toolRegistry)
+	// 非流式响应缓存：RESPCACHE_REDIS_ADDR 未配置时退化为纯本地 LRU，不需要额外部署 Redis
+	// 也能拿到同进程内的缓存收益
+	h.SetResponseCache(respcache.NewFromEnv())
+
+	// 模型路由表：MODEL_ROUTE_MAP 按模型名覆盖 provider 选择和上游 API 版本，收到
+	// SIGHUP 时重新读一遍环境变量热更新，不用重启进程就能切换某个模型的路由
+	modelRoutes := modelroute.Load()
+	h.SetModelRoutes(modelRoutes)
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			log.Println("收到 SIGHUP，重新加载模型路由表")
+			modelRoutes.Reload()
+		}
+	}()
+
+	// 按租户限流：RPM 检查走请求计数，TPM 检查用 Content-Length 粗略估算（避免提前读取请求体）
+	tenantLimiter := tenant.NewLimiter()
+	defer tenantLimiter.Stop()
+	estimateRequestTokens := func(r *http.Request) int {
+		if r.ContentLength <= 0 {
+			return 0
+		}
+		return int(r.ContentLength / 4)
+	}
+	withTenant := func(next http.HandlerFunc) http.HandlerFunc {
+		return tenant.Middleware(s, tenantLimiter, estimateRequestTokens, next)
+	}
 
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/v1/messages", h.HandleMessages)
+	mux.HandleFunc("/v1/messages", withTenant(h.HandleMessages))
+	// 走 mTLS 管理面监听器的无人值守 agent 通道：PKI 签发的客户端证书映射到
+	// accounts.cert_fingerprint，不需要租户 API Key 也不需要共享管理员密码
+	mux.HandleFunc("/v1/agent/messages", middleware.ClientCertAuth(s, http.HandlerFunc(h.HandleMessages)))
 	mux.HandleFunc("/v1/models", h.HandleModels)
-	mux.HandleFunc("/v1/chat/completions", h.HandleChatCompletions)
-	mux.HandleFunc("/chat-stream", h.HandleChatCompletions)
-
-	mux.HandleFunc("/api/accounts", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleAccounts))
-	mux.HandleFunc("/api/accounts/", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleAccountByID))
-	mux.HandleFunc("/api/accounts/health", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleAccountsHealth))
-	mux.HandleFunc("/api/refresh-all", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleRefreshAll))
-	mux.HandleFunc("/api/check-all", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleCheckAll))
-	mux.HandleFunc("/api/batch-delete", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleBatchDelete))
-	mux.HandleFunc("/api/export", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleExport))
-	mux.HandleFunc("/api/import", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleImport))
+	mux.HandleFunc("/v1/chat/completions", withTenant(h.HandleChatCompletions))
+	mux.HandleFunc("/chat-stream", withTenant(h.HandleChatCompletions))
+	mux.HandleFunc("/v1/orchids/tools/invoke", withTenant(h.HandleToolsInvoke))
+
+	mux.HandleFunc("/api/accounts", middleware.RequireAuth(cfg, apiHandler.HandleAccounts))
+	mux.HandleFunc("/api/accounts/", middleware.RequireAuth(cfg, apiHandler.HandleAccountByID))
+	mux.HandleFunc("/api/accounts/health", middleware.RequireAuth(cfg, apiHandler.HandleAccountsHealth))
+	mux.HandleFunc("/api/accounts/oauth/start", middleware.RequireAuth(cfg, apiHandler.HandleAccountOAuthStart))
+	mux.HandleFunc("/api/accounts/oauth/callback", middleware.RequireAuth(cfg, apiHandler.HandleAccountOAuthCallback))
+	// 这几条路由过 RBAC 权限点检查：按 admin 记录分配的角色授权，未迁移到 RBAC 的部署
+	// 仍可用共享的 cfg.AdminUser/AdminPass 或 mTLS 证书登录，RequirePermission 会放行
+	mux.HandleFunc("/api/refresh-all", middleware.RequirePermission(cfg, s, "accounts.write", apiHandler.HandleRefreshAll))
+	mux.HandleFunc("/api/check-all", middleware.RequirePermission(cfg, s, "accounts.write", apiHandler.HandleCheckAll))
+	mux.HandleFunc("/api/jobs/", middleware.RequirePermission(cfg, s, "accounts.write", apiHandler.HandleJobByID))
+	mux.HandleFunc("/api/batch-delete", middleware.RequirePermission(cfg, s, "accounts.write", apiHandler.HandleBatchDelete))
+	mux.HandleFunc("/api/export", middleware.RequirePermission(cfg, s, "accounts.write", apiHandler.HandleExport))
+	mux.HandleFunc("/api/import", middleware.RequirePermission(cfg, s, "accounts.write", apiHandler.HandleImport))
+	mux.HandleFunc("/api/pki/enroll", middleware.RequirePermission(cfg, s, "accounts.write", apiHandler.HandlePKIEnroll))
+
+	// RequirePermission 每次请求都读 cfg.IsAuthenticated，不像 BasicAuth 那样在注册时
+	// 拷贝一份凭据快照，PUT /api/config 改密码对它而言立即生效，不需要重启进程
+	mux.HandleFunc("/api/config", middleware.RequirePermission(cfg, s, "settings.admin", apiHandler.HandleConfig))
+
+	mux.HandleFunc("/api/tenants", middleware.RequirePermission(cfg, s, "settings.admin", apiHandler.HandleTenants))
+	mux.HandleFunc("/api/tenants/", middleware.RequirePermission(cfg, s, "settings.admin", apiHandler.HandleTenantByID))
+
+	// OIDC/OAuth2 管理员登录（可配置为 Clerk 或任意标准 OIDC provider），以及按用户名密码
+	// 登录 RBAC 管理员记录；两者都落到同一套 admin_session
+	mux.HandleFunc("/api/auth/oidc/login", apiHandler.HandleOIDCLogin)
+	mux.HandleFunc("/api/auth/oidc/callback", apiHandler.HandleOIDCCallback)
+	mux.HandleFunc("/api/auth/login", apiHandler.HandleAdminLogin)
 
 	// 日志相关 API
-	mux.HandleFunc("/api/logs", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleLogs))
-	mux.HandleFunc("/api/logs/stream", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleLogsSSE))
-	mux.HandleFunc("/api/logs/stats", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleLogsStats))
+	mux.HandleFunc("/api/logs", middleware.RequireAuth(cfg, apiHandler.HandleLogs))
+	mux.HandleFunc("/api/logs/stream", middleware.RequireAuth(cfg, apiHandler.HandleLogsSSE))
+	mux.HandleFunc("/api/logs/stats", middleware.RequireAuth(cfg, apiHandler.HandleLogsStats))
+	mux.HandleFunc("/api/counters/queue", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleCounterQueue))
+	mux.HandleFunc("/api/selector/status", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleSelectorStatus))
+	mux.HandleFunc("/debug/lb/bloom", middleware.BasicAuth(cfg.AdminUser, cfg.AdminPass, apiHandler.HandleLBBloomStatus))
+
+	mux.HandleFunc(cfg.AdminPath+"/", middleware.RequireAuthHandler(cfg, http.StripPrefix(cfg.AdminPath, web.StaticHandler())))
 
-	mux.HandleFunc(cfg.AdminPath+"/", middleware.BasicAuthHandler(cfg.AdminUser, cfg.AdminPass, http.StripPrefix(cfg.AdminPath, web.StaticHandler())))
+	mux.Handle("/metrics", metrics.Handler())
 
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -116,6 +247,24 @@ func main() {
 		w.Write([]byte(`{"service":"orchids-api","status":"running"}`))
 	})
 
+	// 管理面可选的 mTLS 监听器：证书未配置时 GetTLSConfig 返回 (nil, nil)，公共 API 始终只走
+	// 下面的明文 HTTP 监听器，不受这里影响
+	if tlsConfig, err := cfg.GetTLSConfig(); err != nil {
+		log.Printf("Failed to build admin TLS config: %v", err)
+	} else if tlsConfig != nil {
+		adminTLSServer := &http.Server{
+			Addr:      ":" + cfg.TLS.ListenPort,
+			Handler:   mux,
+			TLSConfig: tlsConfig,
+		}
+		go func() {
+			log.Printf("Admin mTLS listener on port %s (auth_type=%s)", cfg.TLS.ListenPort, cfg.TLS.AuthType)
+			if err := adminTLSServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				log.Printf("Admin TLS listener stopped: %v", err)
+			}
+		}()
+	}
+
 	log.Printf("Server running on port %s", cfg.Port)
 	log.Printf("Admin UI: %s", cfg.AdminPath)
 	if err := http.ListenAndServe(":"+cfg.Port, mux); err != nil {
@@ -2,25 +2,63 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"orchids-api/internal/clerk"
 	"orchids-api/internal/client"
+	"orchids-api/internal/config"
+	"orchids-api/internal/job"
 	"orchids-api/internal/keeper"
+	"orchids-api/internal/loadbalancer"
 	"orchids-api/internal/logger"
+	"orchids-api/internal/middleware"
+	"orchids-api/internal/pki"
+	"orchids-api/internal/selector"
 	"orchids-api/internal/store"
 )
 
 type API struct {
-	store  *store.Store
-	keeper *keeper.AccountKeeper
-	logger *logger.RequestLogger
+	store    *store.Store
+	keeper   *keeper.AccountKeeper
+	logger   *logger.RequestLogger
+	ca       *pki.CA
+	selector *selector.Selector
+	cfg      *config.Config
+	jobs     *job.Manager
+	lb       *loadbalancer.LoadBalancer
+}
+
+// SetSelector 装载账号选择器，启用 /api/selector/status
+func (a *API) SetSelector(sel *selector.Selector) {
+	a.selector = sel
+}
+
+// SetConfig 装载运行时配置，启用 /api/config
+func (a *API) SetConfig(cfg *config.Config) {
+	a.cfg = cfg
+}
+
+// SetCA 装载签发客户端证书所需的内部 CA，启用 /api/pki/enroll
+func (a *API) SetCA(ca *pki.CA) {
+	a.ca = ca
+}
+
+// SetLoadBalancer 装载负载均衡器，启用 /debug/lb/bloom
+func (a *API) SetLoadBalancer(lb *loadbalancer.LoadBalancer) {
+	a.lb = lb
 }
 
 type ExportData struct {
@@ -36,15 +74,15 @@ type ImportResult struct {
 }
 
 func New(s *store.Store) *API {
-	return &API{store: s}
+	return &API{store: s, jobs: job.NewManager()}
 }
 
 func NewWithKeeper(s *store.Store, k *keeper.AccountKeeper) *API {
-	return &API{store: s, keeper: k}
+	return &API{store: s, keeper: k, jobs: job.NewManager()}
 }
 
 func NewWithKeeperAndLogger(s *store.Store, k *keeper.AccountKeeper, l *logger.RequestLogger) *API {
-	return &API{store: s, keeper: k, logger: l}
+	return &API{store: s, keeper: k, logger: l, jobs: job.NewManager()}
 }
 
 func (a *API) GetLogger() *logger.RequestLogger {
@@ -103,32 +141,33 @@ func (a *API) HandleAccounts(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// HandleAccountByID 把 "/api/accounts/{id}" 及其子路由 (refresh/test/check) 统一解析成
+// id + subRoute 后分发；裸的 {id} 路由走 CRUD，其余子路由各自只需要一个 Context
 func (a *API) HandleAccountByID(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	path := strings.TrimPrefix(r.URL.Path, "/api/accounts/")
-	if strings.HasSuffix(path, "/refresh") {
-		a.handleRefreshAccount(w, r)
-		return
-	}
-
-	if strings.HasSuffix(path, "/test") {
-		a.handleTestAccount(w, r)
-		return
-	}
-
-	if strings.HasSuffix(path, "/check") {
-		a.handleCheckAccount(w, r)
+	id, subRoute, ok := parseAccountPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
 		return
 	}
 
-	idStr := path
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
-		return
+	switch subRoute {
+	case "refresh":
+		a.dispatchAccountRoute(id, http.MethodPost, w, r, a.handleRefreshAccount)
+	case "test":
+		a.dispatchAccountRoute(id, http.MethodPost, w, r, a.handleTestAccount)
+	case "check":
+		a.dispatchAccountRoute(id, http.MethodPost, w, r, a.handleCheckAccount)
+	case "":
+		a.handleAccountCRUD(id, w, r)
+	default:
+		http.NotFound(w, r)
 	}
+}
 
+// handleAccountCRUD 实现裸的 "/api/accounts/{id}" 路由 (GET/PUT/DELETE)
+func (a *API) handleAccountCRUD(id int64, w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		acc, err := a.store.GetAccount(id)
@@ -136,43 +175,69 @@ func (a *API) HandleAccountByID(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
-		json.NewEncoder(w).Encode(acc)
+		json.NewEncoder(w).Encode(struct {
+			*store.Account
+			Fingerprint string `json:"fingerprint"`
+		}{Account: acc, Fingerprint: acc.Fingerprint()})
 
 	case http.MethodPut:
-		existing, err := a.store.GetAccount(id)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
+		var req struct {
+			store.Account
+			Fingerprint string `json:"fingerprint"`
 		}
-
-		var acc store.Account
-		if err := json.NewDecoder(r.Body).Decode(&acc); err != nil {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		acc.ID = id
 
-		if acc.SessionID == "" {
-			acc.SessionID = existing.SessionID
-		}
-		if acc.ClientUat == "" {
-			acc.ClientUat = existing.ClientUat
+		fingerprint := r.Header.Get("If-Match")
+		if fingerprint == "" {
+			fingerprint = req.Fingerprint
 		}
-		if acc.ProjectID == "" {
-			acc.ProjectID = existing.ProjectID
-		}
-		if acc.UserID == "" {
-			acc.UserID = existing.UserID
+
+		err := a.store.DoLockedAction(id, fingerprint, func(existing *store.Account) error {
+			existing.Name = req.Name
+			existing.ClientCookie = req.ClientCookie
+			existing.AgentMode = req.AgentMode
+			existing.Weight = req.Weight
+			existing.Enabled = req.Enabled
+			existing.Tag = req.Tag
+			if req.SessionID != "" {
+				existing.SessionID = req.SessionID
+			}
+			if req.ClientUat != "" {
+				existing.ClientUat = req.ClientUat
+			}
+			if req.ProjectID != "" {
+				existing.ProjectID = req.ProjectID
+			}
+			if req.UserID != "" {
+				existing.UserID = req.UserID
+			}
+			if req.Email != "" {
+				existing.Email = req.Email
+			}
+			return nil
+		})
+
+		if err == store.ErrFingerprintMismatch {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
 		}
-		if acc.Email == "" {
-			acc.Email = existing.Email
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
-		if err := a.store.UpdateAccount(&acc); err != nil {
+		acc, err := a.store.GetAccount(id)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		json.NewEncoder(w).Encode(acc)
+		json.NewEncoder(w).Encode(struct {
+			*store.Account
+			Fingerprint string `json:"fingerprint"`
+		}{Account: acc, Fingerprint: acc.Fingerprint()})
 
 	case http.MethodDelete:
 		if err := a.store.DeleteAccount(id); err != nil {
@@ -186,61 +251,356 @@ func (a *API) HandleAccountByID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (a *API) HandleExport(w http.ResponseWriter, r *http.Request) {
+// certFingerprintFromPEM 计算 PEM 编码证书的 SHA-256 指纹，与 middleware.ClientCertAuth 保持一致
+func certFingerprintFromPEM(certPEM []byte) (string, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return "", fmt.Errorf("failed to decode certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// HandleCounterQueue 展示计数写behind聚合器的内省信息（队列深度）
+func (a *API) HandleCounterQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"queue_depth": a.store.CounterQueueDepth(),
+	})
+}
+
+// HandleSelectorStatus 展示加权健康选择器中每个账号的熔断状态
+func (a *API) HandleSelectorStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if a.selector == nil {
+		http.Error(w, "Selector not initialized", http.StatusInternalServerError)
+		return
+	}
 
-	accounts, err := a.store.ListAccounts()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"accounts": a.selector.StatusList(),
+	})
+}
+
+// HandleLBBloomStatus 展示失败账号去重 Bloom filter 的填充率/轮换状态，用于观察
+// 误判率是否因为账号规模超出 LB_BLOOM_N 预期而在实际运行中变差
+func (a *API) HandleLBBloomStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.lb == nil {
+		http.Error(w, "LoadBalancer not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.lb.BloomStats())
+}
+
+// HandleOIDCLogin 发起 OIDC 授权码流程，重定向到配置的 provider
+func (a *API) HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	cfg, err := middleware.LoadOIDCConfig(a.store)
+	if err != nil || cfg.ClientID == "" {
+		http.Error(w, "OIDC not configured", http.StatusInternalServerError)
+		return
+	}
+	middleware.StartOIDCLogin(cfg, w, r)
+}
+
+// HandleOIDCCallback 处理 provider 回调：换取 token，校验 ID token，并签发 admin_session
+func (a *API) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	cfg, err := middleware.LoadOIDCConfig(a.store)
+	if err != nil || cfg.ClientID == "" {
+		http.Error(w, "OIDC not configured", http.StatusInternalServerError)
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	state := r.URL.Query().Get("state")
+	if code == "" || state == "" {
+		http.Error(w, "missing code or state", http.StatusBadRequest)
+		return
+	}
+
+	admin, err := middleware.FinishOIDCLogin(a.store, cfg, code, state)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, "OIDC login failed: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := middleware.BindAdminSession(w, admin.ID); err != nil {
+		http.Error(w, "Failed to create session: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	exportData := ExportData{
-		Version:  1,
-		ExportAt: time.Now(),
-		Accounts: make([]store.Account, len(accounts)),
+	http.Redirect(w, r, "/admin/", http.StatusFound)
+}
+
+// HandleAdminLogin 按用户名密码登录 RBAC 管理员（store.Admin/bcrypt），成功后签发
+// admin_session cookie；和 HandleOIDCCallback 是同一套 session 机制的两个入口
+func (a *API) HandleAdminLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := middleware.LoginAdmin(a.store, w, req.Username, req.Password); err != nil {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+}
+
+// HandleAccountOAuthStart 发起账号接入的授权码流程：生成 state/nonce 落盘（而非仅存内存，
+// 以便 callback 落在任意一个实例上都能校验），返回身份提供方的 authorize URL 供管理后台跳转
+func (a *API) HandleAccountOAuthStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg, err := clerk.LoadOAuthConfig(a.store)
+	if err != nil || cfg.ClientID == "" {
+		http.Error(w, "account OAuth not configured", http.StatusInternalServerError)
+		return
+	}
+
+	state := randomOAuthToken(32)
+	nonce := randomOAuthToken(32)
+	if err := a.store.SaveAccountOAuthState(state, nonce); err != nil {
+		http.Error(w, "failed to persist oauth state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"authorize_url": clerk.BuildAuthorizeURL(*cfg, state, nonce),
+	})
+}
+
+// HandleAccountOAuthCallback 校验 state，用授权码换取 access token 和用户信息，
+// 并据此创建一个完整的 store.Account，替代此前手工粘贴 ClientCookie 的方式
+func (a *API) HandleAccountOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	state := r.URL.Query().Get("state")
+	if code == "" || state == "" {
+		http.Error(w, "missing code or state", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := a.store.ConsumeAccountOAuthState(state); err != nil {
+		http.Error(w, "invalid state: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	cfg, err := clerk.LoadOAuthConfig(a.store)
+	if err != nil || cfg.ClientID == "" {
+		http.Error(w, "account OAuth not configured", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := clerk.ExchangeCodeForToken(*cfg, code)
+	if err != nil {
+		log.Printf("Failed to exchange code for token: %v", err)
+		http.Error(w, "token exchange failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	info, err := clerk.FetchUserInfo(*cfg, tokens.AccessToken)
+	if err != nil {
+		log.Printf("Failed to fetch user info: %v", err)
+		http.Error(w, "failed to fetch user info: "+err.Error(), http.StatusBadGateway)
+		return
 	}
-	for i, acc := range accounts {
-		exportData.Accounts[i] = *acc
-		exportData.Accounts[i].ID = 0
-		exportData.Accounts[i].RequestCount = 0
+
+	acc := &store.Account{
+		Name:         info.Email,
+		SessionID:    info.SessionID,
+		ClientCookie: info.ClientCookie,
+		ClientUat:    info.ClientUat,
+		ProjectID:    info.ProjectID,
+		UserID:       info.UserID,
+		AgentMode:    "claude-opus-4.5",
+		Email:        info.Email,
+		Weight:       1,
+		Enabled:      true,
+		RefreshToken: tokens.RefreshToken,
 	}
 
+	if err := a.store.CreateAccount(acc); err != nil {
+		log.Printf("Failed to create account: %v", err)
+		http.Error(w, "failed to create account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(acc)
+}
+
+// randomOAuthToken 生成 OAuth state/nonce 用的随机 URL-safe token
+func randomOAuthToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// configResponse 把运行时可编辑的配置字段和它当前的 fingerprint 一起返回，
+// 客户端在后续 PUT 时把这个 fingerprint 带回来做乐观并发校验
+type configResponse struct {
+	config.RuntimeEditable
+	Fingerprint string `json:"fingerprint"`
+}
+
+// HandleConfig 支持在不重启进程的情况下读取/编辑 AdminUser/AdminPass/AdminPath/AgentMode；
+// PUT 要求 If-Match 请求头或 body 里的 fingerprint 字段（缺少时 428）和当前配置一致，否则 409，
+// 防止后台和其他并发编辑互相覆盖对方的修改
+func (a *API) HandleConfig(w http.ResponseWriter, r *http.Request) {
+	if a.cfg == nil {
+		http.Error(w, "Config not initialized", http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Disposition", "attachment; filename=accounts_export.json")
-	json.NewEncoder(w).Encode(exportData)
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(configResponse{
+			RuntimeEditable: a.cfg.Snapshot(),
+			Fingerprint:     a.cfg.Fingerprint(),
+		})
+
+	case http.MethodPut:
+		var req struct {
+			config.RuntimeEditable
+			Fingerprint string `json:"fingerprint"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		fingerprint := r.Header.Get("If-Match")
+		if fingerprint == "" {
+			fingerprint = req.Fingerprint
+		}
+		if fingerprint == "" {
+			http.Error(w, "If-Match header or fingerprint field required", http.StatusPreconditionRequired)
+			return
+		}
+
+		err := a.cfg.DoLockedAction(fingerprint, func(cfg *config.Config) error {
+			if req.AdminUser != "" {
+				cfg.AdminUser = req.AdminUser
+			}
+			if req.AdminPass != "" {
+				cfg.AdminPass = req.AdminPass
+			}
+			if req.AdminPath != "" {
+				cfg.AdminPath = req.AdminPath
+			}
+			if req.AgentMode != "" {
+				cfg.AgentMode = req.AgentMode
+			}
+			return nil
+		})
+
+		if err == config.ErrFingerprintMismatch {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(configResponse{
+			RuntimeEditable: a.cfg.Snapshot(),
+			Fingerprint:     a.cfg.Fingerprint(),
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
 }
 
-func (a *API) HandleImport(w http.ResponseWriter, r *http.Request) {
+// HandlePKIEnroll 为无头 agent/bouncer 签发短期客户端证书（需先通过 BasicAuth bootstrap 鉴权）
+func (a *API) HandlePKIEnroll(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var exportData ExportData
-	if err := json.NewDecoder(r.Body).Decode(&exportData); err != nil {
-		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+	if a.ca == nil {
+		http.Error(w, "PKI not configured", http.StatusInternalServerError)
 		return
 	}
 
-	result := ImportResult{Total: len(exportData.Accounts)}
+	var req struct {
+		AccountID int64  `json:"account_id"`
+		CN        string `json:"cn"`
+		TTLHours  int    `json:"ttl_hours,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.CN == "" {
+		http.Error(w, "cn is required", http.StatusBadRequest)
+		return
+	}
 
-	for _, acc := range exportData.Accounts {
-		acc.ID = 0
-		acc.RequestCount = 0
-		if err := a.store.CreateAccount(&acc); err != nil {
-			log.Printf("Failed to import account %s: %v", acc.Name, err)
-			result.Skipped++
-		} else {
-			result.Imported++
+	ttl := time.Duration(req.TTLHours) * time.Hour
+	result, err := a.ca.Issue(req.CN, ttl)
+	if err != nil {
+		http.Error(w, "Failed to issue certificate: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.AccountID != 0 {
+		fingerprint, err := certFingerprintFromPEM(result.CertPEM)
+		if err == nil {
+			a.store.SetAccountCertFingerprint(req.AccountID, fingerprint)
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"cert":    string(result.CertPEM),
+		"key":     string(result.KeyPEM),
+		"expires": result.Expires,
+	})
 }
 
 // HandleAccountsHealth 账号健康检查 API
@@ -264,34 +624,39 @@ func (a *API) HandleAccountsHealth(w http.ResponseWriter, r *http.Request) {
 	statuses := a.keeper.GetStatus()
 	healthy, total := a.keeper.GetHealthyCount()
 
+	// 把选择器维护的延迟/成功率 EWMA 和熔断状态叠加到每个账号的保活状态上，
+	// 方便一个接口就能看出某个账号为什么被调度器回避
+	type accountHealth struct {
+		keeper.AccountStatus
+		Selector *selector.Status `json:"selector,omitempty"`
+	}
+
+	combined := make([]accountHealth, 0, len(statuses))
+	for _, s := range statuses {
+		ah := accountHealth{AccountStatus: s}
+		if a.selector != nil {
+			if sel, ok := a.selector.StatusFor(s.AccountID); ok {
+				ah.Selector = &sel
+			}
+		}
+		combined = append(combined, ah)
+	}
+
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"healthy":  healthy,
 		"total":    total,
-		"accounts": statuses,
+		"accounts": combined,
 	})
 }
 
 // handleRefreshAccount 手动刷新单个账号
-func (a *API) handleRefreshAccount(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	path := strings.TrimPrefix(r.URL.Path, "/api/accounts/")
-	idStr := strings.TrimSuffix(path, "/refresh")
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
-		return
-	}
-
+func (a *API) handleRefreshAccount(c *Context, w http.ResponseWriter, r *http.Request) {
 	if a.keeper == nil {
 		http.Error(w, "Keeper not initialized", http.StatusInternalServerError)
 		return
 	}
 
-	if err := a.keeper.RefreshAccountByID(id); err != nil {
+	if err := a.keeper.RefreshAccountByID(c.Account.ID); err != nil {
 		http.Error(w, "Refresh failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -304,27 +669,8 @@ func (a *API) handleRefreshAccount(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleTestAccount 测试单个账号是否可用（发送 hi 请求）
-func (a *API) handleTestAccount(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	path := strings.TrimPrefix(r.URL.Path, "/api/accounts/")
-	idStr := strings.TrimSuffix(path, "/test")
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
-		return
-	}
-
-	// 获取账号
-	acc, err := a.store.GetAccount(id)
-	if err != nil {
-		http.Error(w, "Account not found: "+err.Error(), http.StatusNotFound)
-		return
-	}
-
+func (a *API) handleTestAccount(c *Context, w http.ResponseWriter, r *http.Request) {
+	acc := c.Account
 	startTime := time.Now()
 	log.Printf("[TestAccount] 开始测试账号 %s (%s)", acc.Name, acc.Email)
 
@@ -344,7 +690,7 @@ func (a *API) handleTestAccount(w http.ResponseWriter, r *http.Request) {
 
 	var responseText strings.Builder
 
-	err = apiClient.SendRequest(ctx, "hi", []interface{}{}, "claude-sonnet-4-5", func(msg client.SSEMessage) {
+	err := apiClient.SendRequest(ctx, "hi", []interface{}{}, "claude-sonnet-4-5", func(msg client.SSEMessage) {
 		if msg.Type == "model" && msg.Event != nil {
 			if evtType, ok := msg.Event["type"].(string); ok {
 				if evtType == "text-delta" {
@@ -367,7 +713,7 @@ func (a *API) handleTestAccount(w http.ResponseWriter, r *http.Request) {
 		// 记录到日志系统
 		if a.logger != nil {
 			a.logger.LogRequest(fmt.Sprintf("test-%d", acc.ID), acc.ID, acc.Name,
-				fmt.Sprintf("激活测试失败: %v", err), duration, false)
+				fmt.Sprintf("激活测试失败: %v", err), duration, false, 0)
 		}
 	} else {
 		testResult.Success = true
@@ -384,7 +730,7 @@ func (a *API) handleTestAccount(w http.ResponseWriter, r *http.Request) {
 		// 记录到日志系统
 		if a.logger != nil {
 			a.logger.LogRequest(fmt.Sprintf("test-%d", acc.ID), acc.ID, acc.Name,
-				fmt.Sprintf("激活测试成功, 响应: %s", responseText.String()), duration, true)
+				fmt.Sprintf("激活测试成功, 响应: %s", responseText.String()), duration, true, 0)
 		}
 	}
 
@@ -392,26 +738,8 @@ func (a *API) handleTestAccount(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(testResult)
 }
 
-func (a *API) handleCheckAccount(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	path := strings.TrimPrefix(r.URL.Path, "/api/accounts/")
-	idStr := strings.TrimSuffix(path, "/check")
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
-		return
-	}
-
-	acc, err := a.store.GetAccount(id)
-	if err != nil {
-		http.Error(w, "Account not found", http.StatusNotFound)
-		return
-	}
-
+func (a *API) handleCheckAccount(c *Context, w http.ResponseWriter, r *http.Request) {
+	acc := c.Account
 	result := clerk.CheckAccountStatus(acc.SessionID, acc.ClientCookie, acc.ClientUat)
 
 	if result.Banned && acc.Enabled {
@@ -429,77 +757,181 @@ func (a *API) handleCheckAccount(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// HandleRefreshAll 一键刷新所有账号
-func (a *API) HandleRefreshAll(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// batchJobRequest 是 HandleRefreshAll/HandleCheckAll 共用的请求体；concurrency/rate_per_sec
+// 留空或 <=0 时分别回退到 job 包的默认并发和不限速
+type batchJobRequest struct {
+	Concurrency int     `json:"concurrency"`
+	RatePerSec  float64 `json:"rate_per_sec"`
+}
+
+// startBatchJob 是 HandleRefreshAll/HandleCheckAll 共用的启动逻辑：读取账号列表、解析
+// {concurrency, rate_per_sec}、通过 job.Manager 调度，返回 job_id 供客户端轮询或订阅 SSE
+func (a *API) startBatchJob(w http.ResponseWriter, r *http.Request, kind job.Kind, worker job.Worker) {
+	var req batchJobRequest
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&req) // 请求体可选，解析失败就按默认值跑
 	}
 
-	if a.keeper == nil {
-		http.Error(w, "Keeper not initialized", http.StatusInternalServerError)
+	accounts, err := a.store.ListAccounts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	go func() {
-		a.keeper.RefreshAll()
-	}()
+	j := a.jobs.Start(kind, accounts, req.Concurrency, req.RatePerSec, worker)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Refresh started for all accounts",
+		"job_id": j.ID,
+		"total":  j.Total,
 	})
 }
 
-func (a *API) HandleCheckAll(w http.ResponseWriter, r *http.Request) {
+// HandleRefreshAll 一键刷新所有账号：按 {concurrency, rate_per_sec} 调度一个后台 job，
+// 进度通过 GET /api/jobs/{id} 轮询或 GET /api/jobs/{id}/events 的 SSE 流查看
+func (a *API) HandleRefreshAll(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	accounts, err := a.store.ListAccounts()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if a.keeper == nil {
+		http.Error(w, "Keeper not initialized", http.StatusInternalServerError)
 		return
 	}
 
-	type checkItem struct {
-		ID      int64  `json:"id"`
-		Name    string `json:"name"`
-		Valid   bool   `json:"valid"`
-		Banned  bool   `json:"banned"`
-		Message string `json:"message"`
-	}
+	a.startBatchJob(w, r, job.KindRefreshAll, func(acc *store.Account) job.Result {
+		if err := a.keeper.RefreshAccountByID(acc.ID); err != nil {
+			return job.Result{AccountID: acc.ID, Name: acc.Name, Success: false, Message: err.Error()}
+		}
+		return job.Result{AccountID: acc.ID, Name: acc.Name, Success: true, Message: "refreshed"}
+	})
+}
 
-	results := make([]checkItem, 0, len(accounts))
-	bannedCount := 0
+// HandleCheckAll 批量检测所有账号是否被封禁，替代原先的串行循环 + 固定 200ms sleep
+func (a *API) HandleCheckAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	for _, acc := range accounts {
+	a.startBatchJob(w, r, job.KindCheckAll, func(acc *store.Account) job.Result {
 		result := clerk.CheckAccountStatus(acc.SessionID, acc.ClientCookie, acc.ClientUat)
-		results = append(results, checkItem{
-			ID:      acc.ID,
-			Name:    acc.Name,
-			Valid:   result.Valid,
-			Banned:  result.Banned,
-			Message: result.Message,
-		})
 
 		if result.Banned && acc.Enabled {
 			acc.Enabled = false
 			a.store.UpdateAccount(acc)
-			bannedCount++
 		}
 
-		time.Sleep(200 * time.Millisecond)
+		return job.Result{
+			AccountID: acc.ID,
+			Name:      acc.Name,
+			Success:   result.Valid && !result.Banned,
+			Message:   result.Message,
+		}
+	})
+}
+
+// HandleJobByID 分发 "/api/jobs/{id}"（状态轮询）和 "/api/jobs/{id}/events"（SSE 进度流）
+func (a *API) HandleJobByID(w http.ResponseWriter, r *http.Request) {
+	id, subRoute, ok := parseJobPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	j, found := a.jobs.Get(id)
+	if !found {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	switch subRoute {
+	case "":
+		a.handleJobStatus(j, w, r)
+	case "events":
+		a.handleJobEvents(j, w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleJobStatus 返回任务当前的汇总进度和逐条结果，供不想建立 SSE 连接的客户端轮询
+func (a *API) handleJobStatus(j *job.Job, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"total":        len(results),
-		"banned_count": bannedCount,
-		"results":      results,
-	})
+
+	snap := j.Snapshot()
+	a.logJobSummary(j)
+	json.NewEncoder(w).Encode(snap)
+}
+
+// handleJobEvents 以 SSE 推送任务的逐条结果，复用 HandleLogsSSE 的 flusher 模式，让管理
+// 后台能渲染一个实时进度条
+func (a *API) handleJobEvents(j *job.Job, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	origin := r.Header.Get("Origin")
+	if origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	id, ch := j.Subscribe()
+	if ch == nil {
+		http.Error(w, "Too many listeners", http.StatusServiceUnavailable)
+		return
+	}
+	defer j.Unsubscribe(id)
+
+	snap := j.Snapshot()
+	connectedData, _ := json.Marshal(snap)
+	fmt.Fprintf(w, "event: connected\ndata: %s\n\n", connectedData)
+	flusher.Flush()
+
+	ctx := r.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case result, ok := <-ch:
+			if !ok {
+				finalData, _ := json.Marshal(j.Snapshot())
+				fmt.Fprintf(w, "event: done\ndata: %s\n\n", finalData)
+				flusher.Flush()
+				a.logJobSummary(j)
+				return
+			}
+			data, _ := json.Marshal(result)
+			fmt.Fprintf(w, "event: result\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
+// logJobSummary 把批量任务的最终汇总写进 RequestLogger，这样它也会出现在 HandleLogs 里；
+// MarkSummaryLogged 保证轮询和 SSE 的 done 事件无论谁先触发，汇总只会被记录一次
+func (a *API) logJobSummary(j *job.Job) {
+	if a.logger == nil || !j.MarkSummaryLogged() {
+		return
+	}
+
+	snap := j.Snapshot()
+	requestID := "job-summary-" + snap.ID
+	message := fmt.Sprintf("批量任务 %s 完成：total=%d success=%d fail=%d", snap.Kind, snap.Total, snap.SuccessCount, snap.FailCount)
+	a.logger.LogRequest(requestID, 0, "", message, snap.FinishedAt.Sub(snap.StartedAt).Milliseconds(), snap.FailCount == 0, 0)
 }
 
 // HandleBatchDelete 批量删除账号
@@ -553,15 +985,59 @@ func (a *API) HandleLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	q := r.URL.Query()
+
 	// 获取 limit 参数
 	limit := 100
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+	if limitStr := q.Get("limit"); limitStr != "" {
 		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
 			limit = l
 		}
 	}
 
-	logs := a.logger.GetLogs(limit)
+	// 没有额外筛选条件时，沿用原先只读内存环形缓冲区的快速路径
+	if !hasLogQueryFilters(q) {
+		logs := a.logger.GetLogs(limit)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"logs":  logs,
+			"total": len(logs),
+		})
+		return
+	}
+
+	filter := logger.QueryFilter{
+		Level:     q.Get("level"),
+		RequestID: q.Get("request_id"),
+		Contains:  q.Get("q"),
+		Limit:     limit,
+	}
+	if accountIDStr := q.Get("account_id"); accountIDStr != "" {
+		if id, err := strconv.ParseInt(accountIDStr, 10, 64); err == nil {
+			filter.AccountID = id
+		}
+	}
+	if tenantIDStr := q.Get("tenant_id"); tenantIDStr != "" {
+		if id, err := strconv.ParseInt(tenantIDStr, 10, 64); err == nil {
+			filter.TenantID = id
+		}
+	}
+	if sinceStr := q.Get("since"); sinceStr != "" {
+		if since, err := time.Parse(time.RFC3339, sinceStr); err == nil {
+			filter.Since = since
+		}
+	}
+	if untilStr := q.Get("until"); untilStr != "" {
+		if until, err := time.Parse(time.RFC3339, untilStr); err == nil {
+			filter.Until = until
+		}
+	}
+
+	logs, err := a.logger.Query(filter)
+	if err != nil {
+		http.Error(w, "Failed to query logs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -570,6 +1046,16 @@ func (a *API) HandleLogs(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// hasLogQueryFilters 判断请求是否携带了除 limit 外的任何日志筛选参数
+func hasLogQueryFilters(q url.Values) bool {
+	for _, key := range []string{"since", "until", "level", "account_id", "tenant_id", "request_id", "q"} {
+		if q.Get(key) != "" {
+			return true
+		}
+	}
+	return false
+}
+
 // HandleLogsSSE 实时日志 SSE 流
 func (a *API) HandleLogsSSE(w http.ResponseWriter, r *http.Request) {
 	if a.logger == nil {
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"orchids-api/internal/store"
+)
+
+// Context 是 /api/accounts/{id}/... 系列子路由共享的一次性请求上下文：account 的 ID 解析
+// 和存在性校验在 dispatchAccountRoute 里只做一次，子路由直接拿 Context.Account 用，
+// 不用再各自 TrimPrefix/ParseInt/GetAccount 一遍
+type Context struct {
+	API     *API
+	Account *store.Account
+}
+
+// APIHandler 是 accounts 子路由的统一签名，对应 Mattermost api4 里 Context + handler 的分法
+type APIHandler func(c *Context, w http.ResponseWriter, r *http.Request)
+
+// parseAccountPath 把 "/api/accounts/{id}" 或 "/api/accounts/{id}/{subRoute}" 解析成 id 和
+// 可选的子路由名；subRoute 为空表示命中裸的 {id} 路由
+func parseAccountPath(path string) (id int64, subRoute string, ok bool) {
+	trimmed := strings.TrimPrefix(path, "/api/accounts/")
+	parts := strings.Split(trimmed, "/")
+
+	switch len(parts) {
+	case 1:
+		idVal, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return 0, "", false
+		}
+		return idVal, "", true
+	case 2:
+		idVal, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return 0, "", false
+		}
+		return idVal, parts[1], true
+	default:
+		return 0, "", false
+	}
+}
+
+// dispatchAccountRoute 校验请求方法、解析出账号后把一份 Context 喂给子路由处理函数；
+// 账号不存在时统一返回 404，子路由自身不用再处理这种情况
+func (a *API) dispatchAccountRoute(id int64, method string, w http.ResponseWriter, r *http.Request, h APIHandler) {
+	if r.Method != method {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	acc, err := a.store.GetAccount(id)
+	if err != nil {
+		http.Error(w, "Account not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	h(&Context{API: a, Account: acc}, w, r)
+}
+
+// parseJobPath 把 "/api/jobs/{id}" 或 "/api/jobs/{id}/events" 解析成 job ID 和可选的子路由名；
+// job ID 是 job.Manager 分配的字符串（不是数据库自增 ID），所以这里不像 parseAccountPath 那样
+// 做 ParseInt
+func parseJobPath(path string) (id string, subRoute string, ok bool) {
+	trimmed := strings.TrimPrefix(path, "/api/jobs/")
+	parts := strings.Split(trimmed, "/")
+
+	switch len(parts) {
+	case 1:
+		if parts[0] == "" {
+			return "", "", false
+		}
+		return parts[0], "", true
+	case 2:
+		return parts[0], parts[1], true
+	default:
+		return "", "", false
+	}
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+
+	"orchids-api/internal/store"
+)
+
+// exportFormatVersion 是新版加密导出包的 Version 值；HandleImport 靠这个字段区分
+// v1（明文 ExportData）和 v2（本文件的 exportEnvelopeV2）
+const exportFormatVersion = 2
+
+// exportEnvelopeV2 是 v2 导出包在磁盘/线上的格式：Accounts 本身不出现在这里，而是作为
+// JSON 编码后用 Argon2id 派生的密钥以 AES-256-GCM 加密的密文；HMAC 覆盖密文，让篡改在
+// 尝试用派生密钥解密之前就能被拒绝，而不是等 GCM 认证失败才发现
+type exportEnvelopeV2 struct {
+	Version    int       `json:"version"`
+	ExportAt   time.Time `json:"export_at"`
+	Fields     []string  `json:"fields,omitempty"`
+	Salt       string    `json:"salt"`
+	Nonce      string    `json:"nonce"`
+	Ciphertext string    `json:"ciphertext"`
+	HMAC       string    `json:"hmac"`
+}
+
+// Argon2id 参数：内存成本按 OWASP 推荐的最低档（64 MiB），4 线程，单次迭代，
+// 导出/导入是低频操作，没必要为了省这点 CPU 降低参数
+const (
+	argonSaltSize = 16
+	argonTime     = 1
+	argonMemory   = 64 * 1024
+	argonThreads  = 4
+	argonKeyLen   = 32
+)
+
+// applyFieldSelector 按 fields 白名单清空账号里未被选中的凭据字段（session_id、
+// client_cookie、client_uat）；fields 为空表示不做任何过滤（和 v1 行为一致，导出全部字段）
+func applyFieldSelector(accounts []store.Account, fields []string) []store.Account {
+	if len(fields) == 0 {
+		return accounts
+	}
+
+	allowed := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		allowed[strings.TrimSpace(f)] = true
+	}
+
+	out := make([]store.Account, len(accounts))
+	for i, acc := range accounts {
+		if !allowed["session_id"] {
+			acc.SessionID = ""
+		}
+		if !allowed["client_cookie"] {
+			acc.ClientCookie = ""
+		}
+		if !allowed["client_uat"] {
+			acc.ClientUat = ""
+		}
+		out[i] = acc
+	}
+	return out
+}
+
+func deriveExportKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+}
+
+// deriveHMACKey 从加密密钥派生出单独的 HMAC key，避免同一个 key 同时当 AEAD key 和 MAC key
+func deriveHMACKey(key []byte) []byte {
+	sum := sha256.Sum256(append([]byte("orchids-export-hmac:"), key...))
+	return sum[:]
+}
+
+func hmacSum(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, deriveHMACKey(key))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// encryptAccountsV2 把 accounts（已按 fields 过滤）序列化后用 passphrase 派生的密钥加密，
+// 封装成可以直接下发给客户端的 exportEnvelopeV2
+func encryptAccountsV2(accounts []store.Account, fields []string, passphrase string) (*exportEnvelopeV2, error) {
+	plaintext, err := json.Marshal(applyFieldSelector(accounts, fields))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal accounts: %w", err)
+	}
+
+	salt := make([]byte, argonSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := deriveExportKey(passphrase, salt)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init GCM: %w", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
+
+	return &exportEnvelopeV2{
+		Version:    exportFormatVersion,
+		ExportAt:   time.Now(),
+		Fields:     fields,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+		HMAC:       base64.StdEncoding.EncodeToString(hmacSum(key, ciphertext)),
+	}, nil
+}
+
+// decryptAccountsV2 校验 HMAC 再做 AES-256-GCM 解密；两种校验失败都统一报错，不区分
+// "密码错误" 和 "被篡改"，避免把可用于爆破密码的 oracle 暴露给调用方
+func decryptAccountsV2(env *exportEnvelopeV2, passphrase string) ([]store.Account, error) {
+	salt, err := base64.StdEncoding.DecodeString(env.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt encoding: %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(env.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce encoding: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext encoding: %w", err)
+	}
+	wantMAC, err := base64.StdEncoding.DecodeString(env.HMAC)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hmac encoding: %w", err)
+	}
+
+	key := deriveExportKey(passphrase, salt)
+
+	if !hmac.Equal(hmacSum(key, ciphertext), wantMAC) {
+		return nil, fmt.Errorf("integrity check failed: wrong passphrase or the bundle has been tampered with")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init GCM: %w", err)
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("integrity check failed: wrong passphrase or the bundle has been tampered with")
+	}
+
+	var accounts []store.Account
+	if err := json.Unmarshal(plaintext, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal decrypted accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+// HandleExport 导出全部账号；带 X-Export-Passphrase 请求头时产出加密的 v2 包
+// （可选 ?fields=session_id,client_cookie 过滤凭据字段），否则保持 v1 明文 JSON 不变
+func (a *API) HandleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	accountPtrs, err := a.store.ListAccounts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	accounts := make([]store.Account, len(accountPtrs))
+	for i, acc := range accountPtrs {
+		accounts[i] = *acc
+		accounts[i].ID = 0
+		accounts[i].RequestCount = 0
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=accounts_export.json")
+
+	passphrase := r.Header.Get("X-Export-Passphrase")
+	if passphrase == "" {
+		json.NewEncoder(w).Encode(ExportData{Version: 1, ExportAt: time.Now(), Accounts: accounts})
+		return
+	}
+
+	var fields []string
+	if raw := r.URL.Query().Get("fields"); raw != "" {
+		fields = strings.Split(raw, ",")
+	}
+
+	envelope, err := encryptAccountsV2(accounts, fields, passphrase)
+	if err != nil {
+		http.Error(w, "Failed to encrypt export: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(envelope)
+}
+
+// HandleImport 按 Version 字段自动识别 v1（明文）/ v2（加密）导入包；v2 需要
+// X-Export-Passphrase 请求头来解密。?dry_run=true 只返回将要导入的数量，不写入 store
+func (a *API) HandleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var versionProbe struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(body, &versionProbe); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var accounts []store.Account
+
+	switch versionProbe.Version {
+	case 0, 1:
+		var exportData ExportData
+		if err := json.Unmarshal(body, &exportData); err != nil {
+			http.Error(w, "Invalid v1 export bundle: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		accounts = exportData.Accounts
+
+	case exportFormatVersion:
+		var envelope exportEnvelopeV2
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			http.Error(w, "Invalid v2 export bundle: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		passphrase := r.Header.Get("X-Export-Passphrase")
+		if passphrase == "" {
+			http.Error(w, "X-Export-Passphrase header required for v2 export bundles", http.StatusBadRequest)
+			return
+		}
+
+		accounts, err = decryptAccountsV2(&envelope, passphrase)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported export bundle version: %d", versionProbe.Version), http.StatusBadRequest)
+		return
+	}
+
+	result := ImportResult{Total: len(accounts)}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.URL.Query().Get("dry_run") == "true" {
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	for _, acc := range accounts {
+		acc.ID = 0
+		acc.RequestCount = 0
+		if err := a.store.CreateAccount(&acc); err != nil {
+			log.Printf("Failed to import account %s: %v", acc.Name, err)
+			result.Skipped++
+		} else {
+			result.Imported++
+		}
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"testing"
+
+	"orchids-api/internal/store"
+)
+
+func TestApplyFieldSelectorFiltersUnlistedFields(t *testing.T) {
+	accounts := []store.Account{{
+		Name:         "acct",
+		SessionID:    "sess",
+		ClientCookie: "cookie",
+		ClientUat:    "uat",
+	}}
+
+	out := applyFieldSelector(accounts, []string{"session_id"})
+	if len(out) != 1 {
+		t.Fatalf("expected 1 account, got %d", len(out))
+	}
+	if out[0].SessionID != "sess" {
+		t.Errorf("session_id should survive the selector, got %q", out[0].SessionID)
+	}
+	if out[0].ClientCookie != "" || out[0].ClientUat != "" {
+		t.Errorf("fields not in the selector should be cleared, got cookie=%q uat=%q", out[0].ClientCookie, out[0].ClientUat)
+	}
+}
+
+func TestApplyFieldSelectorEmptyKeepsAllFields(t *testing.T) {
+	accounts := []store.Account{{SessionID: "sess", ClientCookie: "cookie", ClientUat: "uat"}}
+	out := applyFieldSelector(accounts, nil)
+	if out[0].SessionID != "sess" || out[0].ClientCookie != "cookie" || out[0].ClientUat != "uat" {
+		t.Errorf("empty fields selector should keep all fields unchanged, got %+v", out[0])
+	}
+}
+
+func TestEncryptDecryptAccountsV2RoundTrip(t *testing.T) {
+	accounts := []store.Account{{Name: "acct", SessionID: "sess", Email: "a@b.com"}}
+
+	envelope, err := encryptAccountsV2(accounts, nil, "correct-horse-battery-staple")
+	if err != nil {
+		t.Fatalf("encryptAccountsV2 failed: %v", err)
+	}
+
+	got, err := decryptAccountsV2(envelope, "correct-horse-battery-staple")
+	if err != nil {
+		t.Fatalf("decryptAccountsV2 failed: %v", err)
+	}
+	if len(got) != 1 || got[0].SessionID != "sess" || got[0].Email != "a@b.com" {
+		t.Errorf("round-tripped accounts do not match, got %+v", got)
+	}
+}
+
+func TestDecryptAccountsV2RejectsWrongPassphrase(t *testing.T) {
+	accounts := []store.Account{{Name: "acct", SessionID: "sess"}}
+
+	envelope, err := encryptAccountsV2(accounts, nil, "correct-passphrase")
+	if err != nil {
+		t.Fatalf("encryptAccountsV2 failed: %v", err)
+	}
+
+	if _, err := decryptAccountsV2(envelope, "wrong-passphrase"); err == nil {
+		t.Error("expected decryption with the wrong passphrase to fail")
+	}
+}
+
+func TestDecryptAccountsV2RejectsTamperedCiphertext(t *testing.T) {
+	accounts := []store.Account{{Name: "acct", SessionID: "sess"}}
+
+	envelope, err := encryptAccountsV2(accounts, nil, "correct-passphrase")
+	if err != nil {
+		t.Fatalf("encryptAccountsV2 failed: %v", err)
+	}
+
+	// 翻转密文的最后一个 base64 字符，HMAC 校验应该在解密之前就拒绝
+	tampered := []byte(envelope.Ciphertext)
+	tampered[len(tampered)-1] ^= 1
+	envelope.Ciphertext = string(tampered)
+
+	if _, err := decryptAccountsV2(envelope, "correct-passphrase"); err == nil {
+		t.Error("expected decryption of a tampered ciphertext to fail")
+	}
+}
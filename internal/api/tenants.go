@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"orchids-api/internal/store"
+	"orchids-api/internal/tenant"
+)
+
+// tenantRequest 是 /api/tenants 的请求体：api_key 只在创建/轮换时以明文传入，
+// 落库前立即哈希，永不回显（对应 store.Tenant.APIKeyHash 的 json:"-"）
+type tenantRequest struct {
+	store.Tenant
+	APIKey string `json:"api_key,omitempty"`
+}
+
+func (a *API) HandleTenants(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		tenants, err := a.store.ListTenants()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(tenants)
+
+	case http.MethodPost:
+		var req tenantRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.APIKey == "" {
+			http.Error(w, "api_key is required", http.StatusBadRequest)
+			return
+		}
+		req.Tenant.APIKeyHash = tenant.HashAPIKey(req.APIKey)
+
+		if err := a.store.CreateTenant(&req.Tenant); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(req.Tenant)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) HandleTenantByID(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/tenants/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		t, err := a.store.GetTenant(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(t)
+
+	case http.MethodPut:
+		existing, err := a.store.GetTenant(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		var req tenantRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Tenant.ID = id
+
+		if req.APIKey != "" {
+			req.Tenant.APIKeyHash = tenant.HashAPIKey(req.APIKey)
+		} else {
+			req.Tenant.APIKeyHash = existing.APIKeyHash
+		}
+
+		if err := a.store.UpdateTenant(&req.Tenant); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(req.Tenant)
+
+	case http.MethodDelete:
+		if err := a.store.DeleteTenant(id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,43 @@
+// Package audit 给每一次完成的请求落一条结构化账单记录，供运营方做用量/计费分析、
+// 也让负载均衡未来能参考历史成本数据做决策。和 logger.RequestLogger 的 Store 接口是
+// 同一个思路：Sink 是可插拔的持久化后端，记录本身和落盘方式解耦
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Record 是一次完成请求（无论成功还是失败）的账单行
+type Record struct {
+	RequestID                string    `json:"request_id"`
+	Timestamp                time.Time `json:"timestamp"`
+	AccountID                int64     `json:"account_id,omitempty"`
+	AccountName              string    `json:"account_name,omitempty"`
+	Model                    string    `json:"model"`
+	InputTokens              int       `json:"input_tokens"`
+	OutputTokens             int       `json:"output_tokens"`
+	CacheCreationInputTokens int       `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int       `json:"cache_read_input_tokens,omitempty"`
+	StopReason               string    `json:"stop_reason"`
+	LatencyMs                int64     `json:"latency_ms"`
+	RetryCount               int       `json:"retry_count"`
+	UpstreamStatus           int       `json:"upstream_status,omitempty"`
+	PromptHash               string    `json:"prompt_hash"`
+}
+
+// Sink 是审计记录的持久化后端的抽象，便于在 JSONL 文件、SQLite、Kafka/NSQ 之间切换
+// 而不改动 handler 里的记录调用点
+type Sink interface {
+	// Write 持久化一条审计记录，不应阻塞调用方太久
+	Write(record Record) error
+	// Close 刷新并关闭底层资源
+	Close() error
+}
+
+// HashPrompt 返回 prompt 的 sha256 十六进制摘要，用于去重/排查而不在账单里留明文
+func HashPrompt(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,209 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxFileSize 单个账单文件达到该大小后触发滚动（字节），和 logger.FileStore 的
+	// 默认值保持一致
+	DefaultMaxFileSize = 10 * 1024 * 1024
+	// DefaultRotateInterval 即使未达到体积上限，也按该时间间隔滚动文件
+	DefaultRotateInterval = 24 * time.Hour
+	// DefaultRetention 滚动归档文件最多保留的份数，超出的按时间从旧到新删除
+	DefaultRetention = 30
+
+	activeFileName = "audit.jsonl"
+)
+
+// JSONLSink 将 Record 以换行分隔 JSON 的形式写入 dir 下的滚动文件集：当前文件为
+// audit.jsonl，滚动后按时间戳重命名并 gzip 压缩为归档文件
+type JSONLSink struct {
+	dir         string
+	maxFileSize int64
+	rotateEvery time.Duration
+	retention   int
+
+	mu       sync.Mutex
+	file     *os.File
+	writer   *bufio.Writer
+	size     int64
+	openedAt time.Time
+}
+
+// NewJSONLSink 创建（或打开已存在的）滚动 JSONL 账单存储
+func NewJSONLSink(dir string) (*JSONLSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create audit dir: %w", err)
+	}
+
+	s := &JSONLSink{
+		dir:         dir,
+		maxFileSize: DefaultMaxFileSize,
+		rotateEvery: DefaultRotateInterval,
+		retention:   DefaultRetention,
+	}
+
+	if err := s.openActive(); err != nil {
+		return nil, err
+	}
+
+	s.cleanupOldArchives()
+
+	return s, nil
+}
+
+func (s *JSONLSink) activePath() string {
+	return filepath.Join(s.dir, activeFileName)
+}
+
+func (s *JSONLSink) openActive() error {
+	path := s.activePath()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open active audit file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat active audit file: %w", err)
+	}
+
+	s.file = f
+	s.writer = bufio.NewWriter(f)
+	s.size = info.Size()
+	s.openedAt = time.Now()
+	return nil
+}
+
+// Write 追加一条账单记录；达到大小或时间上限时先滚动再写入
+func (s *JSONLSink) Write(record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shouldRotate() {
+		if err := s.rotateLocked(); err != nil {
+			return fmt.Errorf("rotate audit file: %w", err)
+		}
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	n, err := s.writer.Write(data)
+	if err != nil {
+		return err
+	}
+	s.size += int64(n)
+
+	// 逐条 flush：账单数据不容许因为缓冲区未落盘而在崩溃时丢失
+	return s.writer.Flush()
+}
+
+func (s *JSONLSink) shouldRotate() bool {
+	if s.size >= s.maxFileSize {
+		return true
+	}
+	if s.rotateEvery > 0 && time.Since(s.openedAt) >= s.rotateEvery {
+		return true
+	}
+	return false
+}
+
+func (s *JSONLSink) rotateLocked() error {
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	archiveName := fmt.Sprintf("audit-%s.jsonl.gz", time.Now().Format("20060102-150405"))
+	if err := gzipFile(s.activePath(), filepath.Join(s.dir, archiveName)); err != nil {
+		return err
+	}
+	if err := os.Remove(s.activePath()); err != nil {
+		return err
+	}
+
+	s.cleanupOldArchives()
+
+	return s.openActive()
+}
+
+func gzipFile(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	gw := gzip.NewWriter(dst)
+	if _, err := io.Copy(gw, src); err != nil {
+		gw.Close()
+		return err
+	}
+	return gw.Close()
+}
+
+// cleanupOldArchives 仅保留最近 retention 份归档文件
+func (s *JSONLSink) cleanupOldArchives() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+
+	var archives []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		if strings.HasPrefix(name, "audit-") && strings.HasSuffix(name, ".jsonl.gz") {
+			archives = append(archives, name)
+		}
+	}
+
+	if len(archives) <= s.retention {
+		return
+	}
+
+	sort.Strings(archives)
+	for i := 0; i < len(archives)-s.retention; i++ {
+		os.Remove(filepath.Join(s.dir, archives[i]))
+	}
+}
+
+// Close 刷新缓冲区并关闭活动文件
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writer != nil {
+		s.writer.Flush()
+	}
+	if s.file != nil {
+		return s.file.Close()
+	}
+	return nil
+}
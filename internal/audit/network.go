@@ -0,0 +1,135 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	networkQueueBuffer    = 1000 // 和 logger.lokiQueueBuffer 的思路一致：有界 channel，满了就丢最旧的
+	networkMaxRetries     = 5
+	networkInitialBackoff = 500 * time.Millisecond
+	networkMaxBackoff     = 30 * time.Second
+)
+
+// NetworkSink 把每条审计记录作为一条消息 POST 给一个基于 HTTP 的消息队列：NSQ 的
+// /pub?topic=... 接口或者 Kafka REST Proxy 的 /topics/{name} 接口都是这个形状，不需要
+// 额外引入原生 Kafka 协议客户端依赖。后台 goroutine 消费有界 channel，满载时丢弃最旧的记录
+type NetworkSink struct {
+	url    string
+	client *http.Client
+
+	queue  chan Record
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewNetworkSink 创建并启动网络转发的审计 Sink；url 应该是完整的发布端点
+// （例如 http://nsqd:4151/pub?topic=orchids-audit）
+func NewNetworkSink(url string) *NetworkSink {
+	s := &NetworkSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan Record, networkQueueBuffer),
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+
+	go s.run()
+
+	log.Printf("[AuditNetworkSink] 已启动，推送至 %s", url)
+
+	return s
+}
+
+// Write 将一条审计记录加入待推送队列（非阻塞）；队列满时丢弃最旧的一条，保留最新记录
+func (s *NetworkSink) Write(record Record) error {
+	select {
+	case s.queue <- record:
+	default:
+		select {
+		case <-s.queue:
+		default:
+		}
+		select {
+		case s.queue <- record:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close 停止后台 goroutine 并等待其退出，退出前会尽力 flush 队列中剩余的记录
+func (s *NetworkSink) Close() error {
+	close(s.stopCh)
+	<-s.doneCh
+	return nil
+}
+
+func (s *NetworkSink) run() {
+	defer close(s.doneCh)
+
+	for {
+		select {
+		case record := <-s.queue:
+			if err := s.push(record); err != nil {
+				log.Printf("[AuditNetworkSink] 推送失败，丢弃本条记录 %s: %v", record.RequestID, err)
+			}
+		case <-s.stopCh:
+			for {
+				select {
+				case record := <-s.queue:
+					if err := s.push(record); err != nil {
+						log.Printf("[AuditNetworkSink] 推送失败，丢弃本条记录 %s: %v", record.RequestID, err)
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// push 以指数退避重试把单条记录 POST 给消息队列的发布端点
+func (s *NetworkSink) push(record Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode audit record: %w", err)
+	}
+
+	backoff := networkInitialBackoff
+	var lastErr error
+	for attempt := 0; attempt < networkMaxRetries; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			lastErr = err
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode < 500 {
+				if resp.StatusCode >= 300 {
+					return fmt.Errorf("audit publish rejected: status %d", resp.StatusCode)
+				}
+				return nil
+			}
+			lastErr = fmt.Errorf("audit publish: server error status %d", resp.StatusCode)
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > networkMaxBackoff {
+			backoff = networkMaxBackoff
+		}
+	}
+
+	return lastErr
+}
@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteSink 把审计记录写进一张本地 SQLite 表；和 store.Store 一样用 modernc.org/sqlite
+// 保持纯 Go、不需要 CGO
+type SQLiteSink struct {
+	db *sql.DB
+}
+
+// NewSQLiteSink 打开（或创建）dbPath 处的 SQLite 数据库并建表
+func NewSQLiteSink(dbPath string) (*SQLiteSink, error) {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("open audit database: %w", err)
+	}
+
+	s := &SQLiteSink{db: db}
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_records (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			request_id TEXT NOT NULL,
+			timestamp DATETIME NOT NULL,
+			account_id INTEGER,
+			account_name TEXT,
+			model TEXT,
+			input_tokens INTEGER DEFAULT 0,
+			output_tokens INTEGER DEFAULT 0,
+			cache_creation_input_tokens INTEGER DEFAULT 0,
+			cache_read_input_tokens INTEGER DEFAULT 0,
+			stop_reason TEXT,
+			latency_ms INTEGER DEFAULT 0,
+			retry_count INTEGER DEFAULT 0,
+			upstream_status INTEGER DEFAULT 0,
+			prompt_hash TEXT
+		)
+	`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create audit_records table: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_audit_records_account ON audit_records(account_id)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create audit index: %w", err)
+	}
+
+	return s, nil
+}
+
+// Write 插入一条账单记录
+func (s *SQLiteSink) Write(record Record) error {
+	_, err := s.db.Exec(`
+		INSERT INTO audit_records (
+			request_id, timestamp, account_id, account_name, model,
+			input_tokens, output_tokens, cache_creation_input_tokens, cache_read_input_tokens,
+			stop_reason, latency_ms, retry_count, upstream_status, prompt_hash
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, record.RequestID, record.Timestamp, record.AccountID, record.AccountName, record.Model,
+		record.InputTokens, record.OutputTokens, record.CacheCreationInputTokens, record.CacheReadInputTokens,
+		record.StopReason, record.LatencyMs, record.RetryCount, record.UpstreamStatus, record.PromptHash)
+	return err
+}
+
+// Close 关闭底层数据库连接
+func (s *SQLiteSink) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,132 @@
+// Package builtintools 提供一小撮内置工具（HTTP GET、天气、搜索、读取网页正文），
+// 注册进 internal/tools.ToolRegistry 后既能被模型当普通工具调用，也能通过
+// POST /v1/orchids/tools/invoke 直接触发执行。所有工具名都带 may_ 前缀，跟
+// tools.ExecutablePrefix 的约定一致，表示它们允许在服务端就地执行。
+package builtintools
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"orchids-api/internal/tools"
+)
+
+const (
+	ToolHTTPGet = "may_http_get"
+	ToolWeather = "may_weather"
+	ToolSearch  = "may_search"
+	ToolReadURL = "may_read_url"
+)
+
+// BuiltinKeyToTool 把 X-Orchids-Builtin-Tools 请求头里用的简短别名映射到实际工具名，
+// 客户端写 "X-Orchids-Builtin-Tools: weather,http" 就能同时启用 may_weather 和
+// may_http_get，不需要记住带前缀的完整名字
+var BuiltinKeyToTool = map[string]string{
+	"http":     ToolHTTPGet,
+	"weather":  ToolWeather,
+	"search":   ToolSearch,
+	"read_url": ToolReadURL,
+}
+
+var sharedHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+type definition struct {
+	schema json.RawMessage
+	exec   tools.ExecFunc
+}
+
+// definitions 是内置工具的唯一定义来源：Register 用它登记进一个 ToolRegistry，
+// SchemasByKeys 用它按 X-Orchids-Builtin-Tools 里点的别名挑出一个子集，两处都不需要
+// 真的持有一个 Registry 实例
+func definitions() map[string]definition {
+	return map[string]definition{
+		ToolHTTPGet: {
+			schema: schema(ToolHTTPGet, "对任意 URL 发起一次 HTTP GET 请求，返回状态码和响应体（截断到 16KB）", map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"url": map[string]interface{}{"type": "string", "description": "要请求的完整 URL"}},
+				"required":   []string{"url"},
+			}),
+			exec: httpGetExec,
+		},
+		ToolReadURL: {
+			schema: schema(ToolReadURL, "抓取一个网页并返回去除标签后的正文文本（截断到 16KB）", map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"url": map[string]interface{}{"type": "string", "description": "要读取的网页 URL"}},
+				"required":   []string{"url"},
+			}),
+			exec: readURLExec,
+		},
+		ToolWeather: {
+			schema: schema(ToolWeather, "查询指定地点当前天气", map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"location": map[string]interface{}{"type": "string", "description": "城市名或地点描述"}},
+				"required":   []string{"location"},
+			}),
+			exec: weatherExec,
+		},
+		ToolSearch: {
+			schema: schema(ToolSearch, "对给定查询词做一次网络搜索，返回结果摘要列表", map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"query": map[string]interface{}{"type": "string", "description": "搜索关键词"}},
+				"required":   []string{"query"},
+			}),
+			exec: searchExec,
+		},
+	}
+}
+
+// Register 把全部内置工具登记进 registry；重复调用是幂等的（后面的登记会覆盖前面的）
+func Register(registry tools.ToolRegistry) {
+	for name, def := range definitions() {
+		registry.Register(name, def.schema, def.exec)
+	}
+}
+
+// SchemasByKeys 按 X-Orchids-Builtin-Tools 请求头里的别名（如 "weather,http"）挑出对应
+// 工具的 schema，未识别的别名直接忽略——跟 tools.MergeSchemas 一样，交给调用方去重后
+// 并入 req.Tools
+func SchemasByKeys(keys []string) []interface{} {
+	defs := definitions()
+	var out []interface{}
+	for _, key := range keys {
+		name, ok := BuiltinKeyToTool[strings.TrimSpace(key)]
+		if !ok {
+			continue
+		}
+		def, ok := defs[name]
+		if !ok {
+			continue
+		}
+		var parsed map[string]interface{}
+		if err := json.Unmarshal(def.schema, &parsed); err != nil {
+			continue
+		}
+		out = append(out, parsed)
+	}
+	return out
+}
+
+func schema(name, description string, inputSchema map[string]interface{}) json.RawMessage {
+	raw, _ := json.Marshal(map[string]interface{}{
+		"name":         name,
+		"description":  description,
+		"input_schema": inputSchema,
+	})
+	return raw
+}
+
+func decodeInput(input json.RawMessage, v interface{}) error {
+	if len(input) == 0 {
+		return nil
+	}
+	return json.Unmarshal(input, v)
+}
+
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit]
+}
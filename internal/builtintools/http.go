@@ -0,0 +1,90 @@
+package builtintools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const maxBodyBytes = 16 * 1024
+
+type httpGetInput struct {
+	URL string `json:"url"`
+}
+
+type httpGetOutput struct {
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+}
+
+func httpGetExec(ctx context.Context, input json.RawMessage) (json.RawMessage, error) {
+	var in httpGetInput
+	if err := decodeInput(input, &in); err != nil {
+		return nil, fmt.Errorf("may_http_get: invalid input: %w", err)
+	}
+	if in.URL == "" {
+		return nil, fmt.Errorf("may_http_get: url is required")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, in.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("may_http_get: %w", err)
+	}
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("may_http_get: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("may_http_get: reading response: %w", err)
+	}
+
+	return json.Marshal(httpGetOutput{Status: resp.StatusCode, Body: truncate(string(body), maxBodyBytes)})
+}
+
+type readURLInput struct {
+	URL string `json:"url"`
+}
+
+type readURLOutput struct {
+	Status int    `json:"status"`
+	Text   string `json:"text"`
+}
+
+var htmlTagPattern = regexp.MustCompile(`(?is)<script.*?</script>|<style.*?</style>|<[^>]+>`)
+
+func readURLExec(ctx context.Context, input json.RawMessage) (json.RawMessage, error) {
+	var in readURLInput
+	if err := decodeInput(input, &in); err != nil {
+		return nil, fmt.Errorf("may_read_url: invalid input: %w", err)
+	}
+	if in.URL == "" {
+		return nil, fmt.Errorf("may_read_url: url is required")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, in.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("may_read_url: %w", err)
+	}
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("may_read_url: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes*4))
+	if err != nil {
+		return nil, fmt.Errorf("may_read_url: reading response: %w", err)
+	}
+
+	text := htmlTagPattern.ReplaceAllString(string(body), " ")
+	text = strings.Join(strings.Fields(text), " ")
+
+	return json.Marshal(readURLOutput{Status: resp.StatusCode, Text: truncate(text, maxBodyBytes)})
+}
@@ -0,0 +1,56 @@
+package builtintools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// SEARCH_API_URL 指向一个兼容的搜索服务，请求时会拼上 ?q=<query>；未配置时 may_search
+// 直接报错，不编造搜索结果
+type searchInput struct {
+	Query string `json:"query"`
+}
+
+func searchExec(ctx context.Context, input json.RawMessage) (json.RawMessage, error) {
+	var in searchInput
+	if err := decodeInput(input, &in); err != nil {
+		return nil, fmt.Errorf("may_search: invalid input: %w", err)
+	}
+	if in.Query == "" {
+		return nil, fmt.Errorf("may_search: query is required")
+	}
+
+	base := os.Getenv("SEARCH_API_URL")
+	if base == "" {
+		return nil, fmt.Errorf("may_search: SEARCH_API_URL not configured")
+	}
+
+	reqURL := base + "?q=" + url.QueryEscape(in.Query)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("may_search: %w", err)
+	}
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("may_search: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("may_search: reading response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("may_search: upstream returned %d", resp.StatusCode)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"query":   in.Query,
+		"results": truncate(string(body), maxBodyBytes),
+	})
+}
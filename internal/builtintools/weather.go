@@ -0,0 +1,56 @@
+package builtintools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// WEATHER_API_URL 指向一个兼容的天气查询服务，请求时会拼上 ?location=<location>；
+// 未配置时 may_weather 直接报错，不编造天气数据
+type weatherInput struct {
+	Location string `json:"location"`
+}
+
+func weatherExec(ctx context.Context, input json.RawMessage) (json.RawMessage, error) {
+	var in weatherInput
+	if err := decodeInput(input, &in); err != nil {
+		return nil, fmt.Errorf("may_weather: invalid input: %w", err)
+	}
+	if in.Location == "" {
+		return nil, fmt.Errorf("may_weather: location is required")
+	}
+
+	base := os.Getenv("WEATHER_API_URL")
+	if base == "" {
+		return nil, fmt.Errorf("may_weather: WEATHER_API_URL not configured")
+	}
+
+	reqURL := base + "?location=" + url.QueryEscape(in.Location)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("may_weather: %w", err)
+	}
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("may_weather: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("may_weather: reading response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("may_weather: upstream returned %d", resp.StatusCode)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"location": in.Location,
+		"report":   truncate(string(body), maxBodyBytes),
+	})
+}
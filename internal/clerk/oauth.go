@@ -0,0 +1,169 @@
+package clerk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"orchids-api/internal/store"
+)
+
+// OAuthConfig 描述账号接入用的授权码 OAuth/OIDC provider，由运营方通过后台配置写入
+// Store.SetSetting，避免把 Claude 身份提供方的 client secret 硬编码进代码
+type OAuthConfig struct {
+	AuthorizeURL string
+	TokenURL     string
+	UserInfoURL  string
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	Scopes       string
+}
+
+// LoadOAuthConfig 从 Store.GetSetting 恢复账号接入 OAuth 配置
+func LoadOAuthConfig(s *store.Store) (*OAuthConfig, error) {
+	get := func(key string) (string, error) { return s.GetSetting("account_oauth_" + key) }
+
+	authorizeURL, err := get("authorize_url")
+	if err != nil {
+		return nil, err
+	}
+	tokenURL, _ := get("token_url")
+	userInfoURL, _ := get("userinfo_url")
+	clientID, _ := get("client_id")
+	clientSecret, _ := get("client_secret")
+	redirectURI, _ := get("redirect_uri")
+	scopes, _ := get("scopes")
+
+	return &OAuthConfig{
+		AuthorizeURL: authorizeURL,
+		TokenURL:     tokenURL,
+		UserInfoURL:  userInfoURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURI:  redirectURI,
+		Scopes:       scopes,
+	}, nil
+}
+
+// SaveOAuthConfig 持久化账号接入 OAuth 配置
+func SaveOAuthConfig(s *store.Store, cfg *OAuthConfig) error {
+	set := func(key, value string) error { return s.SetSetting("account_oauth_"+key, value) }
+
+	for _, kv := range [][2]string{
+		{"authorize_url", cfg.AuthorizeURL},
+		{"token_url", cfg.TokenURL},
+		{"userinfo_url", cfg.UserInfoURL},
+		{"client_id", cfg.ClientID},
+		{"client_secret", cfg.ClientSecret},
+		{"redirect_uri", cfg.RedirectURI},
+		{"scopes", cfg.Scopes},
+	} {
+		if err := set(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildAuthorizeURL 对应 Authing SDK 的 BuildAuthorizeUrlByOidc：拼出带 state/nonce 的授权地址，
+// 管理后台把它作为"添加账号"按钮的跳转目标
+func BuildAuthorizeURL(cfg OAuthConfig, state, nonce string) string {
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {cfg.ClientID},
+		"redirect_uri":  {cfg.RedirectURI},
+		"scope":         {cfg.Scopes},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	return cfg.AuthorizeURL + "?" + params.Encode()
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// ExchangeCodeForToken 对应 GetAccessTokenByCode：用授权码换取 access token（及可用于后续
+// keeper.AccountKeeper 轮换的 refresh token）
+func ExchangeCodeForToken(cfg OAuthConfig, code string) (*oauthTokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {cfg.RedirectURI},
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.PostForm(cfg.TokenURL, form)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tokens oauthTokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tokens.AccessToken == "" {
+		return nil, fmt.Errorf("token response missing access_token")
+	}
+	return &tokens, nil
+}
+
+// FetchUserInfo 对应 GetUserInfoByAccessToken：用 access token 换取身份提供方侧的会话信息，
+// 返回值和 FetchAccountInfo 保持同样的 AccountInfo 形状，方便 callback 直接拿去建账号
+func FetchUserInfo(cfg OAuthConfig, accessToken string) (*AccountInfo, error) {
+	req, err := http.NewRequest("GET", cfg.UserInfoURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+
+	var info struct {
+		SessionID    string `json:"session_id"`
+		ClientCookie string `json:"client_cookie"`
+		ClientUat    string `json:"client_uat"`
+		ProjectID    string `json:"project_id"`
+		UserID       string `json:"sub"`
+		Email        string `json:"email"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode user info: %w", err)
+	}
+	if info.Email == "" {
+		return nil, fmt.Errorf("user info missing email")
+	}
+
+	return &AccountInfo{
+		SessionID:    info.SessionID,
+		ClientCookie: info.ClientCookie,
+		ClientUat:    info.ClientUat,
+		ProjectID:    info.ProjectID,
+		UserID:       info.UserID,
+		Email:        info.Email,
+	}, nil
+}
@@ -17,6 +17,7 @@ import (
 	"orchids-api/internal/config"
 	"orchids-api/internal/debug"
 	"orchids-api/internal/store"
+	"orchids-api/internal/upstreamerr"
 )
 
 const upstreamURL = "https://orchids-server.calmstone-6964e08a.westeurope.azurecontainerapps.io/agent/coding-agent"
@@ -104,8 +105,14 @@ func truncateSessionID(sessionID string) string {
 }
 
 // GetToken 获取 JWT Token（优先从缓存获取，使用 Singleflight 去重）
-func (c *Client) GetToken() (string, error) {
-	return tokenCache.GetOrFetch(c.config.SessionID, func() (string, error) {
+func (c *Client) GetToken(ctx context.Context) (string, error) {
+	attrs := map[string]interface{}{"session.id_prefix": truncateSessionID(c.config.SessionID)}
+	if c.account != nil {
+		attrs["account.id"] = c.account.ID
+		attrs["account.email"] = c.account.Email
+	}
+
+	return tokenCache.GetOrFetch(ctx, c.config.SessionID, attrs, func() (string, error) {
 		log.Printf("[TokenCache] 缓存未命中，获取新Token: session=%s", truncateSessionID(c.config.SessionID))
 		jwt, err := c.fetchNewToken()
 		if err != nil {
@@ -156,7 +163,7 @@ func (c *Client) InvalidateToken() {
 }
 
 func (c *Client) SendRequest(ctx context.Context, prompt string, chatHistory []interface{}, model string, onMessage func(SSEMessage), logger *debug.Logger) error {
-	token, err := c.GetToken()
+	token, err := c.GetToken(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get token: %w", err)
 	}
@@ -204,7 +211,7 @@ func (c *Client) SendRequest(ctx context.Context, prompt string, chatHistory []i
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		return upstreamerr.FromError(err)
 	}
 	defer resp.Body.Close()
 
@@ -212,12 +219,12 @@ func (c *Client) SendRequest(ctx context.Context, prompt string, chatHistory []i
 	if resp.StatusCode == http.StatusUnauthorized {
 		c.InvalidateToken()
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("upstream request failed with status %d (token invalidated): %s", resp.StatusCode, string(body))
+		return upstreamerr.FromResponse(resp, body)
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("upstream request failed with status %d: %s", resp.StatusCode, string(body))
+		return upstreamerr.FromResponse(resp, body)
 	}
 
 	reader := bufio.NewReader(resp.Body)
@@ -226,7 +233,7 @@ func (c *Client) SendRequest(ctx context.Context, prompt string, chatHistory []i
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return upstreamerr.FromError(ctx.Err())
 		default:
 		}
 
@@ -235,7 +242,7 @@ func (c *Client) SendRequest(ctx context.Context, prompt string, chatHistory []i
 			if err == io.EOF {
 				break
 			}
-			return err
+			return upstreamerr.FromError(err)
 		}
 
 		buffer.WriteString(line)
@@ -1,186 +1,166 @@
 package client
 
 import (
-	"log"
-	"sync"
+	"context"
+	"os"
 	"time"
 
 	"golang.org/x/sync/singleflight"
-)
 
-// 缓存配置
-const (
-	MaxCacheSize        = 1000              // 最大缓存条目数
-	CacheCleanupInterval = 5 * time.Minute  // 后台清理间隔
+	"orchids-api/internal/handler/metrics"
+	"orchids-api/internal/logger"
 )
 
-// CachedToken 缓存的 Token 信息
-type CachedToken struct {
-	JWT       string
-	ExpiresAt time.Time
+// TokenCache JWT Token 缓存管理器；实际存储委托给 TokenStore，TokenCache 自己只负责
+// "缓存未命中时只让一个请求去刷新"这件事——单进程部署靠 singleflight.Group，多副本部署
+// 则靠后端（比如 EtcdTokenStore）自己实现的分布式锁，见 distributedLocker
+type TokenCache struct {
+	store TokenStore
+	group singleflight.Group // 单进程去重；etcd 等后端会用自己的锁顶替这个
+
+	// requestLogger 为 nil 时 GetOrFetch 不产生 span，行为和以前完全一样；装了之后
+	// （SetRequestLogger）每次调用都会记一条 token_cache.get_or_fetch 链路事件
+	requestLogger *logger.RequestLogger
 }
 
-// TokenCache JWT Token 缓存管理器
-type TokenCache struct {
-	mu     sync.RWMutex
-	tokens map[string]*CachedToken
-	group  singleflight.Group // Singleflight 去重
+// distributedLocker 是 TokenStore 的可选扩展：实现了这个接口的后端（目前只有
+// EtcdTokenStore）说明它能提供跨副本的互斥锁，GetOrFetch 会优先用它代替本地 singleflight
+type distributedLocker interface {
+	Lock(key string) (unlock func(), err error)
 }
 
-// 全局 Token 缓存实例
-var tokenCache = &TokenCache{
-	tokens: make(map[string]*CachedToken),
+// NewTokenCache 用给定的存储后端创建一个 TokenCache
+func NewTokenCache(store TokenStore) *TokenCache {
+	return &TokenCache{store: store}
 }
 
-// 确保清理任务只启动一次
-var cleanupOnce sync.Once
-
-// startCleanup 启动后台清理任务
-func (tc *TokenCache) startCleanup() {
-	cleanupOnce.Do(func() {
-		go func() {
-			ticker := time.NewTicker(CacheCleanupInterval)
-			defer ticker.Stop()
-			for range ticker.C {
-				tc.cleanupExpired()
-			}
-		}()
-		log.Println("[TokenCache] 后台清理任务已启动")
-	})
+// SetRequestLogger 装载请求日志收集器，让 GetOrFetch 产生的 span 能经由它配置的
+// OTelExporter（如果有）导出；为 nil（默认）时 GetOrFetch 只记 Prometheus 指标，不产生 span
+func (tc *TokenCache) SetRequestLogger(l *logger.RequestLogger) {
+	tc.requestLogger = l
 }
 
-// cleanupExpired 清理过期的 Token
-func (tc *TokenCache) cleanupExpired() {
-	tc.mu.Lock()
-	defer tc.mu.Unlock()
-
-	now := time.Now()
-	expired := 0
-	for sessionID, cached := range tc.tokens {
-		if now.After(cached.ExpiresAt) {
-			delete(tc.tokens, sessionID)
-			expired++
-		}
+// 全局 Token 缓存实例：默认内存后端，InitGlobalCacheFromEnv 按配置换成 etcd 后端
+var tokenCache = NewTokenCache(NewMemoryTokenStore())
+
+// InitGlobalCacheFromEnv 按 TOKENCACHE_BACKEND（memory|etcd，默认 memory）重新装配全局
+// Token 缓存；main.go 启动时调用一次。etcd 后端需要 TOKENCACHE_ETCD_ENDPOINT
+// （形如 http://127.0.0.1:2379），TOKENCACHE_ETCD_PREFIX 可选，默认 "/orchids/tokens/"
+func InitGlobalCacheFromEnv() {
+	backend := os.Getenv("TOKENCACHE_BACKEND")
+	if backend == "" || backend == "memory" {
+		return
+	}
+	if backend != "etcd" {
+		return
 	}
 
-	if expired > 0 {
-		log.Printf("[TokenCache] 已清理 %d 个过期 Token，剩余 %d 个", expired, len(tc.tokens))
+	endpoint := os.Getenv("TOKENCACHE_ETCD_ENDPOINT")
+	if endpoint == "" {
+		return
 	}
+	prefix := os.Getenv("TOKENCACHE_ETCD_PREFIX")
+	tokenCache = NewTokenCache(NewEtcdTokenStore(endpoint, prefix))
 }
 
-// evictOldest 淘汰最旧的 Token（当缓存满时）
-func (tc *TokenCache) evictOldest() {
-	// 找到最早过期的 Token
-	var oldestKey string
-	var oldestTime time.Time
-
-	for sessionID, cached := range tc.tokens {
-		if oldestKey == "" || cached.ExpiresAt.Before(oldestTime) {
-			oldestKey = sessionID
-			oldestTime = cached.ExpiresAt
-		}
+// StatusStoreFromEnv 复用和 InitGlobalCacheFromEnv 同一套 TOKENCACHE_BACKEND/
+// TOKENCACHE_ETCD_ENDPOINT 配置，换一个 prefix 构造一个独立的 TokenStore；供
+// keeper.AccountKeeper.SetStatusStore 这类"也要跨副本共享状态，但存的不是 JWT"的调用方
+// 复用同一个 etcd 部署。TOKENCACHE_BACKEND 不是 "etcd" 时返回 nil
+func StatusStoreFromEnv(prefix string) TokenStore {
+	if os.Getenv("TOKENCACHE_BACKEND") != "etcd" {
+		return nil
 	}
-
-	if oldestKey != "" {
-		delete(tc.tokens, oldestKey)
-		log.Printf("[TokenCache] 缓存已满，淘汰最旧的 Token: %s...", oldestKey[:16])
+	endpoint := os.Getenv("TOKENCACHE_ETCD_ENDPOINT")
+	if endpoint == "" {
+		return nil
 	}
+	return NewEtcdTokenStore(endpoint, prefix)
 }
 
 // GetCachedToken 获取缓存的 Token
-// 如果 Token 不存在或即将过期（提前 5 分钟），返回空和 false
+// 如果 Token 不存在或已过期，返回空和 false；内存后端的 Get 会提前 5 分钟视为过期，
+// etcd 后端则以租约（等于写入时的 TTL）到期为准，没有提前量
 func (tc *TokenCache) GetCachedToken(sessionID string) (string, bool) {
-	tc.mu.RLock()
-	defer tc.mu.RUnlock()
-
-	cached, exists := tc.tokens[sessionID]
-	if !exists {
-		return "", false
+	jwt, ok := tc.store.Get(sessionID)
+	if ok {
+		metrics.RecordTokenCacheHit()
+	} else {
+		metrics.RecordTokenCacheMiss()
 	}
-
-	// 提前 5 分钟过期，确保返回的 Token 仍然有效
-	if time.Now().Add(5 * time.Minute).After(cached.ExpiresAt) {
-		return "", false
-	}
-
-	return cached.JWT, true
+	return jwt, ok
 }
 
 // SetCachedToken 缓存 Token
 func (tc *TokenCache) SetCachedToken(sessionID, jwt string, ttl time.Duration) {
-	tc.mu.Lock()
-	defer tc.mu.Unlock()
-
-	// 检查是否超过最大缓存大小
-	if len(tc.tokens) >= MaxCacheSize {
-		tc.evictOldest()
-	}
-
-	tc.tokens[sessionID] = &CachedToken{
-		JWT:       jwt,
-		ExpiresAt: time.Now().Add(ttl),
-	}
-
-	// 确保清理任务已启动
-	tc.startCleanup()
+	_ = tc.store.Set(sessionID, jwt, ttl)
 }
 
 // ClearToken 清除指定 session 的缓存 Token（用于 Token 失效时）
 func (tc *TokenCache) ClearToken(sessionID string) {
-	tc.mu.Lock()
-	defer tc.mu.Unlock()
-
-	delete(tc.tokens, sessionID)
+	_ = tc.store.Delete(sessionID)
 }
 
-// ClearAllTokens 清除所有缓存的 Token
-func (tc *TokenCache) ClearAllTokens() {
-	tc.mu.Lock()
-	defer tc.mu.Unlock()
+// Stats 返回缓存统计信息
+func (tc *TokenCache) Stats() (total int, valid int) {
+	return tc.store.Stats()
+}
 
-	tc.tokens = make(map[string]*CachedToken)
+// GetOrFetch 获取 Token，如果缓存未命中则调用 fetch 函数获取。单进程部署用
+// singleflight.Group 去重；存储后端实现了 distributedLocker 时（比如 EtcdTokenStore）
+// 改用它的跨副本锁，确保多个副本不会同时为同一个 sessionID 各发一次刷新请求。attrs 会
+// 原样附到 span 上（调用方通常塞 account.id/account.email/session.id_prefix），TokenCache
+// 自己不需要理解这些字段的含义
+func (tc *TokenCache) GetOrFetch(ctx context.Context, sessionID string, attrs map[string]interface{}, fetch func() (string, error)) (string, error) {
+	start := time.Now()
+	spanCtx, _ := logger.NewChildSpan(ctx)
+
+	jwt, err := tc.getOrFetch(sessionID, fetch)
+	tc.logSpan(spanCtx, attrs, start, err)
+	return jwt, err
 }
 
-// Stats 返回缓存统计信息
-func (tc *TokenCache) Stats() (total int, valid int) {
-	tc.mu.RLock()
-	defer tc.mu.RUnlock()
-
-	total = len(tc.tokens)
-	now := time.Now().Add(5 * time.Minute)
-	for _, cached := range tc.tokens {
-		if now.Before(cached.ExpiresAt) {
-			valid++
-		}
+func (tc *TokenCache) getOrFetch(sessionID string, fetch func() (string, error)) (string, error) {
+	if jwt, ok := tc.store.Get(sessionID); ok {
+		metrics.RecordTokenCacheHit()
+		return jwt, nil
 	}
-	return
-}
+	metrics.RecordTokenCacheMiss()
+
+	if locker, ok := tc.store.(distributedLocker); ok {
+		unlock, err := locker.Lock(sessionID)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
 
-// GetOrFetch 获取 Token，如果缓存未命中则调用 fetch 函数获取
-// 使用 Singleflight 确保同一 sessionID 只会并发获取一次
-func (tc *TokenCache) GetOrFetch(sessionID string, fetch func() (string, error)) (string, error) {
-	// 1. 先尝试从缓存获取
-	if jwt, ok := tc.GetCachedToken(sessionID); ok {
+		if jwt, ok := tc.store.Get(sessionID); ok {
+			return jwt, nil
+		}
+		jwt, err := fetch()
+		if err != nil {
+			return "", err
+		}
+		tc.SetCachedToken(sessionID, jwt, 50*time.Minute)
 		return jwt, nil
 	}
 
-	// 2. 使用 Singleflight 去重，确保同一 sessionID 只获取一次
-	result, err, _ := tc.group.Do(sessionID, func() (interface{}, error) {
-		// 再次检查缓存（双重检查）
-		if jwt, ok := tc.GetCachedToken(sessionID); ok {
+	result, err, shared := tc.group.Do(sessionID, func() (interface{}, error) {
+		if jwt, ok := tc.store.Get(sessionID); ok {
 			return jwt, nil
 		}
 
-		// 调用 fetch 获取新 Token
 		jwt, err := fetch()
 		if err != nil {
 			return "", err
 		}
 
-		// 缓存 Token（50 分钟有效期）
 		tc.SetCachedToken(sessionID, jwt, 50*time.Minute)
 		return jwt, nil
 	})
+	if shared {
+		metrics.RecordTokenCacheSingleflightShared()
+	}
 
 	if err != nil {
 		return "", err
@@ -188,6 +168,26 @@ func (tc *TokenCache) GetOrFetch(sessionID string, fetch func() (string, error))
 	return result.(string), nil
 }
 
+// logSpan 把一次 GetOrFetch 调用记成一条 token_cache.get_or_fetch 链路事件；requestLogger
+// 为 nil 时（未调用 SetRequestLogger）整个函数是空操作
+func (tc *TokenCache) logSpan(ctx context.Context, attrs map[string]interface{}, start time.Time, err error) {
+	if tc.requestLogger == nil {
+		return
+	}
+
+	spanAttrs := make(map[string]interface{}, len(attrs)+1)
+	for k, v := range attrs {
+		spanAttrs[k] = v
+	}
+	spanAttrs["duration_ms"] = time.Since(start).Milliseconds()
+
+	message := "ok"
+	if err != nil {
+		message = err.Error()
+	}
+	tc.requestLogger.LogEvent(ctx, "token_cache.get_or_fetch", message, spanAttrs)
+}
+
 // GetGlobalCache 获取全局缓存实例
 func GetGlobalCache() *TokenCache {
 	return tokenCache
@@ -0,0 +1,18 @@
+package client
+
+import "time"
+
+// TokenStore 是 TokenCache 的存储后端抽象：key/value 都是字符串，value 可以是 JWT
+// 本身（TokenCache 的用法），也可以是 AccountKeeper 拿来协调多副本刷新状态的 JSON blob
+// （keeper.AccountKeeper.SetStatusStore 的用法）——两边共用同一套 memory/etcd 实现，
+// 不需要分别维护两套分布式协调逻辑
+type TokenStore interface {
+	// Get 返回 key 对应的 value；key 不存在或已过期时返回 ok=false
+	Get(key string) (value string, ok bool)
+	// Set 写入 key，ttl 之后过期；ttl<=0 表示不过期
+	Set(key, value string, ttl time.Duration) error
+	// Delete 删除 key；key 本不存在时也返回 nil，和内存 map 的 delete 语义一致
+	Delete(key string) error
+	// Stats 返回当前存的总条目数，以及其中仍然有效（未过期）的条目数
+	Stats() (total int, valid int)
+}
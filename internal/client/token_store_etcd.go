@@ -0,0 +1,201 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// EtcdTokenStore 是 TokenStore 的 etcd 实现，供多副本部署共享 Token 缓存和
+// AccountKeeper 的刷新状态，避免每个副本各自独立刷新同一个 Clerk session。跟
+// respcache.Redis 的思路一样：不引入 go.etcd.io/etcd 客户端依赖，直接走 etcd v3 自带的
+// grpc-gateway JSON/HTTP 接口（/v3/kv/..., /v3/lease/...），key/value 按协议要求 base64
+// 编码
+type EtcdTokenStore struct {
+	endpoint   string // 形如 "http://127.0.0.1:2379"，多端点故障转移留给前面的 LB/代理做
+	prefix     string // 形如 "/orchids/tokens/"
+	httpClient *http.Client
+	lockTTL    time.Duration // 分布式锁的租约时长，锁持有者意外挂掉时靠这个自动释放
+}
+
+// NewEtcdTokenStore 创建一个 etcd 后端的 TokenStore；prefix 末尾没有 "/" 时会自动补上
+func NewEtcdTokenStore(endpoint, prefix string) *EtcdTokenStore {
+	if prefix == "" {
+		prefix = "/orchids/tokens/"
+	} else if prefix[len(prefix)-1] != '/' {
+		prefix += "/"
+	}
+	return &EtcdTokenStore{
+		endpoint:   endpoint,
+		prefix:     prefix,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		lockTTL:    30 * time.Second,
+	}
+}
+
+func (s *EtcdTokenStore) fullKey(key string) string {
+	return s.prefix + key
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func unb64(s string) string {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
+
+func (s *EtcdTokenStore) post(path string, body interface{}, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Post(s.endpoint+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("etcd %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("etcd %s: status %d", path, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Get 发一个 /v3/kv/range 请求；过期的 key 已经被 etcd 自己的 lease 机制删掉了，
+// 所以这里查得到就是有效的，不需要再额外判断过期时间
+func (s *EtcdTokenStore) Get(key string) (string, bool) {
+	var out struct {
+		Kvs []struct {
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	if err := s.post("/v3/kv/range", map[string]string{"key": b64(s.fullKey(key))}, &out); err != nil {
+		log.Printf("[EtcdTokenStore] Get(%s) 失败: %v", key, err)
+		return "", false
+	}
+	if len(out.Kvs) == 0 {
+		return "", false
+	}
+	return unb64(out.Kvs[0].Value), true
+}
+
+// grantLease 申请一个 ttlSeconds 秒的租约，返回租约 ID；ttlSeconds<=0 时返回 0（不挂租约）
+func (s *EtcdTokenStore) grantLease(ttlSeconds int64) (int64, error) {
+	if ttlSeconds <= 0 {
+		return 0, nil
+	}
+	var out struct {
+		ID string `json:"ID"`
+	}
+	if err := s.post("/v3/lease/grant", map[string]int64{"TTL": ttlSeconds}, &out); err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(out.ID, 10, 64)
+}
+
+// Set 写入一个 key，ttl>0 时挂一个同等时长的租约，到期由 etcd 自动删除（等价于内存后端
+// 里清理 goroutine 做的事，只是换成了 etcd 内置机制）
+func (s *EtcdTokenStore) Set(key, value string, ttl time.Duration) error {
+	leaseID, err := s.grantLease(int64(ttl / time.Second))
+	if err != nil {
+		return fmt.Errorf("申请租约失败: %w", err)
+	}
+
+	body := map[string]interface{}{
+		"key":   b64(s.fullKey(key)),
+		"value": b64(value),
+	}
+	if leaseID != 0 {
+		body["lease"] = strconv.FormatInt(leaseID, 10)
+	}
+	return s.post("/v3/kv/put", body, nil)
+}
+
+// Delete 删除一个 key
+func (s *EtcdTokenStore) Delete(key string) error {
+	return s.post("/v3/kv/deleterange", map[string]string{"key": b64(s.fullKey(key))}, nil)
+}
+
+// Stats 统计 prefix 下的 key 数量；etcd 已经把过期的 key 清掉了，所以 total 和 valid
+// 永远相等，跟内存后端里"未过期才算 valid"的语义不完全对称；prefix 下的 "locks/" 锁 key
+// 也会被计入
+func (s *EtcdTokenStore) Stats() (total int, valid int) {
+	rangeEnd := s.prefix
+	if len(rangeEnd) > 0 {
+		b := []byte(rangeEnd)
+		b[len(b)-1]++
+		rangeEnd = string(b)
+	}
+
+	var out struct {
+		Count string `json:"count"`
+	}
+	if err := s.post("/v3/kv/range", map[string]interface{}{
+		"key":        b64(s.prefix),
+		"range_end":  b64(rangeEnd),
+		"count_only": true,
+	}, &out); err != nil {
+		log.Printf("[EtcdTokenStore] Stats 失败: %v", err)
+		return 0, 0
+	}
+	n, _ := strconv.Atoi(out.Count)
+	return n, n
+}
+
+// Lock 获取一把以 key 为名的集群级分布式锁：靠 etcd 事务实现"仅当锁 key 不存在时才创建"，
+// 抢不到就短暂退避重试；锁本身挂一个租约，持有者进程崩溃时不会一直占着锁不释放。这是
+// GetOrFetch 在 etcd 后端下代替 singleflight.Group 的跨副本协调机制
+func (s *EtcdTokenStore) Lock(key string) (func(), error) {
+	lockKey := s.prefix + "locks/" + key
+
+	leaseID, err := s.grantLease(int64(s.lockTTL / time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("申请锁租约失败: %w", err)
+	}
+
+	deadline := time.Now().Add(s.lockTTL)
+	for time.Now().Before(deadline) {
+		var out struct {
+			Succeeded bool `json:"succeeded"`
+		}
+		err := s.post("/v3/kv/txn", map[string]interface{}{
+			"compare": []map[string]interface{}{{
+				"target":          "CREATE",
+				"key":             b64(lockKey),
+				"create_revision": 0,
+			}},
+			"success": []map[string]interface{}{{
+				"request_put": map[string]interface{}{
+					"key":   b64(lockKey),
+					"value": b64("locked"),
+					"lease": strconv.FormatInt(leaseID, 10),
+				},
+			}},
+		}, &out)
+		if err != nil {
+			return nil, fmt.Errorf("获取分布式锁失败: %w", err)
+		}
+		if out.Succeeded {
+			return func() {
+				if err := s.post("/v3/kv/deleterange", map[string]string{"key": b64(lockKey)}, nil); err != nil {
+					log.Printf("[EtcdTokenStore] 释放锁 %s 失败，等租约 %v 后自动过期: %v", key, s.lockTTL, err)
+				}
+			}, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return nil, fmt.Errorf("获取分布式锁 %s 超时", key)
+}
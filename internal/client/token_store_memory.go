@@ -0,0 +1,315 @@
+package client
+
+import (
+	"container/list"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"orchids-api/internal/handler/metrics"
+)
+
+// 内存后端的缓存配置
+const (
+	MaxCacheSize = 1000 // 最大缓存条目数，按 shardCount 均分给各分片（向下取整，实际总容量 31*32=992）
+
+	ttlWheelTick = 1 * time.Second
+	ttlWheelSize = 3600 // 1 小时一圈，超过一圈的 TTL 靠 wheelTask.rounds 多转几圈
+)
+
+// shardCount 是 MemoryTokenStore 的分片数；每个分片各自加锁，插入/淘汰只影响 sessionID
+// 落在的那一个分片，高并发下不再整个 store 共用一把锁
+const shardCount = 32
+
+// shardFor 用 sessionID 的 FNV-1a 哈希选分片，保证同一个 key 总落在同一个分片里
+func shardFor(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32()) % shardCount
+}
+
+// lruEntry 是分片 LRU 链表的一个节点
+type lruEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time // 零值表示永不过期
+}
+
+// lruShard 是单个分片：container/list 维护的 LRU（链表头是最近使用的），自带一把锁。
+// 命中移到链表头部、插入满了淘汰链表尾部，都是 O(1)，不用像之前那样为了找"最旧的条目"
+// 整表扫描
+type lruShard struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	index    map[string]*list.Element
+}
+
+func newLRUShard(capacity int) *lruShard {
+	return &lruShard{
+		capacity: capacity,
+		order:    list.New(),
+		index:    make(map[string]*list.Element),
+	}
+}
+
+func (s *lruShard) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.index[key]
+	if !ok {
+		return "", false
+	}
+	entry := el.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && time.Now().Add(5*time.Minute).After(entry.expiresAt) {
+		return "", false
+	}
+	s.order.MoveToFront(el)
+	return entry.value, true
+}
+
+// set 写入/覆盖一个条目；插入新 key 时分片已满，先淘汰链表尾部最久未使用的条目
+func (s *lruShard) set(key, value string, expiresAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.index[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		s.order.MoveToFront(el)
+		return
+	}
+
+	if s.order.Len() >= s.capacity {
+		s.evictOldestLocked()
+	}
+
+	el := s.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	s.index[key] = el
+}
+
+// evictOldestLocked 淘汰链表尾部（最久未使用）的条目，调用方必须已持有 s.mu
+func (s *lruShard) evictOldestLocked() {
+	oldest := s.order.Back()
+	if oldest == nil {
+		return
+	}
+	entry := oldest.Value.(*lruEntry)
+	s.order.Remove(oldest)
+	delete(s.index, entry.key)
+	metrics.RecordTokenCacheEviction()
+	log.Printf("[MemoryTokenStore] 分片已满，淘汰最久未使用的条目: %s", entry.key)
+}
+
+func (s *lruShard) delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.index[key]; ok {
+		s.order.Remove(el)
+		delete(s.index, key)
+	}
+}
+
+// removeIfExpired 只有 key 仍然存在且确实已经过期时才删除；TTLWheel 到点触发时调用，
+// 条目可能已经被 set 续期或者被 delete 过，这时什么都不用做
+func (s *lruShard) removeIfExpired(key string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.index[key]
+	if !ok {
+		return false
+	}
+	entry := el.Value.(*lruEntry)
+	if entry.expiresAt.IsZero() || !now.After(entry.expiresAt) {
+		return false
+	}
+	s.order.Remove(el)
+	delete(s.index, key)
+	return true
+}
+
+func (s *lruShard) stats(now time.Time) (total, valid int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total = s.order.Len()
+	for el := s.order.Front(); el != nil; el = el.Next() {
+		entry := el.Value.(*lruEntry)
+		if entry.expiresAt.IsZero() || now.Before(entry.expiresAt) {
+			valid++
+		}
+	}
+	return
+}
+
+// wheelTask 是 TTLWheel 一个槽位里挂的一个到期回调
+type wheelTask struct {
+	rounds int
+	fire   func()
+}
+
+// TTLWheel 是一个单层定时轮（做法上和 Netty 的 HashedWheelTimer 一致）：时间轴按 tick
+// 切成 wheelSize 个槽位，指针每 tick 走一格；TTL 超过一整圈能表示的时长时，用 rounds
+// 记录还要再转几圈才真正到期。每次 tick 只处理指针当前这一格挂的任务，开销只跟到期的
+// 条目数相关，和 store 里存了多少条目无关——这是它相对于轮询整个 map 的意义所在
+type TTLWheel struct {
+	tick time.Duration
+	size int
+
+	mu     sync.Mutex
+	slots  [][]*wheelTask
+	cursor int
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewTTLWheel 创建并启动一个定时轮；tick 是槽位粒度，size 是槽位数（tick*size 就是一圈的时长）
+func NewTTLWheel(tick time.Duration, size int) *TTLWheel {
+	w := &TTLWheel{
+		tick:   tick,
+		size:   size,
+		slots:  make([][]*wheelTask, size),
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Schedule 注册一个 delay 之后触发的回调；delay<=0 视为不需要调度，直接忽略
+func (w *TTLWheel) Schedule(delay time.Duration, fire func()) {
+	if delay <= 0 {
+		return
+	}
+	ticks := int(delay / w.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	slot := (w.cursor + ticks) % w.size
+	rounds := ticks / w.size
+	w.slots[slot] = append(w.slots[slot], &wheelTask{rounds: rounds, fire: fire})
+}
+
+func (w *TTLWheel) run() {
+	defer close(w.doneCh)
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+			w.advance()
+		}
+	}
+}
+
+func (w *TTLWheel) advance() {
+	w.mu.Lock()
+	slot := w.cursor
+	w.cursor = (w.cursor + 1) % w.size
+	tasks := w.slots[slot]
+	w.slots[slot] = nil
+
+	var due []*wheelTask
+	var remaining []*wheelTask
+	for _, t := range tasks {
+		if t.rounds > 0 {
+			t.rounds--
+			remaining = append(remaining, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	if len(remaining) > 0 {
+		w.slots[slot] = remaining
+	}
+	w.mu.Unlock()
+
+	for _, t := range due {
+		t.fire()
+	}
+}
+
+// Stop 停止定时轮的后台 goroutine
+func (w *TTLWheel) Stop() {
+	close(w.stopCh)
+	<-w.doneCh
+}
+
+// MemoryTokenStore 是 TokenStore 的单进程实现，原来 TokenCache 内置的就是这一套逻辑；
+// 多副本部署下每个实例各存各的，不做任何跨实例协调。内部按 sessionID 的哈希分成
+// shardCount 个分片，每个分片是独立加锁的 LRU；过期靠 TTLWheel 到点主动摘除，
+// 不再需要每 5 分钟扫一遍全表
+type MemoryTokenStore struct {
+	shards [shardCount]*lruShard
+	wheel  *TTLWheel
+}
+
+// NewMemoryTokenStore 创建一个空的内存存储
+func NewMemoryTokenStore() *MemoryTokenStore {
+	perShardCapacity := MaxCacheSize / shardCount
+	if perShardCapacity < 1 {
+		perShardCapacity = 1
+	}
+
+	s := &MemoryTokenStore{
+		wheel: NewTTLWheel(ttlWheelTick, ttlWheelSize),
+	}
+	for i := range s.shards {
+		s.shards[i] = newLRUShard(perShardCapacity)
+	}
+	return s
+}
+
+// Get 获取缓存的 value；提前 5 分钟过期，确保返回的 Token 仍然有足够的有效期可用
+func (s *MemoryTokenStore) Get(key string) (string, bool) {
+	return s.shards[shardFor(key)].get(key)
+}
+
+// Set 写入 value，ttl<=0 表示不过期
+func (s *MemoryTokenStore) Set(key, value string, ttl time.Duration) error {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	shard := s.shards[shardFor(key)]
+	shard.set(key, value, expiresAt)
+
+	if ttl > 0 {
+		s.wheel.Schedule(ttl, func() {
+			if shard.removeIfExpired(key, time.Now()) {
+				metrics.RecordTokenCacheEviction()
+			}
+		})
+	}
+	return nil
+}
+
+// Delete 删除 key
+func (s *MemoryTokenStore) Delete(key string) error {
+	s.shards[shardFor(key)].delete(key)
+	return nil
+}
+
+// Stats 返回条目总数和其中仍然有效的条目数
+func (s *MemoryTokenStore) Stats() (total int, valid int) {
+	now := time.Now().Add(5 * time.Minute)
+	for _, shard := range s.shards {
+		t, v := shard.stats(now)
+		total += t
+		valid += v
+	}
+	metrics.SetTokenCacheSize(total, valid)
+	return
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemoryTokenStoreGetSetDelete(t *testing.T) {
+	s := NewMemoryTokenStore()
+
+	if _, ok := s.Get("missing"); ok {
+		t.Fatal("Get on an empty store should miss")
+	}
+
+	if err := s.Set("session-1", "jwt-1", time.Hour); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if v, ok := s.Get("session-1"); !ok || v != "jwt-1" {
+		t.Fatalf("Get returned (%q, %v), want (\"jwt-1\", true)", v, ok)
+	}
+
+	if err := s.Delete("session-1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, ok := s.Get("session-1"); ok {
+		t.Fatal("Get after Delete should miss")
+	}
+}
+
+func TestMemoryTokenStoreEvictsLRUWithinShard(t *testing.T) {
+	s := NewMemoryTokenStore()
+
+	// 找一个固定分片，塞满它的容量再多塞一个，验证最久未使用的条目被淘汰而不是随便一个
+	shardIdx := 0
+	shard := s.shards[shardIdx]
+	cap := shard.capacity
+
+	keys := make([]string, 0, cap+1)
+	for i := 0; len(keys) < cap+1; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if shardFor(key) == shardIdx {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, k := range keys[:cap] {
+		if err := s.Set(k, "v", time.Hour); err != nil {
+			t.Fatalf("Set(%q) failed: %v", k, err)
+		}
+	}
+	// 访问除第一个以外的所有 key，让第一个 key 变成最久未使用的
+	for _, k := range keys[1:cap] {
+		s.Get(k)
+	}
+
+	if err := s.Set(keys[cap], "v", time.Hour); err != nil {
+		t.Fatalf("Set(%q) failed: %v", keys[cap], err)
+	}
+
+	if _, ok := s.Get(keys[0]); ok {
+		t.Errorf("least-recently-used key %q should have been evicted", keys[0])
+	}
+	if _, ok := s.Get(keys[cap]); !ok {
+		t.Errorf("newly inserted key %q should still be present", keys[cap])
+	}
+}
+
+func TestTTLWheelFiresAfterDelay(t *testing.T) {
+	w := NewTTLWheel(10*time.Millisecond, 16)
+	defer w.Stop()
+
+	fired := make(chan struct{})
+	w.Schedule(30*time.Millisecond, func() { close(fired) })
+
+	select {
+	case <-fired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("scheduled task never fired")
+	}
+}
+
+func TestMemoryTokenStoreExpiresViaTTLWheel(t *testing.T) {
+	s := NewMemoryTokenStore()
+	s.wheel.Stop()
+	s.wheel = NewTTLWheel(10*time.Millisecond, 16)
+
+	if err := s.Set("expiring", "jwt", 20*time.Millisecond); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		total, _ := s.Stats()
+		if total == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expired entry was never cleaned up by the TTL wheel")
+}
@@ -1,10 +1,23 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 )
 
+// ErrFingerprintMismatch 表示调用方提供的 fingerprint 和配置当前状态不一致，说明配置
+// 在调用方读取之后已被另一个并发的 PUT /api/config 改写过
+var ErrFingerprintMismatch = errors.New("fingerprint mismatch: config has been modified")
+
 type Config struct {
+	mu sync.RWMutex
+
 	Port         string
 	DebugEnabled bool
 	SessionID    string
@@ -17,6 +30,19 @@ type Config struct {
 	AdminUser    string
 	AdminPass    string
 	AdminPath    string
+	TLS          TLSCfg
+
+	LokiEnabled       bool
+	LokiURL           string
+	LokiServiceLabel  string
+	LokiBatchSize     int
+	LokiFlushInterval time.Duration
+
+	OTelEnabled       bool
+	OTelEndpoint      string
+	OTelServiceName   string
+	OTelBatchSize     int
+	OTelFlushInterval time.Duration
 }
 
 func Load() *Config {
@@ -33,6 +59,19 @@ func Load() *Config {
 		AdminUser:    getEnv("ADMIN_USER", "admin"),
 		AdminPass:    getEnv("ADMIN_PASS", "admin"),
 		AdminPath:    getEnv("ADMIN_PATH", "/admin"),
+		TLS:          loadTLSCfg(),
+
+		LokiEnabled:       getEnv("LOKI_ENABLED", "false") == "true",
+		LokiURL:           getEnv("LOKI_URL", ""),
+		LokiServiceLabel:  getEnv("LOKI_SERVICE_LABEL", "orchids-api"),
+		LokiBatchSize:     getEnvInt("LOKI_BATCH_SIZE", 100),
+		LokiFlushInterval: getEnvDuration("LOKI_FLUSH_INTERVAL", 5*time.Second),
+
+		OTelEnabled:       getEnv("OTEL_ENABLED", "false") == "true",
+		OTelEndpoint:      getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		OTelServiceName:   getEnv("OTEL_SERVICE_NAME", "orchids-api"),
+		OTelBatchSize:     getEnvInt("OTEL_BATCH_SIZE", 100),
+		OTelFlushInterval: getEnvDuration("OTEL_FLUSH_INTERVAL", 5*time.Second),
 	}
 }
 
@@ -47,9 +86,81 @@ func (c *Config) GetCookies() string {
 	return "__client=" + c.ClientCookie + "; __client_uat=" + c.ClientUat
 }
 
+// RuntimeEditable 是 PUT /api/config 允许运营方在不重启进程的情况下修改的字段子集
+type RuntimeEditable struct {
+	AdminUser string `json:"admin_user"`
+	AdminPass string `json:"admin_pass"`
+	AdminPath string `json:"admin_path"`
+	AgentMode string `json:"agent_mode"`
+}
+
+// snapshotLocked 是 Snapshot 的无锁版本，调用方必须已持有 c.mu（读锁或写锁均可）
+func (c *Config) snapshotLocked() RuntimeEditable {
+	return RuntimeEditable{
+		AdminUser: c.AdminUser,
+		AdminPass: c.AdminPass,
+		AdminPath: c.AdminPath,
+		AgentMode: c.AgentMode,
+	}
+}
+
+// Snapshot 取一份可运行时编辑字段的只读快照，供 GET /api/config 和 Fingerprint 使用
+func (c *Config) Snapshot() RuntimeEditable {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.snapshotLocked()
+}
+
+// Fingerprint 对可运行时编辑字段做 SHA-256，用作 PUT /api/config 乐观并发控制的版本号
+func (c *Config) Fingerprint() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return fingerprintOf(c.snapshotLocked())
+}
+
+func fingerprintOf(v RuntimeEditable) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// DoLockedAction 是 Config 的乐观并发控制 (CAS) 入口，和 store.Store.DoLockedAction 同样的
+// 用法：持有写锁时校验 fingerprint 仍然匹配，再让 cb 就地修改字段；fingerprint 为空表示
+// 调用方放弃并发检查
+func (c *Config) DoLockedAction(fingerprint string, cb func(*Config) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if fingerprint != "" && fingerprintOf(c.snapshotLocked()) != fingerprint {
+		return ErrFingerprintMismatch
+	}
+
+	return cb(c)
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// AuthType 描述管理面（/admin、/api/accounts*、/api/logs* 等）接受的认证方式
+type AuthType string
+
+const (
+	AuthTypeNone           AuthType = "none"             // 不做认证，仅用于本地调试
+	AuthTypePassword       AuthType = "password"         // 只认 HTTP Basic Auth
+	AuthTypeCert           AuthType = "cert"             // 只认已验证的客户端证书
+	AuthTypeCertOrPassword AuthType = "cert_or_password" // 两种方式任一满足即可
+)
+
+// TLSCfg 描述管理面的 mTLS 配置：CertFile/KeyFile 是服务端证书，ClientCAFile 是用来
+// 验证客户端证书的 CA bundle（通常就是 internal/pki 签发客户端证书时用的同一个 CA）
+type TLSCfg struct {
+	ListenPort   string
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	AuthType     AuthType
+	RequiredOU   string // 客户端证书必须携带的 OU，为空表示只要求证书链验证通过，不校验 OU
+}
+
+func loadTLSCfg() TLSCfg {
+	return TLSCfg{
+		ListenPort:   getEnv("ADMIN_TLS_PORT", "8443"),
+		CertFile:     getEnv("ADMIN_TLS_CERT_FILE", ""),
+		KeyFile:      getEnv("ADMIN_TLS_KEY_FILE", ""),
+		ClientCAFile: getEnv("ADMIN_TLS_CLIENT_CA_FILE", ""),
+		AuthType:     AuthType(getEnv("ADMIN_AUTH_TYPE", string(AuthTypePassword))),
+		RequiredOU:   getEnv("ADMIN_TLS_REQUIRED_OU", ""),
+	}
+}
+
+// GetTLSConfig 根据 TLSCfg 构建管理面 HTTPS 监听用的 *tls.Config；未配置服务端证书时返回
+// (nil, nil)，调用方应理解为「mTLS 监听器未启用，继续只用明文 HTTP 提供管理面」
+func (c *Config) GetTLSConfig() (*tls.Config, error) {
+	if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if c.TLS.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(c.TLS.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("failed to parse client CA bundle: %s", c.TLS.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+
+		switch c.TLS.AuthType {
+		case AuthTypeCert:
+			// 只认证书的路由在 TLS 握手阶段就拒绝没带证书的连接
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		case AuthTypeCertOrPassword:
+			// 证书或密码二选一，握手阶段不能强制要求证书，带了就验证，IsAuthenticated 里再按密码兜底
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// hasVerifiedClientCert 判断请求是否携带了一张通过 ClientCAs 验证、且 OU（如果配置了
+// RequiredOU）匹配的客户端证书
+func (c *Config) hasVerifiedClientCert(r *http.Request) bool {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return false
+	}
+	if c.TLS.RequiredOU == "" {
+		return true
+	}
+
+	leaf := r.TLS.VerifiedChains[0][0]
+	for _, ou := range leaf.Subject.OrganizationalUnit {
+		if ou == c.TLS.RequiredOU {
+			return true
+		}
+	}
+	return false
+}
+
+// hasValidBasicAuth 校验请求的 HTTP Basic Auth 凭据是否匹配当前的 AdminUser/AdminPass
+func (c *Config) hasValidBasicAuth(r *http.Request) bool {
+	user, pass, ok := r.BasicAuth()
+	return ok && user == c.AdminUser && pass == c.AdminPass
+}
+
+// IsAuthenticated 按 c.TLS.AuthType 判断请求是否已认证，取代各路由原先直接拿
+// cfg.AdminUser/cfg.AdminPass 现凑 Basic Auth 判断的写法
+func (c *Config) IsAuthenticated(r *http.Request) bool {
+	switch c.TLS.AuthType {
+	case AuthTypeNone:
+		return true
+	case AuthTypeCert:
+		return c.hasVerifiedClientCert(r)
+	case AuthTypeCertOrPassword:
+		return c.hasVerifiedClientCert(r) || c.hasValidBasicAuth(r)
+	default: // AuthTypePassword，以及未识别的取值一律按密码认证处理
+		return c.hasValidBasicAuth(r)
+	}
+}
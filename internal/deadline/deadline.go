@@ -0,0 +1,105 @@
+// Package deadline 提供按请求头声明的读超时/总超时原语，供 handler 在给上游发流式请求时
+// 检测"读不到新 chunk"和"整个请求已经超出客户端愿意等待的时间"两种情况。
+package deadline
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultAttemptTimeout 是没有通过 X-Orchids-Attempt-Timeout-Ms 指定时，单次上游尝试允许
+// 多久收不到新 SSE chunk 的上限
+const DefaultAttemptTimeout = 30 * time.Second
+
+// Timer 是一个可以被反复 Reset 的超时器：到期时 C() 返回的 channel 被关闭；Reset 会换成一个
+// 新 channel，这样调用方每次 select 都读到"从现在起"的超时信号，而不会被 Reset 之前就已经
+// 进行中的旧定时器误触发
+type Timer struct {
+	mu       sync.Mutex
+	duration time.Duration
+	timer    *time.Timer
+	cancelCh chan struct{}
+}
+
+// New 创建一个定时器并立即开始计时；duration<=0 表示不设超时，C() 永远不会被关闭
+func New(duration time.Duration) *Timer {
+	t := &Timer{duration: duration, cancelCh: make(chan struct{})}
+	if duration > 0 {
+		ch := t.cancelCh
+		t.timer = time.AfterFunc(duration, func() { t.expire(ch) })
+	}
+	return t
+}
+
+func (t *Timer) expire(ch chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ch != t.cancelCh {
+		return
+	}
+	select {
+	case <-t.cancelCh:
+	default:
+		close(t.cancelCh)
+	}
+}
+
+// Reset 重新从现在开始计时，返回这一轮对应的 cancel channel
+func (t *Timer) Reset() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.cancelCh = make(chan struct{})
+	if t.duration > 0 {
+		ch := t.cancelCh
+		t.timer = time.AfterFunc(t.duration, func() { t.expire(ch) })
+	}
+	return t.cancelCh
+}
+
+// C 返回当前这一轮的 cancel channel，配合 ctx.Done() 一起 select
+func (t *Timer) C() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cancelCh
+}
+
+// Stop 停止底层定时器，attempt 正常结束后应该调用，避免定时器在已经不需要的时候触发
+func (t *Timer) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// FromHeaders 按 X-Orchids-Timeout-Ms（整个请求，含所有重试的总预算）和
+// X-Orchids-Attempt-Timeout-Ms（单次上游尝试的读超时）解析本次请求的超时设置。
+// requestTimeout<=0 表示不设总预算上限（只受 RetryPolicy.MaxRetries 限制）；
+// attemptTimeout 缺省回退到 DefaultAttemptTimeout
+func FromHeaders(r *http.Request) (requestTimeout, attemptTimeout time.Duration) {
+	attemptTimeout = DefaultAttemptTimeout
+
+	if ms := parseMs(r.Header.Get("X-Orchids-Timeout-Ms")); ms > 0 {
+		requestTimeout = time.Duration(ms) * time.Millisecond
+	}
+	if ms := parseMs(r.Header.Get("X-Orchids-Attempt-Timeout-Ms")); ms > 0 {
+		attemptTimeout = time.Duration(ms) * time.Millisecond
+	}
+	return
+}
+
+func parseMs(raw string) int64 {
+	if raw == "" {
+		return 0
+	}
+	ms, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || ms <= 0 {
+		return 0
+	}
+	return ms
+}
@@ -15,15 +15,25 @@ import (
 	"sync"
 	"time"
 
+	"orchids-api/internal/audit"
+	"orchids-api/internal/builtintools"
 	"orchids-api/internal/client"
 	"orchids-api/internal/config"
+	"orchids-api/internal/deadline"
 	"orchids-api/internal/debug"
+	"orchids-api/internal/handler/metrics"
 	"orchids-api/internal/keeper"
 	"orchids-api/internal/loadbalancer"
 	"orchids-api/internal/logger"
+	"orchids-api/internal/modelroute"
 	"orchids-api/internal/prompt"
+	"orchids-api/internal/providers"
+	"orchids-api/internal/respcache"
 	"orchids-api/internal/store"
+	"orchids-api/internal/tenant"
 	"orchids-api/internal/tiktoken"
+	"orchids-api/internal/tools"
+	"orchids-api/internal/upstreamerr"
 )
 
 type Handler struct {
@@ -32,13 +42,59 @@ type Handler struct {
 	loadBalancer  *loadbalancer.LoadBalancer
 	keeper        *keeper.AccountKeeper
 	requestLogger *logger.RequestLogger
+	store         *store.Store
+	toolRegistry  tools.ToolRegistry
+	respCache     respcache.Supplier
+	retryPolicy   RetryPolicy
+	auditSink     audit.Sink
+	modelRoutes   *modelroute.Table
 }
 
-// 重试配置
-const (
-	MaxRetryCount  = 3                      // 最大重试次数
-	BaseRetryDelay = 100 * time.Millisecond // 基础重试延迟
-)
+// SetStore 装载账号/租户持久化层，启用按租户的预算扣减
+func (h *Handler) SetStore(s *store.Store) {
+	h.store = s
+}
+
+// SetToolRegistry 装载本地工具注册表；只有带了 X-Orchids-Local-Tools 请求头且这里非 nil
+// 时，HandleMessages 才会把注册表里的 schema 并进请求、并在上游返回 may_ 工具调用时就地执行
+func (h *Handler) SetToolRegistry(r tools.ToolRegistry) {
+	h.toolRegistry = r
+}
+
+// SetResponseCache 装载非流式响应缓存；为 nil 时 HandleMessages 完全跳过缓存查找/写入，
+// 行为与装载前一致
+func (h *Handler) SetResponseCache(c respcache.Supplier) {
+	h.respCache = c
+}
+
+// SetRetryPolicy 整体替换重试策略；不调用时 effectiveRetryPolicy 会用 DefaultRetryPolicy
+func (h *Handler) SetRetryPolicy(p RetryPolicy) {
+	h.retryPolicy = p
+}
+
+// SetAuditSink 装载账单/用量审计 Sink；为 nil 时 HandleMessages 完全跳过记录，
+// 行为与装载前一致
+func (h *Handler) SetAuditSink(s audit.Sink) {
+	h.auditSink = s
+}
+
+// SetModelRoutes 装载模型路由表；为 nil 时退回默认的 mapModel/账号自带 Provider 选择逻辑
+func (h *Handler) SetModelRoutes(t *modelroute.Table) {
+	h.modelRoutes = t
+}
+
+// effectiveRetryPolicy 返回生效的重试策略；Handler 的零值 RetryPolicy（MaxRetries 为 0）
+// 代表从未调用过 SetRetryPolicy，这时候落回默认值而不是立刻放弃重试
+func (h *Handler) effectiveRetryPolicy() RetryPolicy {
+	if h.retryPolicy.MaxRetries == 0 {
+		return DefaultRetryPolicy()
+	}
+	return h.retryPolicy
+}
+
+// AuthBlacklistDuration 账号被判定为认证失效（AuthExpired）后拉黑多久：保活服务下次刷新
+// 周期内大概率能把 token 刷新回来，这里给足够的时间窗口，避免同一个账号被连续选中反复失败
+const AuthBlacklistDuration = 10 * time.Minute
 
 // generateRequestID 生成唯一请求 ID
 func generateRequestID() string {
@@ -139,6 +195,18 @@ func mapModel(requestModel string) string {
 	return "claude-sonnet-4.5"
 }
 
+// modelDowngrade 是上游判定 ModelOverloaded 时的降级路径：先试同系列小一号的模型，换取
+// 立刻有响应，而不是在同一个过载模型上反复重试
+var modelDowngrade = map[string]string{
+	"claude-opus-4.5":   "claude-sonnet-4.5",
+	"claude-sonnet-4.5": "claude-haiku-4.5",
+}
+
+func smallerModel(model string) (string, bool) {
+	smaller, ok := modelDowngrade[model]
+	return smaller, ok
+}
+
 // fixToolInput 修复工具输入中的类型问题
 func fixToolInput(inputJSON string) string {
 	if inputJSON == "" {
@@ -199,6 +267,216 @@ func fixToolInput(inputJSON string) string {
 	return string(result)
 }
 
+// localToolResult 是本地工具执行一次 may_ 工具调用后的结果，喂回给上游之前会先经过
+// streamToolResults 以 tool_result content block 的形式流式推给客户端
+type localToolResult struct {
+	ToolUseID string
+	Content   string
+	IsError   bool
+}
+
+// reclassifyAttemptWatchdogCancellation 把每次尝试的读超时看门狗触发的 cancelAttempt()
+// 和调用方真正取消整个请求区分开。两者在 SendRequest 返回的 error 里长得一样（都是
+// context.Canceled -> upstreamerr.ContextCanceled），但调用方已经在 r.Context().Err() != nil
+// 的分支单独处理并直接返回了，能走到这里说明 r.Context() 仍然健在——ContextCanceled
+// 只可能来自本次尝试的看门狗，应该按可重试的传输错误处理（换账号重试），而不是
+// RetryPolicy.Classify 给 ContextCanceled 定的 ActionFatal，否则一次卡住的上游 SSE
+// chunk 会让整个请求直接报错退出，而不是重试/换账号
+func reclassifyAttemptWatchdogCancellation(uerr *upstreamerr.UpstreamError) *upstreamerr.UpstreamError {
+	if uerr.Class != upstreamerr.ContextCanceled {
+		return uerr
+	}
+	return &upstreamerr.UpstreamError{Class: upstreamerr.Transient, Code: "attempt_timeout", Message: uerr.Error()}
+}
+
+// classifyErrorForBloom 把一次上游请求失败归到一个粗粒度的错误类别，供失败 Bloom filter
+// 按 (account_id, upstream_error_class) 去重；分类越细，filter 的跳过判断就越精确，但这里
+// 只需要几个区分度够用的桶，不追求穷尽上游可能返回的所有错误
+func classifyErrorForBloom(err error) string {
+	if err == nil {
+		return "unknown"
+	}
+	var uerr *upstreamerr.UpstreamError
+	if errors.As(err, &uerr) {
+		switch uerr.Class {
+		case upstreamerr.RateLimited:
+			return "rate_limit"
+		case upstreamerr.AuthExpired:
+			return "auth"
+		case upstreamerr.ContextCanceled:
+			return "timeout"
+		case upstreamerr.ModelOverloaded, upstreamerr.Transient:
+			return "server_error"
+		case upstreamerr.BadRequest:
+			return "unknown"
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "timeout") || strings.Contains(msg, "deadline"):
+		return "timeout"
+	case strings.Contains(msg, "429") || strings.Contains(msg, "rate limit"):
+		return "rate_limit"
+	case strings.Contains(msg, "401") || strings.Contains(msg, "403") || strings.Contains(msg, "unauthorized"):
+		return "auth"
+	case strings.Contains(msg, "connection") || strings.Contains(msg, "reset") || strings.Contains(msg, "refused"):
+		return "connection"
+	case strings.Contains(msg, "500") || strings.Contains(msg, "502") || strings.Contains(msg, "503") || strings.Contains(msg, "504"):
+		return "server_error"
+	default:
+		return "unknown"
+	}
+}
+
+// allLocalToolUses 判断本轮上游返回的 tool_use 是否全部可以本地执行；只要有一个不是本地
+// 登记的 may_ 工具，就整体交还给客户端处理，不能只执行其中一部分
+func allLocalToolUses(toolUses []map[string]interface{}, registry tools.ToolRegistry) bool {
+	if registry == nil || len(toolUses) == 0 {
+		return false
+	}
+	for _, tu := range toolUses {
+		name, _ := tu["name"].(string)
+		if !registry.Executable(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// executeLocalTools 依次执行本轮全部 tool_use；单个工具执行失败不会中断其它工具的执行，
+// 而是作为 is_error=true 的 tool_result 喂回给模型，跟真实 Claude API 的约定一致
+func executeLocalTools(ctx context.Context, registry tools.ToolRegistry, toolUses []map[string]interface{}) []localToolResult {
+	results := make([]localToolResult, 0, len(toolUses))
+	for _, tu := range toolUses {
+		id, _ := tu["id"].(string)
+		name, _ := tu["name"].(string)
+		rawInput, _ := tu["raw_input"].(string)
+
+		output, err := registry.Execute(ctx, name, json.RawMessage(rawInput))
+		if err != nil {
+			results = append(results, localToolResult{ToolUseID: id, Content: err.Error(), IsError: true})
+			continue
+		}
+		results = append(results, localToolResult{ToolUseID: id, Content: string(output)})
+	}
+	return results
+}
+
+// appendToolRoundTrip 把本轮的 tool_use/tool_result 追加成一组 assistant/user 消息，续进
+// turnMessages 供下一轮 prompt.BuildPromptV2 使用；这个 handler 不会给上游传结构化的
+// messages 数组，而是把整个对话渲染成一段 prompt 字符串重新发送，所以每一轮工具调用都要
+// 这样追加到消息历史里，而不是依赖某个 chatHistory 参数
+func appendToolRoundTrip(messages []prompt.Message, toolUses []map[string]interface{}, results []localToolResult) []prompt.Message {
+	assistantBlocks := make([]prompt.ContentBlock, 0, len(toolUses))
+	for _, tu := range toolUses {
+		id, _ := tu["id"].(string)
+		name, _ := tu["name"].(string)
+		assistantBlocks = append(assistantBlocks, prompt.ContentBlock{
+			Type: "tool_use", ID: id, Name: name, Input: tu["input"],
+		})
+	}
+
+	userBlocks := make([]prompt.ContentBlock, 0, len(results))
+	for _, res := range results {
+		userBlocks = append(userBlocks, prompt.ContentBlock{
+			Type: "tool_result", ToolUseID: res.ToolUseID, Content: res.Content, IsError: res.IsError,
+		})
+	}
+
+	return append(messages,
+		prompt.Message{Role: "assistant", Content: prompt.MessageContent{Blocks: assistantBlocks}},
+		prompt.Message{Role: "user", Content: prompt.MessageContent{Blocks: userBlocks}},
+	)
+}
+
+// serveCachedResponse 用响应缓存里存的完整 Claude 响应对象直接应答，完全跳过账号选择和
+// 上游请求。req.Stream 为 true 时把缓存的 content blocks 重新组装成一遍合成的 SSE
+// 事件序列——对客户端来说和走一遍真实的流式请求没有区别，只是数据来自缓存
+func (h *Handler) serveCachedResponse(w http.ResponseWriter, req ClaudeRequest, cached []byte) {
+	var resp map[string]interface{}
+	if err := json.Unmarshal(cached, &resp); err != nil {
+		http.Error(w, "cached response corrupted", http.StatusInternalServerError)
+		return
+	}
+	resp["id"] = fmt.Sprintf("msg_%d", time.Now().UnixMilli())
+
+	if !req.Stream {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	write := func(event string, data interface{}) {
+		payload, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, string(payload))
+		flusher.Flush()
+	}
+
+	write("message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":      resp["id"],
+			"type":    "message",
+			"role":    "assistant",
+			"content": []interface{}{},
+			"model":   resp["model"],
+			"usage":   resp["usage"],
+		},
+	})
+
+	blocks, _ := resp["content"].([]interface{})
+	for idx, raw := range blocks {
+		block, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if blockType, _ := block["type"].(string); blockType == "text" {
+			write("content_block_start", map[string]interface{}{
+				"type":  "content_block_start",
+				"index": idx,
+				"content_block": map[string]interface{}{
+					"type": "text",
+					"text": "",
+				},
+			})
+			if text, _ := block["text"].(string); text != "" {
+				write("content_block_delta", map[string]interface{}{
+					"type":  "content_block_delta",
+					"index": idx,
+					"delta": map[string]interface{}{"type": "text_delta", "text": text},
+				})
+			}
+		} else {
+			write("content_block_start", map[string]interface{}{
+				"type":          "content_block_start",
+				"index":         idx,
+				"content_block": block,
+			})
+		}
+		write("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": idx})
+	}
+
+	usage, _ := resp["usage"].(map[string]interface{})
+	write("message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": resp["stop_reason"]},
+		"usage": map[string]interface{}{"output_tokens": usage["output_tokens"]},
+	})
+	write("message_stop", map[string]string{"type": "message_stop"})
+}
+
 func (h *Handler) HandleModels(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	data := make([]map[string]interface{}, len(AvailableModels))
@@ -265,7 +543,12 @@ func (h *Handler) HandleChatCompletions(w http.ResponseWriter, r *http.Request)
 	proxyReq.Header.Set("Content-Type", "application/json")
 
 	if openaiReq.Stream {
-		h.HandleMessages(w, proxyReq)
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		h.HandleMessages(newOpenAIStreamWriter(w, flusher, openaiReq.Model), proxyReq)
 		return
 	}
 
@@ -428,10 +711,7 @@ func convertClaudeToOpenAI(resp map[string]interface{}, model string) map[string
 		}
 	}
 
-	finishReason := "stop"
-	if stopReason == "tool_use" {
-		finishReason = "tool_calls"
-	}
+	finishReason := prompt.OpenAIFinishReason(stopReason)
 
 	message := map[string]interface{}{
 		"role":    "assistant",
@@ -470,6 +750,83 @@ func convertClaudeToOpenAI(resp map[string]interface{}, model string) map[string
 	}
 }
 
+// wantsOpenAIShape 判断客户端是不是想要 OpenAI Chat Completions 形状的响应；
+// /v1/chat/completions 走的是 HandleChatCompletions 的请求体转换，这个只覆盖客户端
+// 直接打 /v1/messages 但带了这个 Accept 头的情况
+func wantsOpenAIShape(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/vnd.openai+json")
+}
+
+// openAIStreamWriter 把写入的 Anthropic SSE 帧（event: X\ndata: Y\n\n）实时翻译成
+// OpenAI 的 chat.completion.chunk SSE 帧，直接转发给真正的客户端连接，不在内存里
+// 攒完整响应；HandleMessages 本身完全不知道输出是哪种形状，只管往这个 Writer 里写。
+// 事件到帧的翻译逻辑在 prompt.OpenAIStreamState 里，这里只管 SSE 分帧和写出
+type openAIStreamWriter struct {
+	http.ResponseWriter
+	flusher http.Flusher
+	buf     bytes.Buffer
+	state   *prompt.OpenAIStreamState
+}
+
+func newOpenAIStreamWriter(w http.ResponseWriter, flusher http.Flusher, model string) *openAIStreamWriter {
+	return &openAIStreamWriter{
+		ResponseWriter: w,
+		flusher:        flusher,
+		state:          prompt.NewOpenAIStreamState(model),
+	}
+}
+
+func (s *openAIStreamWriter) Write(p []byte) (int, error) {
+	s.buf.Write(p)
+	for {
+		data := s.buf.Bytes()
+		sep := bytes.Index(data, []byte("\n\n"))
+		if sep < 0 {
+			break
+		}
+		frame := string(data[:sep])
+		s.buf.Next(sep + 2)
+		s.translateFrame(frame)
+	}
+	return len(p), nil
+}
+
+func (s *openAIStreamWriter) Flush() {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+func (s *openAIStreamWriter) translateFrame(frame string) {
+	var event, data string
+	for _, line := range strings.Split(frame, "\n") {
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	if event == "" {
+		return
+	}
+
+	var payload map[string]interface{}
+	_ = json.Unmarshal([]byte(data), &payload)
+
+	frames, done := s.state.TranslateEvent(event, payload)
+	for _, f := range frames {
+		data, _ := json.Marshal(f)
+		fmt.Fprintf(s.ResponseWriter, "data: %s\n\n", data)
+	}
+	if done {
+		fmt.Fprint(s.ResponseWriter, "data: [DONE]\n\n")
+	}
+	if len(frames) > 0 || done {
+		s.Flush()
+	}
+}
+
 func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 	requestID := generateRequestID()
@@ -485,6 +842,28 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 解析/生成本次请求的调用链路：优先沿用上游传入的 W3C traceparent，否则新开一条 trace
+	trace, traceOK := logger.ParseTraceparent(r.Header.Get("traceparent"))
+	if !traceOK {
+		trace = logger.NewTraceContext()
+	}
+	r = r.WithContext(logger.WithTrace(r.Context(), trace))
+
+	// X-Orchids-Timeout-Ms 给整个请求（含所有重试）设一个总预算；之后所有 r.Context() 都会
+	// 带上这个 deadline，超时时重试循环会直接放弃而不是继续换账号重试
+	requestTimeout, attemptTimeout := deadline.FromHeaders(r)
+	if requestTimeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	if h.requestLogger != nil {
+		h.requestLogger.LogEvent(r.Context(), "request.start", fmt.Sprintf("model=%s stream=%v", req.Model, req.Stream), nil)
+	}
+	// 下面马上要用 logger 这个名字指代调试日志实例，提前把包级的 NewChildSpan 存成闭包变量避免遮蔽
+	newChildSpan := logger.NewChildSpan
+
 	// 初始化调试日志
 	logger := debug.New(h.config.DebugEnabled)
 	defer logger.Close()
@@ -492,7 +871,40 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 	// 1. 记录进入的 Claude 请求
 	logger.LogIncomingRequest(req)
 
-	log.Printf("[%s] 新请求进入 model=%s stream=%v", requestID, req.Model, req.Stream)
+	log.Printf("[%s] 新请求进入 model=%s stream=%v trace=%s", requestID, req.Model, req.Stream, trace.Traceparent())
+
+	mappedModel := mapModel(req.Model)
+
+	// 非流式响应缓存：在账号选择之前查找，命中就直接跳过整个上游请求。客户端带
+	// Cache-Control: no-store 时完全不查、也不写，跟浏览器语义保持一致。
+	var cacheKey string
+	if h.respCache != nil && !strings.Contains(strings.ToLower(r.Header.Get("Cache-Control")), "no-store") {
+		thinkingBudget := 0
+		if req.Thinking != nil {
+			thinkingBudget = req.Thinking.BudgetToken
+		}
+		cacheKey = respcache.Key(mappedModel, req.System, req.Messages, req.Tools, req.MaxTokens, thinkingBudget)
+		if cacheKey != "" {
+			if cached, ok, err := h.respCache.Get(r.Context(), cacheKey); err == nil && ok {
+				respcache.RecordHit(req.Model)
+				if h.requestLogger != nil {
+					h.requestLogger.LogEvent(r.Context(), "respcache.hit", fmt.Sprintf("model=%s", req.Model), nil)
+				}
+				h.serveCachedResponse(w, req, cached)
+				return
+			}
+			respcache.RecordMiss(req.Model)
+			if h.requestLogger != nil {
+				h.requestLogger.LogEvent(r.Context(), "respcache.miss", fmt.Sprintf("model=%s", req.Model), nil)
+			}
+		}
+	}
+
+	currentTenant, _ := tenant.FromContext(r.Context())
+	var pinnedTag string
+	if currentTenant != nil {
+		pinnedTag = currentTenant.PinnedTag
+	}
 
 	// 选择账号
 	var apiClient UpstreamClient
@@ -501,7 +913,15 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 
 	selectAccount := func() error {
 		if h.loadBalancer != nil {
-			account, err := h.loadBalancer.GetNextAccountExcluding(failedAccountIDs)
+			excluded := failedAccountIDs
+			account, err := h.loadBalancer.GetNextAccountExcludingForTag(pinnedTag, excluded)
+			// 账号被 keeper 拉黑（认证失效）或者还在冷却期内（被限流）时再挑一个，跳过的账号
+			// 临时并入 excluded，不影响 failedAccountIDs 记的是"这次请求实际失败过的账号"语义
+			for account != nil && err == nil && h.keeper != nil &&
+				(h.keeper.IsBlacklisted(account.ID) || h.keeper.IsCoolingDown(account.ID)) {
+				excluded = append(append([]int64{}, excluded...), account.ID)
+				account, err = h.loadBalancer.GetNextAccountExcludingForTag(pinnedTag, excluded)
+			}
 			if err != nil {
 				if h.client != nil {
 					apiClient = h.client
@@ -512,8 +932,20 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 				return err
 			}
 			log.Printf("[%s] 使用账号: %s (%s)", requestID, account.Name, account.Email)
-			apiClient = client.NewFromAccount(account)
+			apiClient = providers.NewFromAccount(account)
+			if h.modelRoutes != nil {
+				if route, ok := h.modelRoutes.Resolve(req.Model); ok {
+					log.Printf("[%s] 模型路由命中: %s -> provider=%s version=%s", requestID, req.Model, route.Provider, route.Version)
+					apiClient = providers.NewForProvider(route.Provider, account)
+				}
+			}
 			currentAccount = account
+			if h.requestLogger != nil {
+				spanCtx, _ := newChildSpan(r.Context())
+				h.requestLogger.LogEvent(spanCtx, "account.select",
+					fmt.Sprintf("account=%s email=%s", account.Name, account.Email),
+					map[string]interface{}{"account_id": account.ID})
+			}
 			return nil
 		} else if h.client != nil {
 			apiClient = h.client
@@ -535,9 +967,26 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 
 	hasCacheControl := prompt.HasCacheControl(req.System)
 
+	// X-Orchids-Local-Tools: 1 时把本地注册表里的工具 schema 并入 req.Tools；上游之后如果
+	// 只返回 may_ 前缀（本地可执行）的 tool_use，就不把 tool_use 转发给客户端，而是在下面
+	// 的循环里就地执行、把 tool_result 喂回去再请求一轮，对客户端仍然只呈现成一条消息
+	localToolsEnabled := r.Header.Get("X-Orchids-Local-Tools") == "1" && h.toolRegistry != nil
+	if localToolsEnabled {
+		req.Tools = tools.MergeSchemas(req.Tools, h.toolRegistry)
+	}
+
+	// X-Orchids-Builtin-Tools: weather,http 只往 req.Tools 里注入客户端点名要的那几个
+	// 内置工具 schema，跟上面 X-Orchids-Local-Tools（决定 may_ 开头的 tool_use 是否在本地
+	// 执行）是两码事：这里只管模型能看到哪些工具，执行与否仍然由 X-Orchids-Local-Tools 控制
+	if keysHeader := r.Header.Get("X-Orchids-Builtin-Tools"); keysHeader != "" {
+		req.Tools = append(req.Tools, builtintools.SchemasByKeys(strings.Split(keysHeader, ","))...)
+	}
+
+	turnMessages := messages
+
 	builtPrompt := prompt.BuildPromptV2(prompt.ClaudeAPIRequest{
 		Model:     req.Model,
-		Messages:  messages,
+		Messages:  turnMessages,
 		System:    req.System,
 		Tools:     req.Tools,
 		Stream:    req.Stream,
@@ -546,10 +995,13 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 
 	logger.LogConvertedPrompt(builtPrompt)
 
-	mappedModel := mapModel(req.Model)
 	log.Printf("[%s] 模型映射: %s -> %s", requestID, req.Model, mappedModel)
 
 	isStream := req.Stream
+	// openAIMode 支持客户端直接用 Accept: application/vnd.openai+json 请求 /v1/messages
+	// 按 OpenAI Chat Completions 的形状拿响应，不用单独绕去 /v1/chat/completions；
+	// HandleChatCompletions 走的是另一条路径（请求体转换），这里只负责响应形状
+	openAIMode := wantsOpenAIShape(r)
 	var flusher http.Flusher
 	if isStream {
 		w.Header().Set("Content-Type", "text/event-stream")
@@ -562,6 +1014,11 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		flusher = streamFlusher
+		if openAIMode {
+			openAIWriter := newOpenAIStreamWriter(w, flusher, req.Model)
+			w = openAIWriter
+			flusher = openAIWriter
+		}
 	} else {
 		w.Header().Set("Content-Type", "application/json")
 	}
@@ -575,8 +1032,9 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 	var responseText strings.Builder
 	var contentBlocks []map[string]interface{}
 	var currentTextIndex = -1
+	var pendingToolUses []map[string]interface{}
 
-	inputTokens := tiktoken.EstimateTextTokens(builtPrompt)
+	inputTokens := tiktoken.CountTextTokens(builtPrompt, req.Model)
 	var outputTokens int
 	var cacheCreationTokens, cacheReadTokens int
 	var outputMu sync.Mutex
@@ -589,7 +1047,7 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 		if text == "" {
 			return
 		}
-		tokens := tiktoken.EstimateTextTokens(text)
+		tokens := tiktoken.CountTextTokens(text, req.Model)
 		outputMu.Lock()
 		outputTokens += tokens
 		outputMu.Unlock()
@@ -609,6 +1067,49 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 		logger.LogOutputSSE(event, data)
 	}
 
+	// streamToolResults 把本地工具循环每一轮执行出来的 tool_result 追加到同一条 SSE 消息里，
+	// 用跟其它 content block 共享的 blockIndex 分配新的 index，客户端看到的仍然是同一条消息
+	// 在不断追加 block，而不是好几条独立的请求/响应
+	streamToolResults := func(results []localToolResult) {
+		for _, res := range results {
+			mu.Lock()
+			blockIndex++
+			idx := blockIndex
+			mu.Unlock()
+
+			startData, _ := json.Marshal(map[string]interface{}{
+				"type":  "content_block_start",
+				"index": idx,
+				"content_block": map[string]interface{}{
+					"type":        "tool_result",
+					"tool_use_id": res.ToolUseID,
+					"content":     "",
+				},
+			})
+			writeSSE("content_block_start", string(startData))
+
+			deltaData, _ := json.Marshal(map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": idx,
+				"delta": map[string]interface{}{"type": "text_delta", "text": res.Content},
+			})
+			writeSSE("content_block_delta", string(deltaData))
+			addOutputTokens(res.Content)
+
+			stopData, _ := json.Marshal(map[string]interface{}{"type": "content_block_stop", "index": idx})
+			writeSSE("content_block_stop", string(stopData))
+
+			if !isStream {
+				contentBlocks = append(contentBlocks, map[string]interface{}{
+					"type":        "tool_result",
+					"tool_use_id": res.ToolUseID,
+					"content":     res.Content,
+					"is_error":    res.IsError,
+				})
+			}
+		}
+	}
+
 	usage := map[string]int{"input_tokens": inputTokens, "output_tokens": 0}
 	if hasCacheControl {
 		usage["cache_creation_input_tokens"] = cacheCreationTokens
@@ -631,6 +1132,50 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 	done := make(chan struct{})
 	var retryCount int
 
+	// currentAccountName 返回当前正在尝试的账号名，未选中具体账号时返回 "default"；
+	// 给 metrics 这种只关心账号名、不关心完整 Account 的调用点用
+	currentAccountName := func() string {
+		if currentAccount != nil {
+			return currentAccount.Name
+		}
+		return "default"
+	}
+
+	// recordAudit 给这次请求落一条账单行（成功或失败都记），供运营方做用量/计费分析；
+	// h.auditSink 为 nil 时完全跳过，不影响现有行为
+	recordAudit := func(stopReason string, upstreamStatus int) {
+		if h.auditSink == nil {
+			return
+		}
+		accountName := "default"
+		var accountID int64
+		if currentAccount != nil {
+			accountName = currentAccount.Name
+			accountID = currentAccount.ID
+		}
+		record := audit.Record{
+			RequestID:      requestID,
+			Timestamp:      time.Now(),
+			AccountID:      accountID,
+			AccountName:    accountName,
+			Model:          req.Model,
+			InputTokens:    inputTokens,
+			OutputTokens:   outputTokens,
+			StopReason:     stopReason,
+			LatencyMs:      time.Since(startTime).Milliseconds(),
+			RetryCount:     retryCount,
+			UpstreamStatus: upstreamStatus,
+			PromptHash:     audit.HashPrompt(builtPrompt),
+		}
+		if hasCacheControl {
+			record.CacheCreationInputTokens = cacheCreationTokens
+			record.CacheReadInputTokens = cacheReadTokens
+		}
+		if err := h.auditSink.Write(record); err != nil {
+			log.Printf("[%s] 写入审计记录失败: %v", requestID, err)
+		}
+	}
+
 	// 完成响应的闭包需要移到 retryCount 声明之后
 	finishResponse := func(stopReason string) {
 		mu.Lock()
@@ -659,26 +1204,157 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[%s] 请求完成: 输入=%d tokens, 输出=%d tokens, 耗时=%v, 重试=%d",
 			requestID, inputTokens, outputTokens, time.Since(startTime), retryCount)
 
+		accountName := "default"
+		var accountID int64
+		if currentAccount != nil {
+			accountName = currentAccount.Name
+			accountID = currentAccount.ID
+		}
+
 		// 记录到实时日志系统
 		if h.requestLogger != nil {
-			accountName := "default"
-			var accountID int64
-			if currentAccount != nil {
-				accountName = currentAccount.Name
-				accountID = currentAccount.ID
+			var tenantID int64
+			if currentTenant != nil {
+				tenantID = currentTenant.ID
 			}
 			success := stopReason != "error"
 			h.requestLogger.LogRequest(requestID, accountID, accountName,
 				fmt.Sprintf("model=%s, input=%d, output=%d, retries=%d",
 					req.Model, inputTokens, outputTokens, retryCount),
-				time.Since(startTime).Milliseconds(), success)
+				time.Since(startTime).Milliseconds(), success, tenantID)
+
+			h.requestLogger.LogEvent(r.Context(), "request.summary",
+				fmt.Sprintf("stop_reason=%s retries=%d", stopReason, retryCount),
+				map[string]interface{}{
+					"input_tokens":  inputTokens,
+					"output_tokens": outputTokens,
+				})
 		}
+
+		if h.store != nil && currentTenant != nil {
+			tenant.RecordUsage(h.store, currentTenant, inputTokens+outputTokens)
+		}
+
+		metrics.RecordRequest(accountName, req.Model, "success", stopReason)
+		metrics.RecordTokens(accountName, req.Model, "input", inputTokens)
+		metrics.RecordTokens(accountName, req.Model, "output", outputTokens)
+		if hasCacheControl {
+			metrics.RecordTokens(accountName, req.Model, "cache_creation", cacheCreationTokens)
+			metrics.RecordTokens(accountName, req.Model, "cache_read", cacheReadTokens)
+		}
+		metrics.ObserveRequestDuration(accountName, req.Model, time.Since(startTime).Seconds())
+
+		recordAudit(stopReason, http.StatusOK)
+	}
+
+	// finishWithUpstreamError 取代了过去重试耗尽时一律 finishResponse("end_turn") 的做法：
+	// 流式请求这时候 message_start 早就发出去了（HTTP 状态码已经是 200），只能再插一个
+	// event: error 帧；非流式请求还没写任何响应体，可以老老实实给一个非 200 状态码
+	finishWithUpstreamError := func(uerr *upstreamerr.UpstreamError) {
+		mu.Lock()
+		if hasReturn {
+			mu.Unlock()
+			return
+		}
+		hasReturn = true
+		finalStopReason = "error"
+		mu.Unlock()
+
+		errPayload := map[string]interface{}{
+			"type":  "error",
+			"error": map[string]string{"type": string(uerr.Class), "message": uerr.Message},
+		}
+		errData, _ := json.Marshal(errPayload)
+
+		if isStream {
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", errData)
+			flusher.Flush()
+			logger.LogOutputSSE("error", string(errData))
+		} else {
+			w.WriteHeader(upstreamerr.HTTPStatus(uerr.Class))
+			_, _ = w.Write(errData)
+		}
+
+		logger.LogSummary(inputTokens, outputTokens, time.Since(startTime), "error")
+		log.Printf("[%s] 请求失败: class=%s msg=%s, 耗时=%v, 重试=%d",
+			requestID, uerr.Class, uerr.Message, time.Since(startTime), retryCount)
+
+		accountName := "default"
+		var accountID int64
+		if currentAccount != nil {
+			accountName = currentAccount.Name
+			accountID = currentAccount.ID
+		}
+
+		if h.requestLogger != nil {
+			var tenantID int64
+			if currentTenant != nil {
+				tenantID = currentTenant.ID
+			}
+			h.requestLogger.LogRequest(requestID, accountID, accountName,
+				fmt.Sprintf("model=%s, error=%s, retries=%d", req.Model, uerr.Class, retryCount),
+				time.Since(startTime).Milliseconds(), false, tenantID)
+
+			h.requestLogger.LogEvent(r.Context(), "request.summary",
+				fmt.Sprintf("stop_reason=error class=%s retries=%d", uerr.Class, retryCount),
+				map[string]interface{}{
+					"input_tokens":  inputTokens,
+					"output_tokens": outputTokens,
+				})
+		}
+
+		metrics.RecordRequest(accountName, req.Model, "error", "error")
+		metrics.RecordTokens(accountName, req.Model, "input", inputTokens)
+		metrics.RecordTokens(accountName, req.Model, "output", outputTokens)
+		metrics.ObserveRequestDuration(accountName, req.Model, time.Since(startTime).Seconds())
+
+		recordAudit("error", uerr.StatusCode)
 	}
 
-	go func() {
-		defer close(done)
-		for {
-			err := apiClient.SendRequest(r.Context(), builtPrompt, []interface{}{}, mappedModel, func(msg client.SSEMessage) {
+	const maxToolIterations = 8
+
+	for iteration := 0; ; iteration++ {
+		if iteration > 0 {
+			builtPrompt = prompt.BuildPromptV2(prompt.ClaudeAPIRequest{
+				Model:     req.Model,
+				Messages:  turnMessages,
+				System:    req.System,
+				Tools:     req.Tools,
+				Stream:    req.Stream,
+				MaxTokens: req.MaxTokens,
+			})
+			logger.LogConvertedPrompt(builtPrompt)
+			done = make(chan struct{})
+		}
+		pendingToolUses = nil
+
+		go func() {
+			defer close(done)
+		attemptLoop:
+			for {
+				attemptStart := time.Now()
+				upstreamCtx, _ := newChildSpan(r.Context())
+			if h.requestLogger != nil {
+				h.requestLogger.LogEvent(upstreamCtx, "upstream.request", fmt.Sprintf("model=%s attempt=%d", mappedModel, retryCount+1), nil)
+			}
+
+			// 每次尝试自己的读超时：收不到新 SSE chunk 就取消 attemptCtx，让 SendRequest 提前
+			// 返回错误，重试循环按原有逻辑换账号重试，而不会被一个卡死的上游连接拖住
+			attemptCtx, cancelAttempt := context.WithCancel(r.Context())
+			attemptTimer := deadline.New(attemptTimeout)
+			attemptWatchDone := make(chan struct{})
+			go func() {
+				defer close(attemptWatchDone)
+				select {
+				case <-attemptTimer.C():
+					cancelAttempt()
+				case <-attemptCtx.Done():
+				}
+			}()
+
+			err := apiClient.SendRequest(attemptCtx, builtPrompt, []interface{}{}, mappedModel, func(msg client.SSEMessage) {
+				attemptTimer.Reset()
+
 				mu.Lock()
 				if hasReturn {
 					mu.Unlock()
@@ -806,14 +1482,21 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 					if toolID == "" {
 						return
 					}
+
+					fixedInput := fixToolInput(inputStr)
+					var inputValue interface{}
+					if err := json.Unmarshal([]byte(fixedInput), &inputValue); err != nil {
+						inputValue = map[string]interface{}{}
+					}
+					mu.Lock()
+					pendingToolUses = append(pendingToolUses, map[string]interface{}{
+						"id": toolID, "name": toolName, "input": inputValue, "raw_input": fixedInput,
+					})
+					mu.Unlock()
+
 					if !isStream {
 						addOutputTokens(toolName)
 						addOutputTokens(inputStr)
-						fixedInput := fixToolInput(inputStr)
-						var inputValue interface{}
-						if err := json.Unmarshal([]byte(fixedInput), &inputValue); err != nil {
-							inputValue = map[string]interface{}{}
-						}
 						contentBlocks = append(contentBlocks, map[string]interface{}{
 							"type":  "tool_use",
 							"id":    toolID,
@@ -832,7 +1515,6 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 
 					addOutputTokens(toolName)
 					addOutputTokens(inputStr)
-					fixedInput := fixToolInput(inputStr)
 
 					// content_block_start
 					startData, _ := json.Marshal(map[string]interface{}{
@@ -875,61 +1557,204 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 							stopReason = "end_turn"
 						}
 					}
+
+					mu.Lock()
+					toolUsesSnapshot := append([]map[string]interface{}{}, pendingToolUses...)
+					mu.Unlock()
+
+					// 本轮的 tool_use 全部是本地可执行的 may_ 工具、且还没到循环上限时，不在
+					// 这里真正结束响应：只记录 stopReason，外层循环会执行工具、把结果追加进
+					// 对话历史再发起下一轮上游请求，而不是把 tool_use 转发给客户端等它执行
+					if stopReason == "tool_use" && localToolsEnabled &&
+						iteration < maxToolIterations-1 && allLocalToolUses(toolUsesSnapshot, h.toolRegistry) {
+						mu.Lock()
+						finalStopReason = stopReason
+						mu.Unlock()
+						return
+					}
+
 					finishResponse(stopReason)
 				}
 			}, logger)
 
+			attemptTimer.Stop()
+			cancelAttempt()
+			<-attemptWatchDone
+
 			if err != nil {
 				log.Printf("[%s] Error: %v", requestID, err)
+				if h.requestLogger != nil {
+					h.requestLogger.LogEvent(upstreamCtx, "upstream.response", err.Error(),
+						map[string]interface{}{"duration_ms": time.Since(attemptStart).Milliseconds(), "success": false})
+				}
+
+				// 请求整体超时（X-Orchids-Timeout-Ms）已经到期：不再重试，重试等待的时间本身
+				// 就会超出客户端愿意等待的总预算
+				if r.Context().Err() != nil {
+					log.Printf("[%s] 请求总超时已到期，放弃剩余重试", requestID)
+					finishWithUpstreamError(upstreamerr.FromError(r.Context().Err()))
+					break attemptLoop
+				}
+
+				var uerr *upstreamerr.UpstreamError
+				if !errors.As(err, &uerr) {
+					uerr = upstreamerr.FromError(err)
+				}
+
+				uerr = reclassifyAttemptWatchdogCancellation(uerr)
+
 				if currentAccount != nil && h.loadBalancer != nil {
-					// 记录失败
-					h.loadBalancer.ScheduleFailureCount(currentAccount.ID)
-					failedAccountIDs = append(failedAccountIDs, currentAccount.ID)
+					h.loadBalancer.ScheduleFailureCount(currentAccount.ID, time.Since(attemptStart), classifyErrorForBloom(err))
+				}
+
+				policy := h.effectiveRetryPolicy()
+
+				if policy.Classify(uerr) == ActionFatal {
+					// 客户端的请求本身有问题，或者调用方已经取消，换账号/重试都无济于事
+					log.Printf("[%s] 错误不可重试 (class=%s)，放弃重试直接报错", requestID, uerr.Class)
+					finishWithUpstreamError(uerr)
+					break attemptLoop
+				}
+
+				switch uerr.Class {
+				case upstreamerr.RateLimited:
+					// 限流是账号本身暂时不能用，原地等 Retry-After 之后用同一个账号重试，
+					// 而不是立刻换账号——换账号解决不了"这个账号被限流"的问题
 					retryCount++
+					metrics.RecordRetry(currentAccountName(), string(uerr.Class))
+					if retryCount >= policy.MaxRetries {
+						log.Printf("[%s] 限流重试已达上限 (%d)，放弃", requestID, policy.MaxRetries)
+						finishWithUpstreamError(uerr)
+						break attemptLoop
+					}
+					wait := policy.NextDelay(retryCount, uerr.RetryAfter)
+					if currentAccount != nil && h.keeper != nil {
+						h.keeper.MarkAccountCoolingDown(currentAccount.ID, time.Now().Add(wait))
+						metrics.SetAccountCooldownSeconds(currentAccountName(), wait.Seconds())
+					}
+					log.Printf("[%s] 被限流，等待 %v 后用同一账号重试 (%d/%d)", requestID, wait, retryCount, policy.MaxRetries)
+					select {
+					case <-time.After(wait):
+					case <-r.Context().Done():
+						finishWithUpstreamError(upstreamerr.FromError(r.Context().Err()))
+						return
+					}
+					continue attemptLoop
 
-					// 检查是否超过最大重试次数
-					if retryCount >= MaxRetryCount {
-						log.Printf("[%s] 已达到最大重试次数 (%d)，停止重试", requestID, MaxRetryCount)
-						finishResponse("end_turn")
-						break
+				case upstreamerr.AuthExpired:
+					if currentAccount != nil {
+						if h.keeper != nil {
+							h.keeper.BlacklistAccount(currentAccount.ID, AuthBlacklistDuration)
+						}
+						failedAccountIDs = append(failedAccountIDs, currentAccount.ID)
+					}
+					retryCount++
+					metrics.RecordRetry(currentAccountName(), string(uerr.Class))
+					if retryCount >= policy.MaxRetries {
+						log.Printf("[%s] 认证失效重试已达上限 (%d)，放弃", requestID, policy.MaxRetries)
+						finishWithUpstreamError(uerr)
+						break attemptLoop
+					}
+					if retryErr := selectAccount(); retryErr == nil {
+						log.Printf("[%s] 账号 %s 认证失效，已拉黑 %v，切换到账号: %s",
+							requestID, uerr.Code, AuthBlacklistDuration, currentAccount.Name)
+						continue attemptLoop
+					}
+					log.Printf("[%s] 认证失效后无更多可用账号", requestID)
+					finishWithUpstreamError(uerr)
+					break attemptLoop
+
+				case upstreamerr.ModelOverloaded:
+					// 先试试同一账号降级到小一号的模型，比立刻换账号更可能马上就有响应
+					if smaller, ok := smallerModel(mappedModel); ok {
+						log.Printf("[%s] 模型 %s 过载，原地降级到 %s 重试", requestID, mappedModel, smaller)
+						mappedModel = smaller
+						continue attemptLoop
 					}
+					fallthrough
 
-					log.Printf("[%s] 账号 %s 请求失败，尝试切换账号 (重试 %d/%d, 已排除 %d 个)",
-						requestID, currentAccount.Name, retryCount, MaxRetryCount, len(failedAccountIDs))
+				default: // Transient，以及已经降级到最小模型还过载的情况
+					if currentAccount != nil {
+						failedAccountIDs = append(failedAccountIDs, currentAccount.ID)
+					}
+					retryCount++
+					metrics.RecordRetry(currentAccountName(), string(uerr.Class))
+					if retryCount >= policy.MaxRetries {
+						log.Printf("[%s] 已达到最大重试次数 (%d)，停止重试", requestID, policy.MaxRetries)
+						finishWithUpstreamError(uerr)
+						break attemptLoop
+					}
+
+					log.Printf("[%s] 账号请求失败，尝试切换账号 (重试 %d/%d, 已排除 %d 个)",
+						requestID, retryCount, policy.MaxRetries, len(failedAccountIDs))
 
-					// 指数退避：100ms, 200ms, 400ms...
-					backoff := time.Duration(1<<(retryCount-1)) * BaseRetryDelay
+					backoff := policy.NextDelay(retryCount, 0)
 					log.Printf("[%s] 等待 %v 后重试...", requestID, backoff)
-					time.Sleep(backoff)
+
+					select {
+					case <-time.After(backoff):
+					case <-r.Context().Done():
+						log.Printf("[%s] 等待重试期间请求总超时到期，放弃重试", requestID)
+						finishWithUpstreamError(upstreamerr.FromError(r.Context().Err()))
+						return
+					}
 
 					if retryErr := selectAccount(); retryErr == nil {
 						log.Printf("[%s] 切换到账号: %s，重新发送请求", requestID, currentAccount.Name)
-						continue
-					} else {
-						log.Printf("[%s] 无更多可用账号: %v", requestID, retryErr)
+						continue attemptLoop
 					}
+					log.Printf("[%s] 无更多可用账号", requestID)
+					finishWithUpstreamError(uerr)
+					break attemptLoop
 				}
-				finishResponse("end_turn")
 			} else {
 				// 请求成功，记录成功计数并标记账号为活跃
+				if h.requestLogger != nil {
+					h.requestLogger.LogEvent(upstreamCtx, "upstream.response", "ok",
+						map[string]interface{}{"duration_ms": time.Since(attemptStart).Milliseconds(), "success": true})
+				}
 				if currentAccount != nil && h.loadBalancer != nil {
-					h.loadBalancer.ScheduleSuccessCount(currentAccount.ID)
+					h.loadBalancer.ScheduleSuccessCount(currentAccount.ID, time.Since(attemptStart))
 				}
 				if currentAccount != nil && h.keeper != nil {
 					h.keeper.MarkAccountActive(currentAccount.ID)
+					metrics.SetAccountActive(currentAccountName(), true)
+					metrics.SetAccountCooldownSeconds(currentAccountName(), 0)
 				}
 			}
 			break
 		}
-	}()
+		}()
 
-	<-done
+		<-done
+
+		mu.Lock()
+		finished := hasReturn
+		toolUsesSnapshot := append([]map[string]interface{}{}, pendingToolUses...)
+		mu.Unlock()
+
+		if finished {
+			break
+		}
+
+		if len(toolUsesSnapshot) == 0 {
+			// 上游没有发 model.finish 就断流了，没有 tool_use 可以继续执行，按 end_turn 兜底结束
+			finishResponse("end_turn")
+			break
+		}
+
+		// 本地执行本轮全部 may_ 工具调用，把 tool_result 以新的 block index 流式推给客户端，
+		// 再把 assistant(tool_use) + user(tool_result) 追加进下一轮发给上游的对话历史
+		results := executeLocalTools(r.Context(), h.toolRegistry, toolUsesSnapshot)
+		streamToolResults(results)
+		turnMessages = appendToolRoundTrip(turnMessages, toolUsesSnapshot, results)
+	}
 
 	if !hasReturn {
 		finishResponse("end_turn")
 	}
 
-	if !isStream {
+	if !isStream && finalStopReason != "error" {
 		stopReason := finalStopReason
 		if stopReason == "" {
 			stopReason = "end_turn"
@@ -961,7 +1786,23 @@ func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
 			"stop_sequence": nil,
 			"usage":         usageResp,
 		}
-		_ = json.NewEncoder(w).Encode(response)
+
+		// 写入响应缓存：即使这次是缓存未命中才走到这里的真实请求，也要把结果存下来，供后面
+		// 相同 (model, system, messages, tools, ...) 的请求直接命中
+		if h.respCache != nil && cacheKey != "" && len(contentBlocks) > 0 {
+			if cachedBody, err := json.Marshal(response); err == nil {
+				_ = h.respCache.Set(r.Context(), cacheKey, cachedBody, respcache.TTLFor(hasCacheControl))
+			}
+		}
+
+		if openAIMode {
+			raw, _ := json.Marshal(response)
+			var generic map[string]interface{}
+			_ = json.Unmarshal(raw, &generic)
+			_ = json.NewEncoder(w).Encode(convertClaudeToOpenAI(generic, req.Model))
+		} else {
+			_ = json.NewEncoder(w).Encode(response)
+		}
 	}
 	_ = finalStopReason
 }
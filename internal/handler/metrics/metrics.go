@@ -0,0 +1,191 @@
+// Package metrics 给 handler 包暴露一组 Prometheus 指标，覆盖每次请求的结果/耗时/
+// token 用量、重试原因，以及账号层面的活跃度和冷却时长，供 Grafana/Alertmanager 画图
+// 和告警（比如"5 分钟内没有账号活跃"或"429 比例过高"）
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "orchids_requests_total",
+		Help: "按账号/模型/结果状态/stop_reason 维度统计的已完成请求数",
+	}, []string{"account", "model", "status", "stop_reason"})
+
+	tokensTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "orchids_tokens_total",
+		Help: "按账号/模型/token 类型（input/output/cache_read/cache_creation）统计的 token 用量",
+	}, []string{"account", "model", "kind"})
+
+	requestDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "orchids_request_duration_seconds",
+		Help:    "请求从进入 HandleMessages 到完成响应的总耗时",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"account", "model"})
+
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "orchids_retries_total",
+		Help: "按账号/失败原因统计的重试次数",
+	}, []string{"account", "reason"})
+
+	accountActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "orchids_account_active",
+		Help: "账号最近一次成功请求后是否活跃（1=活跃），由 keeper.MarkAccountActive 驱动",
+	}, []string{"account"})
+
+	accountCooldownSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "orchids_account_cooldown_seconds",
+		Help: "账号最近一次因限流进入冷却时设置的冷却秒数，账号再次请求成功后清零表示恢复可用",
+	}, []string{"account"})
+
+	accountRefreshTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "orchids_account_refresh_total",
+		Help: "按账号/结果统计的 AccountKeeper 刷新次数",
+	}, []string{"account", "result"})
+
+	accountRefreshDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "orchids_account_refresh_duration_seconds",
+		Help:    "AccountKeeper 刷新单个账号（调用 Clerk）的耗时",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"account"})
+
+	accountHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "orchids_account_healthy",
+		Help: "账号当前是否健康（1=健康），和 AccountKeeper.GetStatus 的 IsHealthy 一致",
+	}, []string{"account"})
+
+	tokenCacheSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "orchids_token_cache_size",
+		Help: "TokenCache 当前条目数，按 state（total/valid）区分",
+	}, []string{"state"})
+
+	tokenCacheHitsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orchids_token_cache_hits_total",
+		Help: "TokenCache 命中缓存的次数",
+	})
+
+	tokenCacheMissesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orchids_token_cache_misses_total",
+		Help: "TokenCache 未命中缓存、需要实际获取 Token 的次数",
+	})
+
+	tokenCacheSingleflightSharedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orchids_token_cache_singleflight_shared_total",
+		Help: "GetOrFetch 内 singleflight.Do 命中了别的请求正在进行中的调用（合并掉的重复刷新）次数",
+	})
+
+	tokenCacheEvictionsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orchids_token_cache_evictions_total",
+		Help: "MemoryTokenStore 淘汰条目（过期清理或容量已满）的次数",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		requestsTotal,
+		tokensTotal,
+		requestDurationSeconds,
+		retriesTotal,
+		accountActive,
+		accountCooldownSeconds,
+		accountRefreshTotal,
+		accountRefreshDurationSeconds,
+		accountHealthy,
+		tokenCacheSize,
+		tokenCacheHitsTotal,
+		tokenCacheMissesTotal,
+		tokenCacheSingleflightSharedTotal,
+		tokenCacheEvictionsTotal,
+	)
+}
+
+// Handler 返回 /metrics 路由应该挂载的 http.Handler
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RecordRequest 给一次已完成的请求记一笔；status 是 "success" 或 "error"
+func RecordRequest(account, model, status, stopReason string) {
+	requestsTotal.WithLabelValues(account, model, status, stopReason).Inc()
+}
+
+// RecordTokens 给一次请求的某一类 token 用量记账；n<=0 时不记录
+func RecordTokens(account, model, kind string, n int) {
+	if n <= 0 {
+		return
+	}
+	tokensTotal.WithLabelValues(account, model, kind).Add(float64(n))
+}
+
+// ObserveRequestDuration 记录一次请求的总耗时
+func ObserveRequestDuration(account, model string, seconds float64) {
+	requestDurationSeconds.WithLabelValues(account, model).Observe(seconds)
+}
+
+// RecordRetry 记一次重试，reason 是 upstreamerr.Class 的字符串值
+func RecordRetry(account, reason string) {
+	retriesTotal.WithLabelValues(account, reason).Inc()
+}
+
+// SetAccountActive 标记账号当前是否活跃，和 keeper.MarkAccountActive 在同一个调用点触发
+func SetAccountActive(account string, active bool) {
+	value := 0.0
+	if active {
+		value = 1.0
+	}
+	accountActive.WithLabelValues(account).Set(value)
+}
+
+// SetAccountCooldownSeconds 记录账号当前冷却剩余秒数；冷却结束后调用方应该传 0 清零
+func SetAccountCooldownSeconds(account string, seconds float64) {
+	accountCooldownSeconds.WithLabelValues(account).Set(seconds)
+}
+
+// RecordAccountRefresh 给一次已完成的 AccountKeeper 刷新记一笔；result 是 "success" 或 "error"
+func RecordAccountRefresh(account, result string) {
+	accountRefreshTotal.WithLabelValues(account, result).Inc()
+}
+
+// ObserveAccountRefreshDuration 记录一次账号刷新的耗时
+func ObserveAccountRefreshDuration(account string, seconds float64) {
+	accountRefreshDurationSeconds.WithLabelValues(account).Observe(seconds)
+}
+
+// SetAccountHealthy 标记账号当前是否健康
+func SetAccountHealthy(account string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1.0
+	}
+	accountHealthy.WithLabelValues(account).Set(value)
+}
+
+// SetTokenCacheSize 记录 TokenCache 当前的条目总数和仍然有效的条目数
+func SetTokenCacheSize(total, valid int) {
+	tokenCacheSize.WithLabelValues("total").Set(float64(total))
+	tokenCacheSize.WithLabelValues("valid").Set(float64(valid))
+}
+
+// RecordTokenCacheHit 记一次缓存命中
+func RecordTokenCacheHit() {
+	tokenCacheHitsTotal.Inc()
+}
+
+// RecordTokenCacheMiss 记一次缓存未命中
+func RecordTokenCacheMiss() {
+	tokenCacheMissesTotal.Inc()
+}
+
+// RecordTokenCacheSingleflightShared 记一次 singleflight.Do 合并掉的重复刷新
+func RecordTokenCacheSingleflightShared() {
+	tokenCacheSingleflightSharedTotal.Inc()
+}
+
+// RecordTokenCacheEviction 记一次缓存条目淘汰
+func RecordTokenCacheEviction() {
+	tokenCacheEvictionsTotal.Inc()
+}
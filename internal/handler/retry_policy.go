@@ -0,0 +1,75 @@
+package handler
+
+import (
+	mathrand "math/rand/v2"
+	"time"
+
+	"orchids-api/internal/upstreamerr"
+)
+
+// RetryAction 是 RetryPolicy.Classify 给某次失败定的性质，决定重试循环要不要换账号、
+// 要不要消耗重试次数、还是直接放弃
+type RetryAction int
+
+const (
+	// ActionFatal 的错误重试没有意义（请求本身有问题，或者调用方已经取消），直接结束
+	ActionFatal RetryAction = iota
+	// ActionRetryable 值得原地重试，不需要换账号（比如被限流，换哪个账号都一样会被限）
+	ActionRetryable
+	// ActionRotateAccount 值得重试，但应该先换一个账号再试
+	ActionRotateAccount
+)
+
+// RetryPolicy 集中了退避时长和错误分类这两件事；MaxRetries/BaseDelay/MaxDelay 都留了
+// 默认值，业务方可以用 SetRetryPolicy 整体替换
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// DefaultRetryPolicy 是历史上硬编码在 handler.go 里的那组参数
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: 3,
+		BaseDelay:  100 * time.Millisecond,
+		MaxDelay:   10 * time.Second,
+	}
+}
+
+// Classify 把 upstreamerr.Class 映射到重试动作。400/422 和调用方主动取消不应该换账号
+// 浪费一次配额；限流留在原账号；其余情况换账号再试
+func (p RetryPolicy) Classify(uerr *upstreamerr.UpstreamError) RetryAction {
+	switch uerr.Class {
+	case upstreamerr.BadRequest, upstreamerr.ContextCanceled:
+		return ActionFatal
+	case upstreamerr.RateLimited:
+		return ActionRetryable
+	default:
+		return ActionRotateAccount
+	}
+}
+
+// NextDelay 返回第 attempt 次重试（从 1 开始）前应该等待的时长：先用全抖动（full jitter）
+// 算出 rand(0, min(MaxDelay, BaseDelay*2^(attempt-1)))，再用上游给的 retryAfter 兜底，
+// 取两者中较大的一个，避免抖动算出的时间比上游明确要求的还短
+func (p RetryPolicy) NextDelay(attempt int, retryAfter time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	ceiling := p.BaseDelay * time.Duration(uint64(1)<<uint(attempt-1))
+	if ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+
+	jittered := time.Duration(0)
+	if ceiling > 0 {
+		jittered = time.Duration(mathrand.Int64N(int64(ceiling) + 1))
+	}
+
+	if retryAfter > jittered {
+		return retryAfter
+	}
+	return jittered
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"testing"
+
+	"orchids-api/internal/upstreamerr"
+)
+
+func TestRetryPolicyClassifyContextCanceledIsFatal(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	uerr := &upstreamerr.UpstreamError{Class: upstreamerr.ContextCanceled}
+
+	if got := policy.Classify(uerr); got != ActionFatal {
+		t.Errorf("got %v, want ActionFatal for a genuine ContextCanceled error", got)
+	}
+}
+
+func TestReclassifyAttemptWatchdogCancellationIsRetryable(t *testing.T) {
+	uerr := &upstreamerr.UpstreamError{Class: upstreamerr.ContextCanceled, Code: "context_canceled", Message: "context canceled"}
+
+	reclassified := reclassifyAttemptWatchdogCancellation(uerr)
+	if reclassified.Class != upstreamerr.Transient {
+		t.Fatalf("got class %v, want %v", reclassified.Class, upstreamerr.Transient)
+	}
+
+	policy := DefaultRetryPolicy()
+	if got := policy.Classify(reclassified); got == ActionFatal {
+		t.Error("a reclassified attempt-watchdog cancellation should not be fatal, so the handler can rotate accounts and retry")
+	}
+}
+
+func TestReclassifyAttemptWatchdogCancellationLeavesOtherClassesUnchanged(t *testing.T) {
+	uerr := &upstreamerr.UpstreamError{Class: upstreamerr.RateLimited, Code: "rate_limited"}
+
+	if got := reclassifyAttemptWatchdogCancellation(uerr); got != uerr {
+		t.Error("non-ContextCanceled errors should be returned unchanged")
+	}
+}
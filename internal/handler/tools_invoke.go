@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+)
+
+// ToolInvokeRequest 是 POST /v1/orchids/tools/invoke 的请求体：一批已经决定好要执行的
+// tool_use，直接交给本地 ToolRegistry 跑，不经过模型往返
+type ToolInvokeRequest struct {
+	ToolUses []ToolUseInvocation `json:"tool_uses"`
+	Stream   bool                `json:"stream"`
+}
+
+type ToolUseInvocation struct {
+	ID    string      `json:"id"`
+	Name  string      `json:"name"`
+	Input interface{} `json:"input"`
+}
+
+type toolInvokeResult struct {
+	ToolUseID string `json:"tool_use_id"`
+	Content   string `json:"content"`
+	IsError   bool   `json:"is_error"`
+}
+
+const toolInvokeDeltaChunkSize = 512
+
+// HandleToolsInvoke 直接执行一批 tool_use，不需要先走一轮 /v1/messages。并发度按
+// runtime.NumCPU() 限流，跟 internal/job 里账号探活用的 worker pool 是同一个思路，
+// 避免一个请求里塞几十个 tool_use 就开几十个 goroutine 打满上游
+func (h *Handler) HandleToolsInvoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.toolRegistry == nil {
+		http.Error(w, "no tool registry configured", http.StatusInternalServerError)
+		return
+	}
+
+	var req ToolInvokeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.ToolUses) == 0 {
+		http.Error(w, "tool_uses is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.Stream {
+		h.streamToolInvocations(w, r, req.ToolUses)
+		return
+	}
+
+	results := h.runToolInvocations(r.Context(), req.ToolUses)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+}
+
+func (h *Handler) runToolInvocations(ctx context.Context, toolUses []ToolUseInvocation) []toolInvokeResult {
+	results := make([]toolInvokeResult, len(toolUses))
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+
+	for i, tu := range toolUses {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(idx int, use ToolUseInvocation) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[idx] = h.invokeOne(ctx, use)
+		}(i, tu)
+	}
+	wg.Wait()
+	return results
+}
+
+func (h *Handler) invokeOne(ctx context.Context, use ToolUseInvocation) toolInvokeResult {
+	inputBytes, err := json.Marshal(use.Input)
+	if err != nil {
+		return toolInvokeResult{ToolUseID: use.ID, Content: err.Error(), IsError: true}
+	}
+	output, err := h.toolRegistry.Execute(ctx, use.Name, inputBytes)
+	if err != nil {
+		return toolInvokeResult{ToolUseID: use.ID, Content: err.Error(), IsError: true}
+	}
+	return toolInvokeResult{ToolUseID: use.ID, Content: string(output)}
+}
+
+// streamToolInvocations 给每个 tool_use 分配一个 content_block index，执行结果按
+// input_json_delta 分块吐出来；跟 HandleMessages 里本地工具执行那段 SSE 不同，这里的
+// content_block 带 id/name 而不是 tool_use_id，delta 是 input_json_delta 而不是 text_delta。
+// 这里没有模型在回合里，纯粹是把已经执行完的结果模拟成增量流
+func (h *Handler) streamToolInvocations(w http.ResponseWriter, r *http.Request, toolUses []ToolUseInvocation) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	var mu sync.Mutex
+	write := func(event string, data interface{}) {
+		payload, _ := json.Marshal(data)
+		mu.Lock()
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, string(payload))
+		flusher.Flush()
+		mu.Unlock()
+	}
+
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+
+	for i, tu := range toolUses {
+		idx := i
+		use := tu
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			write("content_block_start", map[string]interface{}{
+				"type":  "content_block_start",
+				"index": idx,
+				"content_block": map[string]interface{}{
+					"type": "tool_result",
+					"id":   use.ID,
+					"name": use.Name,
+				},
+			})
+
+			result := h.invokeOne(r.Context(), use)
+			for _, chunk := range chunkString(result.Content, toolInvokeDeltaChunkSize) {
+				write("content_block_delta", map[string]interface{}{
+					"type":  "content_block_delta",
+					"index": idx,
+					"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": chunk},
+				})
+			}
+
+			write("content_block_stop", map[string]interface{}{
+				"type":     "content_block_stop",
+				"index":    idx,
+				"is_error": result.IsError,
+			})
+		}()
+	}
+
+	wg.Wait()
+	write("message_stop", map[string]string{"type": "message_stop"})
+}
+
+func chunkString(s string, size int) []string {
+	if s == "" {
+		return []string{""}
+	}
+	if size <= 0 {
+		size = len(s)
+	}
+	chunks := make([]string, 0, (len(s)+size-1)/size)
+	for i := 0; i < len(s); i += size {
+		end := i + size
+		if end > len(s) {
+			end = len(s)
+		}
+		chunks = append(chunks, s[i:end])
+	}
+	return chunks
+}
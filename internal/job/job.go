@@ -0,0 +1,267 @@
+// Package job 实现批量账号操作（检测/刷新）的后台任务调度：有限并发的 worker pool、
+// 可选的令牌桶限速，以及供 SSE 订阅的逐条进度上报。替代原先 HandleCheckAll 的串行循环
+// 和 HandleRefreshAll 的无进度 fire-and-forget。
+package job
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"orchids-api/internal/store"
+)
+
+// Kind 区分批量任务的类型
+type Kind string
+
+const (
+	KindCheckAll   Kind = "check_all"
+	KindRefreshAll Kind = "refresh_all"
+)
+
+// Status 任务运行状态
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+)
+
+// MaxListeners 限制单个任务的 SSE 订阅者数量，和 logger.MaxListeners 同样的考虑
+const MaxListeners = 10
+
+// Result 单个账号的处理结果，既追加进 Job.results 供轮询，也推给 SSE 订阅者
+type Result struct {
+	AccountID int64  `json:"account_id"`
+	Name      string `json:"name"`
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+}
+
+// Worker 对单个账号执行实际操作（检测或刷新），返回其结果
+type Worker func(acc *store.Account) Result
+
+// Snapshot 是 Job 当前状态的只读快照，用于 GET /api/jobs/{id} 和 SSE 的 connected 事件
+type Snapshot struct {
+	ID           string     `json:"id"`
+	Kind         Kind       `json:"kind"`
+	Status       Status     `json:"status"`
+	Total        int        `json:"total"`
+	Done         int        `json:"done"`
+	SuccessCount int        `json:"success_count"`
+	FailCount    int        `json:"fail_count"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	Results      []Result   `json:"results"`
+}
+
+// Job 一次批量 check/refresh 任务的运行状态；除创建时写入的字段外，其余字段只能
+// 在持有 mu 的情况下读写，对外一律通过 Snapshot/Subscribe 访问
+type Job struct {
+	ID        string
+	Kind      Kind
+	Total     int
+	StartedAt time.Time
+
+	mu             sync.Mutex
+	status         Status
+	done           int
+	successCount   int
+	failCount      int
+	finishedAt     time.Time
+	results        []Result
+	listeners      map[int64]chan Result
+	nextListenerID int64
+	summaryLogged  bool
+}
+
+// Manager 持有进行中和已完成的 Job；已完成的 Job 不会自动清理，调用方按需轮询其最终结果
+type Manager struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+// NewManager 创建一个空的任务管理器
+func NewManager() *Manager {
+	return &Manager{jobs: make(map[string]*Job)}
+}
+
+func randomJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "job-0"
+	}
+	return "job-" + hex.EncodeToString(b)
+}
+
+// Start 以 concurrency 个 worker、ratePerSec 的限速（<=0 表示不限速）并发处理 accounts，
+// 立即返回可查询/订阅的 Job，实际工作在后台 goroutine 里进行
+func (m *Manager) Start(kind Kind, accounts []*store.Account, concurrency int, ratePerSec float64, worker Worker) *Job {
+	if concurrency <= 0 {
+		concurrency = 5
+	}
+
+	j := &Job{
+		ID:        randomJobID(),
+		Kind:      kind,
+		Total:     len(accounts),
+		StartedAt: time.Now(),
+		status:    StatusRunning,
+		listeners: make(map[int64]chan Result),
+	}
+
+	m.mu.Lock()
+	m.jobs[j.ID] = j
+	m.mu.Unlock()
+
+	go j.run(accounts, concurrency, ratePerSec, worker)
+
+	return j
+}
+
+// Get 按 ID 查找任务
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+// run 用信号量控制并发、可选的 ticker 控制速率，逐个把 accounts 交给 worker 处理
+func (j *Job) run(accounts []*store.Account, concurrency int, ratePerSec float64, worker Worker) {
+	var limiter *time.Ticker
+	if ratePerSec > 0 {
+		limiter = time.NewTicker(time.Duration(float64(time.Second) / ratePerSec))
+		defer limiter.Stop()
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for _, acc := range accounts {
+		if limiter != nil {
+			<-limiter.C
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(account *store.Account) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			j.recordResult(worker(account))
+		}(acc)
+	}
+
+	wg.Wait()
+	j.finish()
+}
+
+func (j *Job) recordResult(r Result) {
+	j.mu.Lock()
+	j.results = append(j.results, r)
+	j.done++
+	if r.Success {
+		j.successCount++
+	} else {
+		j.failCount++
+	}
+	listeners := make([]chan Result, 0, len(j.listeners))
+	for _, ch := range j.listeners {
+		listeners = append(listeners, ch)
+	}
+	j.mu.Unlock()
+
+	for _, ch := range listeners {
+		select {
+		case ch <- r:
+		default: // 订阅者消费不过来时丢弃，轮询 Snapshot 仍能看到完整结果
+		}
+	}
+}
+
+func (j *Job) finish() {
+	j.mu.Lock()
+	j.status = StatusCompleted
+	j.finishedAt = time.Now()
+	listeners := make([]chan Result, 0, len(j.listeners))
+	for _, ch := range j.listeners {
+		listeners = append(listeners, ch)
+	}
+	j.listeners = make(map[int64]chan Result)
+	j.mu.Unlock()
+
+	for _, ch := range listeners {
+		close(ch)
+	}
+}
+
+// Subscribe 订阅这个任务的逐条结果；任务已结束也可以订阅，只是不会再收到新结果，
+// 应配合 Snapshot 读取已经产生的历史结果
+func (j *Job) Subscribe() (int64, <-chan Result) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(j.listeners) >= MaxListeners {
+		return 0, nil
+	}
+
+	j.nextListenerID++
+	id := j.nextListenerID
+	ch := make(chan Result, 32)
+	j.listeners[id] = ch
+	return id, ch
+}
+
+// Unsubscribe 取消订阅；对已结束任务的订阅者是空操作（finish 已经清空并关闭过所有 channel）
+func (j *Job) Unsubscribe(id int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if ch, ok := j.listeners[id]; ok {
+		delete(j.listeners, id)
+		close(ch)
+	}
+}
+
+// MarkSummaryLogged 标记这个任务的汇总已经写过一次日志，返回 true 当且仅当这是第一次
+// 标记成功（任务已结束且此前未标记过）；调用方（API 层的 logJobSummary）借此避免轮询和
+// SSE 的 done 事件各写一遍汇总
+func (j *Job) MarkSummaryLogged() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.status != StatusCompleted || j.summaryLogged {
+		return false
+	}
+	j.summaryLogged = true
+	return true
+}
+
+// Snapshot 取一份任务当前状态的只读快照
+func (j *Job) Snapshot() Snapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var finishedAt *time.Time
+	if !j.finishedAt.IsZero() {
+		t := j.finishedAt
+		finishedAt = &t
+	}
+
+	results := make([]Result, len(j.results))
+	copy(results, j.results)
+
+	return Snapshot{
+		ID:           j.ID,
+		Kind:         j.Kind,
+		Status:       j.status,
+		Total:        j.Total,
+		Done:         j.done,
+		SuccessCount: j.successCount,
+		FailCount:    j.failCount,
+		StartedAt:    j.StartedAt,
+		FinishedAt:   finishedAt,
+		Results:      results,
+	}
+}
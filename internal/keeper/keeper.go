@@ -1,25 +1,45 @@
 package keeper
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
 	"time"
 
 	"orchids-api/internal/clerk"
+	"orchids-api/internal/client"
+	"orchids-api/internal/handler/metrics"
+	"orchids-api/internal/logger"
 	"orchids-api/internal/store"
 )
 
+// BreakerState 是单个账号的熔断器状态：closed 正常刷新；open 期间 refreshAllAccounts
+// 直接跳过这个账号，不发请求；half_open 是冷却到期后放的那一次探测，成功就回到 closed，
+// 失败就重新 open 并拉长下一次冷却
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
 // AccountStatus 账号状态信息
 type AccountStatus struct {
-	AccountID    int64     `json:"account_id"`
-	AccountName  string    `json:"account_name"`
-	Email        string    `json:"email"`
-	LastRefresh  time.Time `json:"last_refresh"`
-	NextRefresh  time.Time `json:"next_refresh"`
-	LastError    string    `json:"last_error,omitempty"`
-	RefreshCount int       `json:"refresh_count"`
-	IsHealthy    bool      `json:"is_healthy"`
+	AccountID           int64        `json:"account_id"`
+	AccountName         string       `json:"account_name"`
+	Email               string       `json:"email"`
+	LastRefresh         time.Time    `json:"last_refresh"`
+	NextRefresh         time.Time    `json:"next_refresh"`
+	LastError           string       `json:"last_error,omitempty"`
+	RefreshCount        int          `json:"refresh_count"`
+	IsHealthy           bool         `json:"is_healthy"`
+	BreakerState        BreakerState `json:"breaker_state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	CooldownUntil       time.Time    `json:"cooldown_until,omitempty"`
 }
 
 // AccountKeeper 账号保活管理器
@@ -33,6 +53,37 @@ type AccountKeeper struct {
 	lastRefresh  map[int64]time.Time
 	lastError    map[int64]string
 	refreshCount map[int64]int
+	blacklist    map[int64]time.Time
+	coolingDown  map[int64]time.Time
+
+	// statusStore 为 nil 时刷新状态只存在本地 map，单实例部署下行为和以前完全一样；
+	// 装了之后（SetStatusStore，通常是 client.EtcdTokenStore）lastRefresh/lastError/
+	// refreshCount 改成读写这个共享后端，多个副本看到的是同一份刷新状态
+	statusStore client.TokenStore
+
+	// requestLogger 为 nil 时 refreshAccount 不产生 span，行为和以前完全一样；装了之后
+	// （SetRequestLogger）每次刷新都会记一条 account.refresh 链路事件，供 OTel 导出
+	requestLogger *logger.RequestLogger
+}
+
+// refreshStatus 是 lastRefresh/lastError/refreshCount 三个 map 对应的那份状态，序列化
+// 成 JSON 存进 statusStore，key 是 "refresh:<accountID>"
+type refreshStatus struct {
+	LastRefresh  time.Time `json:"last_refresh"`
+	LastError    string    `json:"last_error"`
+	RefreshCount int       `json:"refresh_count"`
+
+	BreakerState        BreakerState `json:"breaker_state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	CooldownUntil       time.Time    `json:"cooldown_until"`
+}
+
+// statusStoreTTL 是写进 statusStore 的刷新状态的存活时间；保活循环每 DefaultRefreshInterval
+// 就会重新写一遍，这里给得比那个间隔宽松很多，纯粹是为了避免状态永远占着 etcd 的空间
+const statusStoreTTL = 24 * time.Hour
+
+func refreshStatusKey(accountID int64) string {
+	return fmt.Sprintf("refresh:%d", accountID)
 }
 
 const (
@@ -41,6 +92,143 @@ const (
 	RefreshTimeout         = 30 * time.Second
 )
 
+// 熔断器参数：soft 失败（5xx/网络错误）连续到达 breakerFailureThreshold 次才开断路器；
+// hard 失败（401/403）和 429 不用等够次数，一次就够，因为这两类基本确定了继续刷新也是
+// 白刷。冷却时长按连续失败次数指数退避，封顶 breakerMaxCooldown
+const (
+	breakerFailureThreshold = 3
+	breakerBaseCooldown     = 1 * time.Minute
+	breakerMaxCooldown      = 30 * time.Minute
+)
+
+// failureClass 是 classifyClerkError 对一次刷新失败的分类，决定熔断器怎么反应
+type failureClass int
+
+const (
+	failureSoft failureClass = iota // 5xx、网络错误等，按连续失败次数慢慢升级
+	failureHard                     // 401/403，账号基本确定失效，直接熔断
+	failureRateLimited              // 429，优先用 Retry-After，没有的话退化成指数退避
+)
+
+// classifyClerkError 从 clerk.FetchAccountInfo 的错误里识别出失败类型；识别不出状态码
+// （比如网络超时）的一律按 soft 处理
+func classifyClerkError(err error) (failureClass, time.Duration) {
+	var httpErr *clerk.HTTPError
+	if errors.As(err, &httpErr) {
+		switch {
+		case httpErr.StatusCode == 401 || httpErr.StatusCode == 403:
+			return failureHard, 0
+		case httpErr.StatusCode == 429:
+			return failureRateLimited, httpErr.RetryAfter
+		}
+	}
+	return failureSoft, 0
+}
+
+// breakerCooldownFor 按连续失败次数算指数退避冷却时长：1m, 2m, 4m, ...，封顶 breakerMaxCooldown
+func breakerCooldownFor(consecutiveFailures int) time.Duration {
+	if consecutiveFailures < 1 {
+		consecutiveFailures = 1
+	}
+	cooldown := breakerBaseCooldown
+	for i := 1; i < consecutiveFailures && cooldown < breakerMaxCooldown; i++ {
+		cooldown *= 2
+	}
+	if cooldown > breakerMaxCooldown {
+		cooldown = breakerMaxCooldown
+	}
+	return cooldown
+}
+
+// nextBreakerState 根据这次失败的分类和当前状态算出新的熔断器状态和冷却截止时间；
+// half-open 探测失败会按失败类型重新计算冷却（而不是直接翻倍），因为探测失败本身
+// 可能是换了一种失败模式（比如账号被拉黑了而不是还在限流）
+func nextBreakerState(current BreakerState, consecutiveFailures int, class failureClass, retryAfter time.Duration) (BreakerState, time.Time) {
+	switch class {
+	case failureHard:
+		return BreakerOpen, time.Now().Add(breakerCooldownFor(consecutiveFailures))
+	case failureRateLimited:
+		cooldown := retryAfter
+		if cooldown <= 0 {
+			cooldown = breakerCooldownFor(consecutiveFailures)
+		}
+		return BreakerOpen, time.Now().Add(cooldown)
+	default:
+		if current == BreakerHalfOpen || consecutiveFailures >= breakerFailureThreshold {
+			return BreakerOpen, time.Now().Add(breakerCooldownFor(consecutiveFailures))
+		}
+		return BreakerClosed, time.Time{}
+	}
+}
+
+// refreshTokenBucket 是 refreshAllAccounts 节奏控制用的令牌桶，代替原来固定的
+// time.Sleep(100ms)：每刷新一个账号消耗一个令牌，令牌按 refillPerSec 的速度持续补充；
+// 观察到 429 时 Shrink 把补充速度砍半，避免接着触发更多限流，后续每次刷新成功再用
+// Recover 慢慢把速度加回初始值
+type refreshTokenBucket struct {
+	mu           sync.Mutex
+	tokens       float64
+	capacity     float64
+	refillPerSec float64
+	minRefill    float64
+	maxRefill    float64
+	lastRefill   time.Time
+}
+
+func newRefreshTokenBucket(refillPerSec float64) *refreshTokenBucket {
+	return &refreshTokenBucket{
+		tokens:       1,
+		capacity:     5,
+		refillPerSec: refillPerSec,
+		minRefill:    refillPerSec / 8,
+		maxRefill:    refillPerSec,
+		lastRefill:   time.Now(),
+	}
+}
+
+func (b *refreshTokenBucket) Take() {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.lastRefill).Seconds() * b.refillPerSec
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.lastRefill = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return
+		}
+		wait := time.Duration((1 - b.tokens) / b.refillPerSec * float64(time.Second))
+		b.mu.Unlock()
+
+		if wait <= 0 {
+			wait = 10 * time.Millisecond
+		}
+		time.Sleep(wait)
+	}
+}
+
+func (b *refreshTokenBucket) Shrink() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillPerSec /= 2
+	if b.refillPerSec < b.minRefill {
+		b.refillPerSec = b.minRefill
+	}
+}
+
+func (b *refreshTokenBucket) Recover() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillPerSec *= 1.1
+	if b.refillPerSec > b.maxRefill {
+		b.refillPerSec = b.maxRefill
+	}
+}
+
 // New 创建账号保活管理器
 func New(s *store.Store) *AccountKeeper {
 	return &AccountKeeper{
@@ -50,6 +238,69 @@ func New(s *store.Store) *AccountKeeper {
 		lastRefresh:     make(map[int64]time.Time),
 		lastError:       make(map[int64]string),
 		refreshCount:    make(map[int64]int),
+		blacklist:       make(map[int64]time.Time),
+		coolingDown:     make(map[int64]time.Time),
+	}
+}
+
+// SetStatusStore 装载一个共享存储后端，让刷新状态在多副本部署下保持一致；为 nil（默认）
+// 时退回进程内 map，和单实例部署行为一致
+func (k *AccountKeeper) SetStatusStore(s client.TokenStore) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.statusStore = s
+}
+
+// SetRequestLogger 装载请求日志收集器，让 refreshAccount 产生的 span 能经由它配置的
+// OTelExporter（如果有）导出；为 nil（默认）时 refreshAccount 只记 Prometheus 指标，不产生 span
+func (k *AccountKeeper) SetRequestLogger(l *logger.RequestLogger) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.requestLogger = l
+}
+
+// truncateSessionID 截断 session ID 用于日志/span 属性，避免把完整的会话标识写进 trace 后端
+func truncateSessionID(sessionID string) string {
+	if len(sessionID) < 16 {
+		return sessionID
+	}
+	return sessionID[:16] + "..."
+}
+
+// loadRefreshStatusLocked 读取某个账号当前的刷新状态；调用方必须已持有 k.mu
+func (k *AccountKeeper) loadRefreshStatusLocked(accountID int64) refreshStatus {
+	if k.statusStore == nil {
+		return refreshStatus{
+			LastRefresh:  k.lastRefresh[accountID],
+			LastError:    k.lastError[accountID],
+			RefreshCount: k.refreshCount[accountID],
+		}
+	}
+
+	raw, ok := k.statusStore.Get(refreshStatusKey(accountID))
+	if !ok {
+		return refreshStatus{}
+	}
+	var st refreshStatus
+	_ = json.Unmarshal([]byte(raw), &st)
+	return st
+}
+
+// saveRefreshStatusLocked 写回某个账号的刷新状态；调用方必须已持有 k.mu
+func (k *AccountKeeper) saveRefreshStatusLocked(accountID int64, st refreshStatus) {
+	if k.statusStore == nil {
+		k.lastRefresh[accountID] = st.LastRefresh
+		k.lastError[accountID] = st.LastError
+		k.refreshCount[accountID] = st.RefreshCount
+		return
+	}
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return
+	}
+	if err := k.statusStore.Set(refreshStatusKey(accountID), string(data), statusStoreTTL); err != nil {
+		log.Printf("[AccountKeeper] 写入共享刷新状态失败 account=%d: %v", accountID, err)
 	}
 }
 
@@ -159,6 +410,8 @@ func (k *AccountKeeper) refreshAllAccounts() {
 
 	successCount := 0
 	failCount := 0
+	skippedCount := 0
+	bucket := newRefreshTokenBucket(10) // 初始节奏等价于原来的 100ms 固定间隔
 
 	for _, acc := range accounts {
 		select {
@@ -167,40 +420,117 @@ func (k *AccountKeeper) refreshAllAccounts() {
 		default:
 		}
 
+		k.mu.RLock()
+		st := k.loadRefreshStatusLocked(acc.ID)
+		k.mu.RUnlock()
+		if st.BreakerState == BreakerOpen && time.Now().Before(st.CooldownUntil) {
+			skippedCount++
+			continue
+		}
+
+		bucket.Take()
+
 		if err := k.refreshAccount(acc); err != nil {
 			failCount++
-			// 刷新失败只记录日志，不禁用账号
+			if class, _ := classifyClerkError(err); class == failureRateLimited {
+				bucket.Shrink()
+			}
 		} else {
 			successCount++
+			bucket.Recover()
 		}
-
-		// 每个刷新之间间隔一小段时间，避免请求过快
-		time.Sleep(100 * time.Millisecond)
 	}
 
-	log.Printf("[AccountKeeper] 定时刷新完成: 成功=%d, 失败=%d", successCount, failCount)
+	log.Printf("[AccountKeeper] 定时刷新完成: 成功=%d, 失败=%d, 跳过(熔断中)=%d", successCount, failCount, skippedCount)
 }
 
-// refreshAccount 刷新单个账号的 Session
+// refreshAccount 刷新单个账号的 Session；熔断器开着且还没到冷却截止时间就直接跳过，
+// 不发请求；冷却到期后放一次探测（半开态），成功关闭熔断器，失败按失败类型重新计算冷却
 func (k *AccountKeeper) refreshAccount(acc *store.Account) error {
+	start := time.Now()
+	spanCtx, _ := logger.NewChildSpan(context.Background())
+	attrs := map[string]interface{}{
+		"account.id":        acc.ID,
+		"account.email":     acc.Email,
+		"session.id_prefix": truncateSessionID(acc.SessionID),
+	}
+
+	k.mu.RLock()
+	requestLogger := k.requestLogger
+	k.mu.RUnlock()
+	logSpan := func(result string, err error) {
+		logRefreshSpan(requestLogger, spanCtx, attrs, result, start, err)
+	}
+
+	k.mu.Lock()
+	st := k.loadRefreshStatusLocked(acc.ID)
+	if st.BreakerState == BreakerOpen {
+		if time.Now().Before(st.CooldownUntil) {
+			k.mu.Unlock()
+			logSpan("skipped", nil)
+			return fmt.Errorf("账号 %s 熔断中，冷却至 %s", acc.Name, st.CooldownUntil.Format(time.RFC3339))
+		}
+		st.BreakerState = BreakerHalfOpen
+		k.saveRefreshStatusLocked(acc.ID, st)
+	}
+	k.mu.Unlock()
+
 	info, err := clerk.FetchAccountInfo(acc.ClientCookie)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	st = k.loadRefreshStatusLocked(acc.ID)
+
 	if err != nil {
-		k.mu.Lock()
-		k.lastError[acc.ID] = err.Error()
-		k.mu.Unlock()
+		st.LastError = err.Error()
+		st.ConsecutiveFailures++
+
+		class, retryAfter := classifyClerkError(err)
+		st.BreakerState, st.CooldownUntil = nextBreakerState(st.BreakerState, st.ConsecutiveFailures, class, retryAfter)
+
+		k.saveRefreshStatusLocked(acc.ID, st)
+		metrics.RecordAccountRefresh(acc.Name, "error")
+		metrics.ObserveAccountRefreshDuration(acc.Name, time.Since(start).Seconds())
+		logSpan("error", err)
 		return fmt.Errorf("刷新账号 %s 失败: %w", acc.Name, err)
 	}
 
-	k.mu.Lock()
-	k.lastRefresh[acc.ID] = time.Now()
-	k.lastError[acc.ID] = ""
-	k.refreshCount[acc.ID]++
-	k.mu.Unlock()
+	st.LastRefresh = time.Now()
+	st.LastError = ""
+	st.RefreshCount++
+	st.ConsecutiveFailures = 0
+	st.BreakerState = BreakerClosed
+	st.CooldownUntil = time.Time{}
+	k.saveRefreshStatusLocked(acc.ID, st)
+
+	metrics.RecordAccountRefresh(acc.Name, "success")
+	metrics.ObserveAccountRefreshDuration(acc.Name, time.Since(start).Seconds())
+	logSpan("success", nil)
 
 	_ = info
 	return nil
 }
 
+// logRefreshSpan 把一次 refreshAccount 调用记成一条 account.refresh 链路事件；requestLogger
+// 为 nil 时（未调用 SetRequestLogger）整个函数是空操作，不影响刷新本身
+func logRefreshSpan(l *logger.RequestLogger, ctx context.Context, attrs map[string]interface{}, result string, start time.Time, err error) {
+	if l == nil {
+		return
+	}
+
+	spanAttrs := make(map[string]interface{}, len(attrs)+1)
+	for k, v := range attrs {
+		spanAttrs[k] = v
+	}
+	spanAttrs["duration_ms"] = time.Since(start).Milliseconds()
+
+	message := result
+	if err != nil {
+		message = fmt.Sprintf("%s: %v", result, err)
+	}
+	l.LogEvent(ctx, "account.refresh", message, spanAttrs)
+}
+
 // RefreshAccountByID 手动刷新指定账号
 func (k *AccountKeeper) RefreshAccountByID(id int64) error {
 	acc, err := k.store.GetAccount(id)
@@ -224,24 +554,28 @@ func (k *AccountKeeper) GetStatus() []AccountStatus {
 	now := time.Now()
 
 	for _, acc := range accounts {
-		lastRefresh := k.lastRefresh[acc.ID]
-		lastError := k.lastError[acc.ID]
-		refreshCount := k.refreshCount[acc.ID]
+		st := k.loadRefreshStatusLocked(acc.ID)
 
-		nextRefresh := lastRefresh.Add(k.refreshInterval)
-		if lastRefresh.IsZero() {
+		nextRefresh := st.LastRefresh.Add(k.refreshInterval)
+		if st.LastRefresh.IsZero() {
 			nextRefresh = now
 		}
 
+		healthy := st.LastError == "" && !st.LastRefresh.IsZero() && st.BreakerState != BreakerOpen
+		metrics.SetAccountHealthy(acc.Name, healthy)
+
 		statuses = append(statuses, AccountStatus{
-			AccountID:    acc.ID,
-			AccountName:  acc.Name,
-			Email:        acc.Email,
-			LastRefresh:  lastRefresh,
-			NextRefresh:  nextRefresh,
-			LastError:    lastError,
-			RefreshCount: refreshCount,
-			IsHealthy:    lastError == "" && !lastRefresh.IsZero(),
+			AccountID:           acc.ID,
+			AccountName:         acc.Name,
+			Email:               acc.Email,
+			LastRefresh:         st.LastRefresh,
+			NextRefresh:         nextRefresh,
+			LastError:           st.LastError,
+			RefreshCount:        st.RefreshCount,
+			IsHealthy:           healthy,
+			BreakerState:        st.BreakerState,
+			ConsecutiveFailures: st.ConsecutiveFailures,
+			CooldownUntil:       st.CooldownUntil,
 		})
 	}
 
@@ -271,10 +605,52 @@ func (k *AccountKeeper) MarkAccountActive(accountID int64) {
 	k.mu.Lock()
 	defer k.mu.Unlock()
 
-	if k.lastRefresh[accountID].IsZero() {
-		k.lastRefresh[accountID] = time.Now()
+	st := k.loadRefreshStatusLocked(accountID)
+	if st.LastRefresh.IsZero() {
+		st.LastRefresh = time.Now()
 	}
-	k.lastError[accountID] = ""
+	st.LastError = ""
+	st.ConsecutiveFailures = 0
+	st.BreakerState = BreakerClosed
+	st.CooldownUntil = time.Time{}
+	k.saveRefreshStatusLocked(accountID, st)
+}
+
+// BlacklistAccount 把账号拉黑 duration 时长（例如上游返回认证失效），期间 IsBlacklisted
+// 返回 true，重复调用会用新的到期时间覆盖旧的
+func (k *AccountKeeper) BlacklistAccount(accountID int64, duration time.Duration) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.blacklist[accountID] = time.Now().Add(duration)
+}
+
+// IsBlacklisted 检查账号是否还在拉黑期内；过期后自动视为未拉黑，不需要单独的清理任务
+func (k *AccountKeeper) IsBlacklisted(accountID int64) bool {
+	k.mu.RLock()
+	until, ok := k.blacklist[accountID]
+	k.mu.RUnlock()
+
+	return ok && time.Now().Before(until)
+}
+
+// MarkAccountCoolingDown 把账号标记为冷却中直到 until（例如被上游限流、收到了 Retry-After），
+// 和 BlacklistAccount 的区别是这个状态不代表账号有问题，只是暂时不该被选中；重复调用用新的
+// 到期时间覆盖旧的
+func (k *AccountKeeper) MarkAccountCoolingDown(accountID int64, until time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.coolingDown[accountID] = until
+}
+
+// IsCoolingDown 检查账号是否还在冷却期内；过期后自动视为不在冷却，不需要单独的清理任务
+func (k *AccountKeeper) IsCoolingDown(accountID int64) bool {
+	k.mu.RLock()
+	until, ok := k.coolingDown[accountID]
+	k.mu.RUnlock()
+
+	return ok && time.Now().Before(until)
 }
 
 // CleanupDeletedAccounts 清理已删除账号的状态数据
@@ -282,6 +658,23 @@ func (k *AccountKeeper) CleanupDeletedAccounts(activeIDs map[int64]bool) {
 	k.mu.Lock()
 	defer k.mu.Unlock()
 
+	for id := range k.blacklist {
+		if !activeIDs[id] {
+			delete(k.blacklist, id)
+		}
+	}
+	for id := range k.coolingDown {
+		if !activeIDs[id] {
+			delete(k.coolingDown, id)
+		}
+	}
+
+	if k.statusStore != nil {
+		// 共享存储后端没有本地 map 可以拿来枚举"已知的账号 ID"，删除账号之后对应的
+		// refreshStatus 条目只能等 statusStoreTTL 过期自然清理，不在这里主动删
+		return
+	}
+
 	for id := range k.lastRefresh {
 		if !activeIDs[id] {
 			delete(k.lastRefresh, id)
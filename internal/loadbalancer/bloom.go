@@ -0,0 +1,218 @@
+package loadbalancer
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// bloomFilter 是一个定长位数组 + 双重哈希模拟的标准 Bloom filter，sizing 公式跟
+// bloom.NewWithEstimates(n, fpr) 一致：m = ceil(-n*ln(p)/(ln2)^2)，k = round(m/n * ln2)
+type bloomFilter struct {
+	bits []uint64
+	m    uint
+	k    uint
+}
+
+func newBloomWithEstimates(n uint, fpr float64) *bloomFilter {
+	if n == 0 {
+		n = 1
+	}
+	if fpr <= 0 || fpr >= 1 {
+		fpr = 0.01
+	}
+	m := uint(math.Ceil(-float64(n) * math.Log(fpr) / (math.Ln2 * math.Ln2)))
+	if m == 0 {
+		m = 1
+	}
+	k := uint(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k == 0 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// locations 用 h1 + i*h2 的双重哈希模拟 k 个独立哈希函数，不用真的算 k 次哈希
+func (b *bloomFilter) locations(data []byte) []uint {
+	h1 := fnv.New64a()
+	h1.Write(data)
+	sum1 := h1.Sum64()
+
+	h2 := fnv.New64()
+	h2.Write(data)
+	sum2 := h2.Sum64()
+
+	locs := make([]uint, b.k)
+	for i := uint(0); i < b.k; i++ {
+		locs[i] = uint((sum1 + uint64(i)*sum2) % uint64(b.m))
+	}
+	return locs
+}
+
+func (b *bloomFilter) add(data []byte) {
+	for _, loc := range b.locations(data) {
+		b.bits[loc/64] |= 1 << (loc % 64)
+	}
+}
+
+func (b *bloomFilter) test(data []byte) bool {
+	for _, loc := range b.locations(data) {
+		if b.bits[loc/64]&(1<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// fillRatio 返回置位的位数占总位数的比例，供 /debug/lb/bloom 观察填充程度
+func (b *bloomFilter) fillRatio() float64 {
+	var set int
+	for _, word := range b.bits {
+		set += popcount(word)
+	}
+	return float64(set) / float64(b.m)
+}
+
+func popcount(x uint64) int {
+	count := 0
+	for x != 0 {
+		count++
+		x &= x - 1
+	}
+	return count
+}
+
+// BloomConfig 控制失败账号去重过滤器的大小/误判率/轮换周期，读自环境变量 LB_BLOOM_N /
+// LB_BLOOM_FPR / LB_BLOOM_ROTATE_SEC，缺省值适合中小规模的账号集群
+type BloomConfig struct {
+	N              uint
+	FPR            float64
+	RotateInterval time.Duration
+}
+
+func loadBloomConfigFromEnv() BloomConfig {
+	cfg := BloomConfig{N: 10000, FPR: 0.01, RotateInterval: 60 * time.Second}
+	if v := os.Getenv("LB_BLOOM_N"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.N = uint(n)
+		}
+	}
+	if v := os.Getenv("LB_BLOOM_FPR"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 && f < 1 {
+			cfg.FPR = f
+		}
+	}
+	if v := os.Getenv("LB_BLOOM_ROTATE_SEC"); v != "" {
+		if s, err := strconv.Atoi(v); err == nil && s > 0 {
+			cfg.RotateInterval = time.Duration(s) * time.Second
+		}
+	}
+	return cfg
+}
+
+// failureBloom 用一对轮换的 Bloom filter 跟踪集群里最近失败过的 (account_id,
+// upstream_error_class) 组合：active 接受写入，previous 只参与查询不再写入；每
+// RotateInterval 把 active 降级为 previous、原来的 previous 被丢弃、再开一个空 active，
+// 效果上相当于一个粒度为 RotateInterval 的滑动过期窗口，不需要显式删除任何条目
+type failureBloom struct {
+	mu        sync.RWMutex
+	cfg       BloomConfig
+	active    *bloomFilter
+	previous  *bloomFilter
+	rotatedAt time.Time
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+}
+
+func newFailureBloom(cfg BloomConfig) *failureBloom {
+	fb := &failureBloom{
+		cfg:       cfg,
+		active:    newBloomWithEstimates(cfg.N, cfg.FPR),
+		previous:  newBloomWithEstimates(cfg.N, cfg.FPR),
+		rotatedAt: time.Now(),
+		stopChan:  make(chan struct{}),
+	}
+	fb.wg.Add(1)
+	go fb.backgroundRotate()
+	return fb
+}
+
+func (fb *failureBloom) backgroundRotate() {
+	defer fb.wg.Done()
+	ticker := time.NewTicker(fb.cfg.RotateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-fb.stopChan:
+			return
+		case <-ticker.C:
+			fb.rotate()
+		}
+	}
+}
+
+func (fb *failureBloom) rotate() {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	fb.previous = fb.active
+	fb.active = newBloomWithEstimates(fb.cfg.N, fb.cfg.FPR)
+	fb.rotatedAt = time.Now()
+}
+
+func (fb *failureBloom) stop() {
+	close(fb.stopChan)
+	fb.wg.Wait()
+}
+
+func failureKey(accountID int64, errorClass string) []byte {
+	buf := make([]byte, 8, 8+len(errorClass))
+	binary.BigEndian.PutUint64(buf, uint64(accountID))
+	return append(buf, []byte(errorClass)...)
+}
+
+// wildcardKey 不区分 errorClass，供 probablyFailed 在只想知道"这个账号最近是不是大概率坏了"
+// 时使用，不需要先知道具体的错误分类
+func wildcardKey(accountID int64) []byte {
+	return failureKey(accountID, "*")
+}
+
+// markFailed 把 (accountID, errorClass) 记录进当前窗口，同时写一份通配符 key
+func (fb *failureBloom) markFailed(accountID int64, errorClass string) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	fb.active.add(failureKey(accountID, errorClass))
+	fb.active.add(wildcardKey(accountID))
+}
+
+// probablyFailed 判断某个账号在最近两个轮换窗口内是否大概率失败过；可能有假阳性（多跳过
+// 一个其实健康的账号），不存在假阴性，所以只当作 GetNextAccount 的一个优化，不是强一致的
+// 熔断判断——真正的熔断仍然由 selector 负责
+func (fb *failureBloom) probablyFailed(accountID int64) bool {
+	fb.mu.RLock()
+	defer fb.mu.RUnlock()
+	key := wildcardKey(accountID)
+	return fb.active.test(key) || fb.previous.test(key)
+}
+
+// BloomStats 是 /debug/lb/bloom 展示的快照
+type BloomStats struct {
+	ActiveFillRatio   float64 `json:"active_fill_ratio"`
+	PreviousFillRatio float64 `json:"previous_fill_ratio"`
+	RotationAgeMs     int64   `json:"rotation_age_ms"`
+	RotateIntervalMs  int64   `json:"rotate_interval_ms"`
+}
+
+func (fb *failureBloom) stats() BloomStats {
+	fb.mu.RLock()
+	defer fb.mu.RUnlock()
+	return BloomStats{
+		ActiveFillRatio:   fb.active.fillRatio(),
+		PreviousFillRatio: fb.previous.fillRatio(),
+		RotationAgeMs:     time.Since(fb.rotatedAt).Milliseconds(),
+		RotateIntervalMs:  fb.cfg.RotateInterval.Milliseconds(),
+	}
+}
@@ -0,0 +1,58 @@
+package loadbalancer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBloomFilterNoFalseNegatives(t *testing.T) {
+	b := newBloomWithEstimates(1000, 0.01)
+
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("c"), failureKey(42, "auth")}
+	for _, k := range keys {
+		b.add(k)
+	}
+	for _, k := range keys {
+		if !b.test(k) {
+			t.Errorf("bloom filter reported false negative for key %q", k)
+		}
+	}
+	if b.test([]byte("never-added")) {
+		t.Log("false positive for an unrelated key (allowed, bloom filters are probabilistic)")
+	}
+}
+
+func TestFailureBloomMarkAndProbablyFailed(t *testing.T) {
+	fb := newFailureBloom(BloomConfig{N: 1000, FPR: 0.01, RotateInterval: time.Hour})
+	defer fb.stop()
+
+	if fb.probablyFailed(7) {
+		t.Fatal("account 7 should not be marked failed before markFailed is called")
+	}
+
+	fb.markFailed(7, "auth_error")
+
+	if !fb.probablyFailed(7) {
+		t.Error("account 7 should be reported as probably failed after markFailed")
+	}
+	if fb.probablyFailed(8) {
+		t.Log("unrelated account reported as probably failed (allowed false positive)")
+	}
+}
+
+func TestFailureBloomRotateDropsOldEntriesEventually(t *testing.T) {
+	fb := newFailureBloom(BloomConfig{N: 1000, FPR: 0.01, RotateInterval: time.Hour})
+	defer fb.stop()
+
+	fb.markFailed(9, "rate_limit")
+	if !fb.probablyFailed(9) {
+		t.Fatal("account 9 should be probably failed right after markFailed")
+	}
+
+	// 连续两次 rotate 之后，标记应该彻底滚出 active+previous 两个窗口
+	fb.rotate()
+	fb.rotate()
+	if fb.probablyFailed(9) {
+		t.Error("account 9 should no longer be probably failed after two rotations")
+	}
+}
@@ -1,6 +1,7 @@
 package loadbalancer
 
 import (
+	"context"
 	"errors"
 	"log"
 	"math/rand"
@@ -8,50 +9,47 @@ import (
 	"sync"
 	"time"
 
+	"orchids-api/internal/selector"
 	"orchids-api/internal/store"
 )
 
 // 账号缓存刷新间隔（从 5 秒改为 30 秒）
 const accountsCacheTTL = 30 * time.Second
 
-// 请求计数批量更新间隔（从 5 秒改为 10 秒）
-const countUpdateInterval = 10 * time.Second
-
 type LoadBalancer struct {
-	store *store.Store
+	store    *store.Store
+	selector *selector.Selector
 
 	// 账号缓存
 	accounts    []*store.Account
 	accountsMu  sync.RWMutex
 	lastRefresh time.Time
 
-	// 异步请求计数更新
-	pendingUpdates  map[int64]int64
-	pendingSuccess  map[int64]int64
-	pendingFailure  map[int64]int64
-	updateMu        sync.Mutex
-	stopChan        chan struct{}
-	wg              sync.WaitGroup
+	// failures 是跨副本共享语义的失败账号 Bloom filter（目前仍是单进程内的近似去重，
+	// 真正跨分片共享需要后续把 markFailed/probablyFailed 接到一个外部存储，但接口已经
+	// 按"可能有其它副本也在标记同一个账号"的假设设计）
+	failures *failureBloom
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
 }
 
 func New(s *store.Store) *LoadBalancer {
 	lb := &LoadBalancer{
-		store:          s,
-		pendingUpdates: make(map[int64]int64),
-		pendingSuccess: make(map[int64]int64),
-		pendingFailure: make(map[int64]int64),
-		stopChan:       make(chan struct{}),
+		store:    s,
+		selector: selector.New(s),
+		failures: newFailureBloom(loadBloomConfigFromEnv()),
+		stopChan: make(chan struct{}),
 	}
 
 	// 立即加载账号列表
 	lb.refreshAccounts()
 
 	// 启动后台任务
-	lb.wg.Add(2)
+	lb.wg.Add(1)
 	go lb.backgroundRefreshAccounts()
-	go lb.backgroundUpdateCounts()
 
-	log.Println("[LoadBalancer] 已启动，账号缓存TTL=", accountsCacheTTL, ", 计数更新间隔=", countUpdateInterval)
+	log.Println("[LoadBalancer] 已启动，账号缓存TTL=", accountsCacheTTL)
 
 	return lb
 }
@@ -60,8 +58,9 @@ func New(s *store.Store) *LoadBalancer {
 func (lb *LoadBalancer) Close() {
 	close(lb.stopChan)
 	lb.wg.Wait()
-	// 最后一次刷新计数
-	lb.flushPendingUpdates()
+	lb.failures.stop()
+	// 最后一次刷新计数聚合器
+	lb.store.FlushCounters(context.Background())
 	log.Println("[LoadBalancer] 已关闭")
 }
 
@@ -97,78 +96,40 @@ func (lb *LoadBalancer) backgroundRefreshAccounts() {
 	}
 }
 
-// backgroundUpdateCounts 后台批量更新请求计数
-func (lb *LoadBalancer) backgroundUpdateCounts() {
-	defer lb.wg.Done()
-	ticker := time.NewTicker(countUpdateInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-lb.stopChan:
-			return
-		case <-ticker.C:
-			lb.flushPendingUpdates()
-		}
-	}
+// scheduleCountUpdate 调度请求计数更新（异步，经由 store.CounterAggregator 写behind批处理）
+func (lb *LoadBalancer) scheduleCountUpdate(accountID int64) {
+	lb.store.BumpRequest(accountID)
 }
 
-// flushPendingUpdates 将待更新的请求计数写入数据库
-func (lb *LoadBalancer) flushPendingUpdates() {
-	lb.updateMu.Lock()
-	if len(lb.pendingUpdates) == 0 && len(lb.pendingSuccess) == 0 && len(lb.pendingFailure) == 0 {
-		lb.updateMu.Unlock()
-		return
-	}
-	updates := lb.pendingUpdates
-	successUpdates := lb.pendingSuccess
-	failureUpdates := lb.pendingFailure
-	lb.pendingUpdates = make(map[int64]int64)
-	lb.pendingSuccess = make(map[int64]int64)
-	lb.pendingFailure = make(map[int64]int64)
-	lb.updateMu.Unlock()
-
-	// 更新请求计数
-	for accountID, count := range updates {
-		if err := lb.store.AddRequestCount(accountID, count); err != nil {
-			log.Printf("[LoadBalancer] 更新请求计数失败: accountID=%d, count=%d, err=%v", accountID, count, err)
-		}
-	}
-
-	// 更新成功计数
-	for accountID, count := range successUpdates {
-		if err := lb.store.AddSuccessCount(accountID, count); err != nil {
-			log.Printf("[LoadBalancer] 更新成功计数失败: accountID=%d, count=%d, err=%v", accountID, count, err)
-		}
-	}
+// ScheduleSuccessCount 调度成功计数更新（异步），同时把本次请求耗时反馈给选择器
+// 用于更新延迟/成功率 EWMA 及熔断状态
+func (lb *LoadBalancer) ScheduleSuccessCount(accountID int64, latency time.Duration) {
+	lb.store.BumpSuccess(accountID)
+	lb.selector.Report(accountID, selector.OutcomeSuccess, latency)
+}
 
-	// 更新失败计数
-	for accountID, count := range failureUpdates {
-		if err := lb.store.AddFailureCount(accountID, count); err != nil {
-			log.Printf("[LoadBalancer] 更新失败计数失败: accountID=%d, count=%d, err=%v", accountID, count, err)
-		}
-	}
+// ScheduleFailureCount 调度失败计数更新（异步），同时把本次请求耗时反馈给选择器
+// 用于更新延迟/成功率 EWMA 及熔断状态；errorClass 标识这次失败的上游错误类型
+// （如 "timeout"、"server_error"、"rate_limit"），一并记进失败 Bloom filter 供快速跳过用
+func (lb *LoadBalancer) ScheduleFailureCount(accountID int64, latency time.Duration, errorClass string) {
+	lb.store.BumpFailure(accountID)
+	lb.selector.Report(accountID, selector.OutcomeFailure, latency)
+	lb.failures.markFailed(accountID, errorClass)
 }
 
-// scheduleCountUpdate 调度请求计数更新（异步）
-func (lb *LoadBalancer) scheduleCountUpdate(accountID int64) {
-	lb.updateMu.Lock()
-	lb.pendingUpdates[accountID]++
-	lb.updateMu.Unlock()
+// BloomStats 返回失败账号去重过滤器当前的填充率/轮换状态，供调试端点展示
+func (lb *LoadBalancer) BloomStats() BloomStats {
+	return lb.failures.stats()
 }
 
-// ScheduleSuccessCount 调度成功计数更新（异步）
-func (lb *LoadBalancer) ScheduleSuccessCount(accountID int64) {
-	lb.updateMu.Lock()
-	lb.pendingSuccess[accountID]++
-	lb.updateMu.Unlock()
+// SelectorStatus 返回选择器当前维护的熔断状态快照，供状态展示端点使用
+func (lb *LoadBalancer) SelectorStatus() []selector.Status {
+	return lb.selector.StatusList()
 }
 
-// ScheduleFailureCount 调度失败计数更新（异步）
-func (lb *LoadBalancer) ScheduleFailureCount(accountID int64) {
-	lb.updateMu.Lock()
-	lb.pendingFailure[accountID]++
-	lb.updateMu.Unlock()
+// Selector 返回负载均衡器内部使用的账号选择器，供 API 层直接复用同一份熔断状态
+func (lb *LoadBalancer) Selector() *selector.Selector {
+	return lb.selector
 }
 
 // getCachedAccounts 获取缓存的账号列表（如果缓存过期则刷新）
@@ -194,9 +155,25 @@ func (lb *LoadBalancer) GetNextAccount() (*store.Account, error) {
 }
 
 func (lb *LoadBalancer) GetNextAccountExcluding(excludeIDs []int64) (*store.Account, error) {
+	return lb.GetNextAccountExcludingForTag("", excludeIDs)
+}
+
+// GetNextAccountExcludingForTag 与 GetNextAccountExcluding 相同，但只在带有指定 tag 的
+// 账号中选择；tag 为空时等价于 GetNextAccountExcluding，用于租户的账号池隔离（PinnedTag）
+func (lb *LoadBalancer) GetNextAccountExcludingForTag(tag string, excludeIDs []int64) (*store.Account, error) {
 	// 从缓存获取账号列表（无锁读取）
 	accounts := lb.getCachedAccounts()
 
+	if tag != "" {
+		var tagged []*store.Account
+		for _, acc := range accounts {
+			if acc.Tag == tag {
+				tagged = append(tagged, acc)
+			}
+		}
+		accounts = tagged
+	}
+
 	// 过滤排除的账号
 	if len(excludeIDs) > 0 {
 		excludeSet := make(map[int64]bool)
@@ -216,8 +193,18 @@ func (lb *LoadBalancer) GetNextAccountExcluding(excludeIDs []int64) (*store.Acco
 		return nil, errors.New("no enabled accounts available")
 	}
 
-	// 选择账号
-	account := lb.selectAccount(accounts)
+	// 用失败 Bloom filter 先快速跳过最近大概率失败过的账号；可能有假阳性，所以只在
+	// 跳过之后候选集仍然非空时才采用过滤结果，否则宁可回退到完整列表也不让请求无账号可选
+	if filtered := lb.filterProbablyFailed(accounts); len(filtered) > 0 {
+		accounts = filtered
+	}
+
+	// 优先使用熔断感知的选择器；账号全部熔断时退化为普通加权随机
+	account, err := lb.selector.Pick(accounts)
+	if err != nil {
+		log.Printf("[LoadBalancer] 选择器无可用账号，退化为加权随机: %v", err)
+		account = lb.selectAccount(accounts)
+	}
 
 	// 异步更新请求计数（不阻塞请求处理）
 	lb.scheduleCountUpdate(account.ID)
@@ -225,6 +212,17 @@ func (lb *LoadBalancer) GetNextAccountExcluding(excludeIDs []int64) (*store.Acco
 	return account, nil
 }
 
+// filterProbablyFailed 剔除 Bloom filter 判定为最近失败过的账号
+func (lb *LoadBalancer) filterProbablyFailed(accounts []*store.Account) []*store.Account {
+	var filtered []*store.Account
+	for _, acc := range accounts {
+		if !lb.failures.probablyFailed(acc.ID) {
+			filtered = append(filtered, acc)
+		}
+	}
+	return filtered
+}
+
 // selectAccount 使用前缀和 + 二分查找选择账号（O(log n)）
 func (lb *LoadBalancer) selectAccount(accounts []*store.Account) *store.Account {
 	if len(accounts) == 1 {
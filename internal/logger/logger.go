@@ -1,7 +1,9 @@
 package logger
 
 import (
+	"context"
 	"encoding/json"
+	"log"
 	"sync"
 	"time"
 )
@@ -14,9 +16,18 @@ type LogEntry struct {
 	RequestID string    `json:"request_id,omitempty"`
 	AccountID int64     `json:"account_id,omitempty"`
 	Account   string    `json:"account,omitempty"`
+	TenantID  int64     `json:"tenant_id,omitempty"`
 	Message   string    `json:"message"`
 	Duration  int64     `json:"duration_ms,omitempty"`
 	Success   bool      `json:"success,omitempty"`
+
+	// 以下字段让一条日志成为一次调用链路里的一个 span，串起账号选择、上游请求、
+	// SSE 转发等跨 logger/debug/loadbalancer 包的阶段（见 TraceContext）
+	Event        string                 `json:"event,omitempty"`
+	TraceID      string                 `json:"trace_id,omitempty"`
+	SpanID       string                 `json:"span_id,omitempty"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Attrs        map[string]interface{} `json:"attrs,omitempty"`
 }
 
 // RequestLogger 请求日志收集器
@@ -30,6 +41,10 @@ type RequestLogger struct {
 	listeners      map[int64]chan LogEntry
 	listenerMu     sync.Mutex
 	nextListenerID int64
+
+	store Store          // 可选的持久化后端，nil 时仅保留内存环形缓冲区
+	loki  *LokiForwarder // 可选的 Loki 推送转发器
+	otel  *OTelExporter  // 可选的 OpenTelemetry OTLP/HTTP 导出器
 }
 
 const (
@@ -37,7 +52,7 @@ const (
 	MaxListeners   = 10  // 最多 10 个监听者
 )
 
-// New 创建日志收集器
+// New 创建日志收集器（仅内存环形缓冲区，不做持久化）
 func New() *RequestLogger {
 	return &RequestLogger{
 		logs:      make([]LogEntry, DefaultMaxSize),
@@ -46,6 +61,22 @@ func New() *RequestLogger {
 	}
 }
 
+// SetStore 装载持久化后端；装载后 Log() 会在写入内存环形缓冲区的同时落盘
+func (l *RequestLogger) SetStore(store Store) {
+	l.store = store
+}
+
+// SetLokiForwarder 装载 Loki 推送转发器；装载后 Log() 会把每条日志异步推送给 Loki
+func (l *RequestLogger) SetLokiForwarder(forwarder *LokiForwarder) {
+	l.loki = forwarder
+}
+
+// SetOTelExporter 装载 OpenTelemetry OTLP/HTTP 导出器；装载后 Log() 会把带 TraceID 的
+// 条目异步转换成 span 推送给 Jaeger/Tempo 等后端
+func (l *RequestLogger) SetOTelExporter(exporter *OTelExporter) {
+	l.otel = exporter
+}
+
 // Log 记录日志
 func (l *RequestLogger) Log(entry LogEntry) {
 	l.mu.Lock()
@@ -72,10 +103,39 @@ func (l *RequestLogger) Log(entry LogEntry) {
 		}
 	}
 	l.listenerMu.Unlock()
+
+	if l.store != nil {
+		if err := l.store.Write(entry); err != nil {
+			log.Printf("[RequestLogger] 持久化日志失败: %v", err)
+		}
+	}
+
+	if l.loki != nil {
+		l.loki.Enqueue(entry)
+	}
+
+	if l.otel != nil && entry.TraceID != "" {
+		l.otel.Enqueue(entry)
+	}
+}
+
+// LogEvent 记录一条结构化的链路日志：从 ctx 里取出 NewChildSpan 生成的 TraceContext，
+// 把 event/attrs 和 span 信息一并落入 LogEntry，用于重建一次请求的完整生命周期
+func (l *RequestLogger) LogEvent(ctx context.Context, event, message string, attrs map[string]interface{}) {
+	t, _ := TraceFromContext(ctx)
+	l.Log(LogEntry{
+		Level:        "info",
+		Event:        event,
+		Message:      message,
+		TraceID:      t.TraceID,
+		SpanID:       t.SpanID,
+		ParentSpanID: t.ParentSpanID,
+		Attrs:        attrs,
+	})
 }
 
-// LogRequest 记录请求日志（简化接口）
-func (l *RequestLogger) LogRequest(requestID string, accountID int64, accountName, message string, durationMs int64, success bool) {
+// LogRequest 记录请求日志（简化接口）；tenantID 为 0 表示该请求未归属任何租户
+func (l *RequestLogger) LogRequest(requestID string, accountID int64, accountName, message string, durationMs int64, success bool, tenantID int64) {
 	level := "info"
 	if !success {
 		level = "error"
@@ -85,6 +145,7 @@ func (l *RequestLogger) LogRequest(requestID string, accountID int64, accountNam
 		RequestID: requestID,
 		AccountID: accountID,
 		Account:   accountName,
+		TenantID:  tenantID,
 		Message:   message,
 		Duration:  durationMs,
 		Success:   success,
@@ -125,6 +186,50 @@ func (l *RequestLogger) GetLogs(limit int) []LogEntry {
 	return result
 }
 
+// Query 按条件检索日志：内存环形缓冲区中满足条件的条目，加上持久化后端（若已装载）中的历史条目，
+// 按 ID 去重合并后返回
+func (l *RequestLogger) Query(filter QueryFilter) ([]LogEntry, error) {
+	l.mu.RLock()
+	var memMatches []LogEntry
+	for i := 0; i < l.count; i++ {
+		e := l.logs[(l.head+i)%l.maxSize]
+		if filter.match(e) {
+			memMatches = append(memMatches, e)
+		}
+	}
+	l.mu.RUnlock()
+
+	if l.store == nil {
+		if filter.Limit > 0 && len(memMatches) > filter.Limit {
+			memMatches = memMatches[len(memMatches)-filter.Limit:]
+		}
+		return memMatches, nil
+	}
+
+	archived, err := l.store.Query(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int64]bool, len(archived))
+	merged := make([]LogEntry, 0, len(archived)+len(memMatches))
+	for _, e := range archived {
+		seen[e.ID] = true
+		merged = append(merged, e)
+	}
+	for _, e := range memMatches {
+		if !seen[e.ID] {
+			merged = append(merged, e)
+		}
+	}
+
+	if filter.Limit > 0 && len(merged) > filter.Limit {
+		merged = merged[len(merged)-filter.Limit:]
+	}
+
+	return merged, nil
+}
+
 // Subscribe 订阅实时日志
 func (l *RequestLogger) Subscribe() (int64, <-chan LogEntry) {
 	l.listenerMu.Lock()
@@ -0,0 +1,302 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// LokiConfig 配置 Loki 推送行为，由 config.Load 从环境变量读取后传入
+type LokiConfig struct {
+	Enabled       bool
+	URL           string // 例如 http://loki:3100/loki/api/v1/push
+	ServiceLabel  string
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+const (
+	lokiQueueBuffer    = 1000 // 和 debug.logChannelBuffer 一样是有界 channel，但满了丢最旧的一条（debug 丢的是新来的）
+	lokiMaxRetries     = 5
+	lokiInitialBackoff = 500 * time.Millisecond
+	lokiMaxBackoff     = 30 * time.Second
+)
+
+// LokiForwarder 将 LogEntry 批量推送到 Grafana Loki 的 /loki/api/v1/push 接口，
+// 使用 protobuf+snappy 编码；后台 goroutine 消费有界 channel，满载时丢弃最旧的条目
+type LokiForwarder struct {
+	cfg    LokiConfig
+	client *http.Client
+
+	queue  chan LogEntry
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewLokiForwarder 创建并启动 Loki 转发器；cfg.Enabled 为 false 时返回 nil
+func NewLokiForwarder(cfg LokiConfig) *LokiForwarder {
+	if !cfg.Enabled || cfg.URL == "" {
+		return nil
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.ServiceLabel == "" {
+		cfg.ServiceLabel = "orchids-api"
+	}
+
+	f := &LokiForwarder{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan LogEntry, lokiQueueBuffer),
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+
+	go f.run()
+
+	log.Printf("[LokiForwarder] 已启动，推送至 %s", cfg.URL)
+
+	return f
+}
+
+// Enqueue 将一条日志加入待推送队列（非阻塞）；队列满时丢弃最旧的一条，保留最新日志
+func (f *LokiForwarder) Enqueue(entry LogEntry) {
+	select {
+	case f.queue <- entry:
+	default:
+		select {
+		case <-f.queue:
+		default:
+		}
+		select {
+		case f.queue <- entry:
+		default:
+		}
+	}
+}
+
+// Close 停止后台 goroutine 并等待其退出，退出前会尽力 flush 队列中剩余的条目
+func (f *LokiForwarder) Close() {
+	close(f.stopCh)
+	<-f.doneCh
+}
+
+func (f *LokiForwarder) run() {
+	defer close(f.doneCh)
+
+	ticker := time.NewTicker(f.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]LogEntry, 0, f.cfg.BatchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := f.push(batch); err != nil {
+			log.Printf("[LokiForwarder] 推送失败，丢弃本批 %d 条日志: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry := <-f.queue:
+			batch = append(batch, entry)
+			if len(batch) >= f.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-f.stopCh:
+			// drain 队列中剩余的条目后做最后一次 flush
+			for {
+				select {
+				case entry := <-f.queue:
+					batch = append(batch, entry)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// push 将一批日志按 label 分组为多个 stream，编码为 protobuf+snappy 后 POST 给 Loki，
+// 遇到 5xx 错误指数退避重试
+func (f *LokiForwarder) push(entries []LogEntry) error {
+	streams := groupByLabels(entries, f.cfg.ServiceLabel)
+	body, err := encodePushRequest(streams)
+	if err != nil {
+		return fmt.Errorf("encode push request: %w", err)
+	}
+	compressed := snappy.Encode(nil, body)
+
+	backoff := lokiInitialBackoff
+	var lastErr error
+	for attempt := 0; attempt < lokiMaxRetries; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, f.cfg.URL, bytes.NewReader(compressed))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-protobuf")
+
+		resp, err := f.client.Do(req)
+		if err != nil {
+			lastErr = err
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode < 500 {
+				if resp.StatusCode >= 300 {
+					return fmt.Errorf("loki push rejected: status %d", resp.StatusCode)
+				}
+				return nil
+			}
+			lastErr = fmt.Errorf("loki push: server error status %d", resp.StatusCode)
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > lokiMaxBackoff {
+			backoff = lokiMaxBackoff
+		}
+	}
+
+	return lastErr
+}
+
+// lokiStream 是一组共享同一套 label 的日志条目
+type lokiStream struct {
+	labels  string
+	entries []LogEntry
+}
+
+// groupByLabels 按 level+account 派生的 label 集合对日志条目分组，service label 固定为配置值
+func groupByLabels(entries []LogEntry, service string) []lokiStream {
+	groups := make(map[string]*lokiStream)
+	var order []string
+
+	for _, e := range entries {
+		labels := formatLabels(service, e.Level, e.Account)
+		g, ok := groups[labels]
+		if !ok {
+			g = &lokiStream{labels: labels}
+			groups[labels] = g
+			order = append(order, labels)
+		}
+		g.entries = append(g.entries, e)
+	}
+
+	streams := make([]lokiStream, 0, len(order))
+	for _, labels := range order {
+		streams = append(streams, *groups[labels])
+	}
+	return streams
+}
+
+func formatLabels(service, level, account string) string {
+	var b strings.Builder
+	b.WriteString(`{service="`)
+	b.WriteString(escapeLabelValue(service))
+	b.WriteString(`"`)
+	if level != "" {
+		b.WriteString(`,level="`)
+		b.WriteString(escapeLabelValue(level))
+		b.WriteString(`"`)
+	}
+	if account != "" {
+		b.WriteString(`,account="`)
+		b.WriteString(escapeLabelValue(account))
+		b.WriteString(`"`)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func escapeLabelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return v
+}
+
+// encodePushRequest 手工编码 Loki logproto.PushRequest 的 protobuf wire 格式，
+// 避免为了这一个接口引入完整的 proto 编译产物
+func encodePushRequest(streams []lokiStream) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, s := range streams {
+		streamBytes, err := encodeStream(s)
+		if err != nil {
+			return nil, err
+		}
+		appendLengthDelimited(&buf, 1, streamBytes)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func encodeStream(s lokiStream) ([]byte, error) {
+	var buf bytes.Buffer
+	appendLengthDelimited(&buf, 1, []byte(s.labels))
+
+	for _, e := range s.entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		entryBytes := encodeEntry(e.Timestamp, line)
+		appendLengthDelimited(&buf, 2, entryBytes)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func encodeEntry(ts time.Time, line []byte) []byte {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	var tsBuf bytes.Buffer
+	appendVarint(&tsBuf, 1, uint64(ts.Unix()))
+	appendVarint(&tsBuf, 2, uint64(ts.Nanosecond()))
+
+	var buf bytes.Buffer
+	appendLengthDelimited(&buf, 1, tsBuf.Bytes())
+	appendLengthDelimited(&buf, 2, line)
+	return buf.Bytes()
+}
+
+// appendLengthDelimited 写入 protobuf 的 length-delimited 字段（wire type 2）
+func appendLengthDelimited(buf *bytes.Buffer, fieldNum int, data []byte) {
+	writeTag(buf, fieldNum, 2)
+	writeVarint(buf, uint64(len(data)))
+	buf.Write(data)
+}
+
+// appendVarint 写入 protobuf 的 varint 字段（wire type 0）
+func appendVarint(buf *bytes.Buffer, fieldNum int, v uint64) {
+	writeTag(buf, fieldNum, 0)
+	writeVarint(buf, v)
+}
+
+func writeTag(buf *bytes.Buffer, fieldNum, wireType int) {
+	writeVarint(buf, uint64(fieldNum)<<3|uint64(wireType))
+}
+
+func writeVarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
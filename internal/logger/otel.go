@@ -0,0 +1,291 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// OTelConfig 配置 OpenTelemetry OTLP/HTTP 导出行为，由 config.Load 从环境变量读取后传入
+type OTelConfig struct {
+	Enabled       bool
+	Endpoint      string // 例如 http://tempo:4318，实际 POST 到 Endpoint + "/v1/traces"
+	ServiceName   string
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+const (
+	otelQueueBuffer = 1000
+)
+
+// OTelExporter 把带 TraceID 的 LogEntry 转换成 OTLP span，批量 POST 到
+// <endpoint>/v1/traces（OTLP/HTTP JSON 编码，Jaeger/Tempo 均可直接接收）
+type OTelExporter struct {
+	cfg    OTelConfig
+	client *http.Client
+
+	queue  chan LogEntry
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewOTelExporter 创建并启动导出器；cfg.Enabled 为 false 时返回 nil
+func NewOTelExporter(cfg OTelConfig) *OTelExporter {
+	if !cfg.Enabled || cfg.Endpoint == "" {
+		return nil
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "orchids-api"
+	}
+
+	e := &OTelExporter{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan LogEntry, otelQueueBuffer),
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+
+	go e.run()
+
+	log.Printf("[OTelExporter] 已启动，推送至 %s/v1/traces", cfg.Endpoint)
+
+	return e
+}
+
+// Enqueue 将一条日志加入待导出队列（非阻塞）；队列满时丢弃最旧的一条
+func (e *OTelExporter) Enqueue(entry LogEntry) {
+	select {
+	case e.queue <- entry:
+	default:
+		select {
+		case <-e.queue:
+		default:
+		}
+		select {
+		case e.queue <- entry:
+		default:
+		}
+	}
+}
+
+// Close 停止后台 goroutine 并等待其退出，退出前会尽力 flush 队列中剩余的条目
+func (e *OTelExporter) Close() {
+	close(e.stopCh)
+	<-e.doneCh
+}
+
+func (e *OTelExporter) run() {
+	defer close(e.doneCh)
+
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]LogEntry, 0, e.cfg.BatchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			log.Printf("[OTelExporter] 导出失败，丢弃本批 %d 条 span: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry := <-e.queue:
+			batch = append(batch, entry)
+			if len(batch) >= e.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stopCh:
+			for {
+				select {
+				case entry := <-e.queue:
+					batch = append(batch, entry)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// --- OTLP/HTTP JSON 编码：字段名和嵌套结构与 OTLP protobuf 消息一一对应 ---
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+
+type otlpExportRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource    `json:"resource"`
+	ScopeSpans []otlpScopeSpan `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpan struct {
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code"` // 1 = OK, 2 = ERROR
+}
+
+// entryToSpan 把一条 LogEntry 转成一个 OTLP span：LogEntry 本身没有独立的起止时间，
+// 用 Timestamp 同时作为起止时间（瞬时事件），Duration 非零时用它回推出 span 的起始时间
+func entryToSpan(e LogEntry) otlpSpan {
+	end := e.Timestamp
+	if end.IsZero() {
+		end = time.Now()
+	}
+	start := end
+	if e.Duration > 0 {
+		start = end.Add(-time.Duration(e.Duration) * time.Millisecond)
+	}
+
+	name := e.Event
+	if name == "" {
+		name = "log"
+	}
+
+	statusCode := 1
+	if e.Level == "error" {
+		statusCode = 2
+	}
+
+	attrs := []otlpKeyValue{
+		{Key: "request_id", Value: otlpAnyValue{StringValue: e.RequestID}},
+		{Key: "message", Value: otlpAnyValue{StringValue: e.Message}},
+	}
+	if e.Account != "" {
+		attrs = append(attrs, otlpKeyValue{Key: "account", Value: otlpAnyValue{StringValue: e.Account}})
+	}
+	if e.AccountID != 0 {
+		attrs = append(attrs, otlpKeyValue{Key: "account_id", Value: otlpAnyValue{StringValue: strconv.FormatInt(e.AccountID, 10)}})
+	}
+	if e.TenantID != 0 {
+		attrs = append(attrs, otlpKeyValue{Key: "tenant_id", Value: otlpAnyValue{StringValue: strconv.FormatInt(e.TenantID, 10)}})
+	}
+	for k, v := range e.Attrs {
+		attrs = append(attrs, otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: toString(v)}})
+	}
+
+	return otlpSpan{
+		TraceID:           e.TraceID,
+		SpanID:            e.SpanID,
+		ParentSpanID:      e.ParentSpanID,
+		Name:              name,
+		StartTimeUnixNano: strconv.FormatInt(start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes:        attrs,
+		Status:            otlpStatus{Code: statusCode},
+	}
+}
+
+func toString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	default:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+}
+
+func (e *OTelExporter) export(entries []LogEntry) error {
+	spans := make([]otlpSpan, 0, len(entries))
+	for _, entry := range entries {
+		if entry.TraceID == "" {
+			continue
+		}
+		spans = append(spans, entryToSpan(entry))
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+
+	req := otlpExportRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpKeyValue{
+						{Key: "service.name", Value: otlpAnyValue{StringValue: e.cfg.ServiceName}},
+					},
+				},
+				ScopeSpans: []otlpScopeSpan{{Spans: spans}},
+			},
+		},
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, e.cfg.Endpoint+"/v1/traces", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return &otelHTTPError{status: resp.StatusCode}
+	}
+	return nil
+}
+
+type otelHTTPError struct {
+	status int
+}
+
+func (err *otelHTTPError) Error() string {
+	return "otlp export rejected with status " + strconv.Itoa(err.status)
+}
@@ -0,0 +1,390 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryFilter 描述一次历史日志查询的筛选条件，零值字段表示不限制
+type QueryFilter struct {
+	Since     time.Time
+	Until     time.Time
+	Level     string
+	AccountID int64
+	TenantID  int64
+	RequestID string
+	Contains  string // 对 Message 做子串匹配
+	Limit     int
+}
+
+// match 判断单条日志是否满足筛选条件
+func (f QueryFilter) match(e LogEntry) bool {
+	if !f.Since.IsZero() && e.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Timestamp.After(f.Until) {
+		return false
+	}
+	if f.Level != "" && e.Level != f.Level {
+		return false
+	}
+	if f.AccountID != 0 && e.AccountID != f.AccountID {
+		return false
+	}
+	if f.TenantID != 0 && e.TenantID != f.TenantID {
+		return false
+	}
+	if f.RequestID != "" && e.RequestID != f.RequestID {
+		return false
+	}
+	if f.Contains != "" && !strings.Contains(e.Message, f.Contains) {
+		return false
+	}
+	return true
+}
+
+// Store 是日志持久化后端的抽象，便于未来替换为 SQLite/Loki 等实现而不改动 Log() 调用点
+type Store interface {
+	// Write 持久化一条日志，不应阻塞调用方太久
+	Write(entry LogEntry) error
+	// Query 按条件从持久化存储中检索日志，结果按时间正序返回
+	Query(filter QueryFilter) ([]LogEntry, error)
+	// Close 刷新并关闭底层资源
+	Close() error
+}
+
+const (
+	// DefaultMaxFileSize 单个日志文件达到该大小后触发滚动（字节）
+	DefaultMaxFileSize = 10 * 1024 * 1024
+	// DefaultRotateInterval 即使未达到体积上限，也按该时间间隔滚动文件
+	DefaultRotateInterval = 24 * time.Hour
+	// DefaultRetention 滚动归档文件最多保留的份数，超出的按时间从旧到新删除
+	DefaultRetention = 30
+
+	activeLogName = "requests.jsonl"
+)
+
+// FileStore 将 LogEntry 以换行分隔 JSON 的形式写入 data/logs/ 下的滚动文件集：
+// 当前文件为 requests.jsonl，滚动后按时间戳重命名并 gzip 压缩为归档文件
+type FileStore struct {
+	dir         string
+	maxFileSize int64
+	rotateEvery time.Duration
+	retention   int
+
+	mu       sync.Mutex
+	file     *os.File
+	writer   *bufio.Writer
+	size     int64
+	openedAt time.Time
+}
+
+// NewFileStore 创建（或打开已存在的）滚动 JSONL 日志存储
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create log dir: %w", err)
+	}
+
+	fs := &FileStore{
+		dir:         dir,
+		maxFileSize: DefaultMaxFileSize,
+		rotateEvery: DefaultRotateInterval,
+		retention:   DefaultRetention,
+	}
+
+	if err := fs.openActive(); err != nil {
+		return nil, err
+	}
+
+	fs.cleanupOldArchives()
+
+	return fs, nil
+}
+
+func (fs *FileStore) activePath() string {
+	return filepath.Join(fs.dir, activeLogName)
+}
+
+func (fs *FileStore) openActive() error {
+	path := fs.activePath()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open active log file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat active log file: %w", err)
+	}
+
+	fs.file = f
+	fs.writer = bufio.NewWriter(f)
+	fs.size = info.Size()
+	fs.openedAt = time.Now()
+	return nil
+}
+
+// Write 追加一条日志；达到大小或时间上限时先滚动再写入
+func (fs *FileStore) Write(entry LogEntry) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.shouldRotate() {
+		if err := fs.rotateLocked(); err != nil {
+			log.Printf("[LogStore] 滚动日志文件失败: %v", err)
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	n, err := fs.writer.Write(data)
+	if err != nil {
+		return err
+	}
+	fs.size += int64(n)
+
+	// 逐条 flush：日志量不大，优先保证崩溃时不丢最近记录
+	return fs.writer.Flush()
+}
+
+func (fs *FileStore) shouldRotate() bool {
+	if fs.size >= fs.maxFileSize {
+		return true
+	}
+	if fs.rotateEvery > 0 && time.Since(fs.openedAt) >= fs.rotateEvery {
+		return true
+	}
+	return false
+}
+
+// rotateLocked 将当前活动文件重命名为带时间戳的归档文件并 gzip 压缩，然后打开新的活动文件
+func (fs *FileStore) rotateLocked() error {
+	if err := fs.writer.Flush(); err != nil {
+		return err
+	}
+	if err := fs.file.Close(); err != nil {
+		return err
+	}
+
+	archiveName := fmt.Sprintf("requests-%s.jsonl.gz", time.Now().Format("20060102-150405"))
+	if err := gzipFile(fs.activePath(), filepath.Join(fs.dir, archiveName)); err != nil {
+		return err
+	}
+	if err := os.Remove(fs.activePath()); err != nil {
+		return err
+	}
+
+	fs.cleanupOldArchives()
+
+	return fs.openActive()
+}
+
+func gzipFile(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	gw := gzip.NewWriter(dst)
+	if _, err := copyAll(gw, src); err != nil {
+		gw.Close()
+		return err
+	}
+	return gw.Close()
+}
+
+func copyAll(dst *gzip.Writer, src *os.File) (int64, error) {
+	buf := make([]byte, 32*1024)
+	var total int64
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			if _, writeErr := dst.Write(buf[:n]); writeErr != nil {
+				return total, writeErr
+			}
+			total += int64(n)
+		}
+		if readErr != nil {
+			if readErr == io.EOF {
+				return total, nil
+			}
+			return total, readErr
+		}
+	}
+}
+
+// cleanupOldArchives 仅保留最近 retention 份归档文件，类似 debug.cleanupOldDirs 的做法
+func (fs *FileStore) cleanupOldArchives() {
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return
+	}
+
+	var archives []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		if strings.HasPrefix(name, "requests-") && strings.HasSuffix(name, ".jsonl.gz") {
+			archives = append(archives, name)
+		}
+	}
+
+	if len(archives) <= fs.retention {
+		return
+	}
+
+	sort.Strings(archives)
+	for i := 0; i < len(archives)-fs.retention; i++ {
+		os.Remove(filepath.Join(fs.dir, archives[i]))
+	}
+}
+
+// Query 从活动文件和归档文件中检索满足条件的日志，按时间正序返回
+func (fs *FileStore) Query(filter QueryFilter) ([]LogEntry, error) {
+	fs.mu.Lock()
+	if fs.writer != nil {
+		fs.writer.Flush()
+	}
+	fs.mu.Unlock()
+
+	archivePaths, err := fs.sortedArchivePaths()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []LogEntry
+	for _, path := range archivePaths {
+		entries, err := readGzipJSONL(path)
+		if err != nil {
+			log.Printf("[LogStore] 读取归档文件失败 %s: %v", path, err)
+			continue
+		}
+		results = append(results, entries...)
+	}
+
+	active, err := readPlainJSONL(fs.activePath())
+	if err != nil {
+		return nil, err
+	}
+	results = append(results, active...)
+
+	filtered := results[:0]
+	for _, e := range results {
+		if filter.match(e) {
+			filtered = append(filtered, e)
+		}
+	}
+
+	if filter.Limit > 0 && len(filtered) > filter.Limit {
+		filtered = filtered[len(filtered)-filter.Limit:]
+	}
+
+	return filtered, nil
+}
+
+func (fs *FileStore) sortedArchivePaths() ([]string, error) {
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), "requests-") && strings.HasSuffix(e.Name(), ".jsonl.gz") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	paths := make([]string, len(names))
+	for i, n := range names {
+		paths[i] = filepath.Join(fs.dir, n)
+	}
+	return paths, nil
+}
+
+func readPlainJSONL(path string) ([]LogEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return scanJSONL(f)
+}
+
+func readGzipJSONL(path string) ([]LogEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	return scanJSONL(gr)
+}
+
+func scanJSONL(r interface{ Read([]byte) (int, error) }) ([]LogEntry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var entries []LogEntry
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e LogEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Close 刷新缓冲区并关闭活动文件
+func (fs *FileStore) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.writer != nil {
+		fs.writer.Flush()
+	}
+	if fs.file != nil {
+		return fs.file.Close()
+	}
+	return nil
+}
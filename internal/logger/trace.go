@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TraceContext 是一次调用链路上下文，对应 W3C Trace Context 的 traceparent 字段：
+// https://www.w3.org/TR/trace-context/#traceparent-header
+type TraceContext struct {
+	TraceID      string // 32 位十六进制（16 字节）
+	SpanID       string // 16 位十六进制（8 字节），当前这一段 span 的 ID
+	ParentSpanID string // 产生当前 span 的父 span ID，根 span 为空
+}
+
+type traceContextKey int
+
+const traceKey traceContextKey = 0
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return strings.Repeat("0", n*2)
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewTraceContext 生成一个全新的根 TraceContext（新 trace、新 span，无父 span）
+func NewTraceContext() TraceContext {
+	return TraceContext{
+		TraceID: randomHex(16),
+		SpanID:  randomHex(8),
+	}
+}
+
+// ParseTraceparent 解析形如 "00-<trace-id>-<span-id>-<flags>" 的 W3C traceparent 请求头；
+// 解析失败（缺失或格式不合法）时返回 false，调用方应回退到 NewTraceContext
+func ParseTraceparent(header string) (TraceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 {
+		return TraceContext{}, false
+	}
+	traceID, spanID := parts[1], parts[2]
+	if len(traceID) != 32 || len(spanID) != 16 {
+		return TraceContext{}, false
+	}
+	if _, err := hex.DecodeString(traceID); err != nil {
+		return TraceContext{}, false
+	}
+	if _, err := hex.DecodeString(spanID); err != nil {
+		return TraceContext{}, false
+	}
+	// 传入的 span 成为新请求这一段 span 的父 span；这一段自己生成新的 span ID
+	return TraceContext{
+		TraceID:      traceID,
+		SpanID:       randomHex(8),
+		ParentSpanID: spanID,
+	}, true
+}
+
+// Traceparent 把 TraceContext 格式化为标准的 traceparent 请求头（version=00, flags=01 已采样）
+func (t TraceContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", t.TraceID, t.SpanID)
+}
+
+// WithTrace 把 TraceContext 放入 context，供下游通过 TraceFromContext 取出并生成子 span
+func WithTrace(ctx context.Context, t TraceContext) context.Context {
+	return context.WithValue(ctx, traceKey, t)
+}
+
+// TraceFromContext 取出当前 context 携带的 TraceContext
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	t, ok := ctx.Value(traceKey).(TraceContext)
+	return t, ok
+}
+
+// NewChildSpan 基于 ctx 中已有的 TraceContext 派生一个子 span（同一 trace，父 span 为当前 span），
+// 返回携带子 span 的新 context 及该子 span 本身；ctx 中没有 TraceContext 时新建一条根 trace
+func NewChildSpan(ctx context.Context) (context.Context, TraceContext) {
+	parent, ok := TraceFromContext(ctx)
+	if !ok {
+		t := NewTraceContext()
+		return WithTrace(ctx, t), t
+	}
+	child := TraceContext{
+		TraceID:      parent.TraceID,
+		SpanID:       randomHex(8),
+		ParentSpanID: parent.SpanID,
+	}
+	return WithTrace(ctx, child), child
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+
+	"orchids-api/internal/config"
+)
+
+// RequireAuth 按 cfg.TLS.AuthType 认证请求（密码、客户端证书，或二者任一），取代
+// /admin/*、/api/accounts*、/api/logs* 这类需要支持 mTLS 的路由手写
+// BasicAuth(cfg.AdminUser, cfg.AdminPass, ...) 的写法；认证通过的密码请求仍然下发
+// admin_session cookie，免得每次都重新校验密码
+func RequireAuth(cfg *config.Config, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("admin_session"); err == nil && validateSession(cookie.Value) {
+			next(w, r)
+			return
+		}
+
+		if !cfg.IsAuthenticated(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if _, err := r.Cookie("admin_session"); err != nil {
+			setSessionCookie(w)
+		}
+		next(w, r)
+	}
+}
+
+// RequireAuthHandler 是 RequireAuth 面向 http.Handler（而非 http.HandlerFunc）的版本，
+// 供 cfg.AdminPath+"/" 下的静态文件 Handler 使用
+func RequireAuthHandler(cfg *config.Config, next http.Handler) http.HandlerFunc {
+	return RequireAuth(cfg, next.ServeHTTP)
+}
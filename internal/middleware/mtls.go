@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+
+	"orchids-api/internal/store"
+)
+
+// ClientCertAuth 校验 mTLS 客户端证书：用证书 DER 的 SHA-256 指纹查 accounts.cert_fingerprint，
+// 命中才放行；CN/SAN 不参与匹配。http.Server 的 ClientAuth 要求或验证客户端证书
+// （RequireAndVerifyClientCert、VerifyClientCertIfGiven）时 r.TLS.PeerCertificates 才会被填充
+func ClientCertAuth(s *store.Store, next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+
+		cert := r.TLS.PeerCertificates[0]
+		fingerprint := certFingerprint(cert)
+
+		acc, err := s.GetAccountByCertFingerprint(fingerprint)
+		if err != nil {
+			http.Error(w, "unknown client certificate", http.StatusUnauthorized)
+			return
+		}
+		if !acc.Enabled {
+			http.Error(w, "account disabled", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// certFingerprint 计算证书 DER 编码的 SHA-256 指纹，十六进制表示
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"orchids-api/internal/store"
+)
+
+func generateTestCert(t *testing.T, commonName string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return cert
+}
+
+func TestClientCertAuthRejectsRequestWithoutCertificate(t *testing.T) {
+	s, err := store.New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	called := false
+	handler := ClientCertAuth(s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/agent/messages", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if called {
+		t.Fatal("handler should not be called without a client certificate")
+	}
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestClientCertAuthRejectsUnknownCertificate(t *testing.T) {
+	s, err := store.New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	called := false
+	handler := ClientCertAuth(s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	cert := generateTestCert(t, "unknown-agent")
+	req := httptest.NewRequest(http.MethodPost, "/v1/agent/messages", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if called {
+		t.Fatal("handler should not be called for a certificate with no matching account")
+	}
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestClientCertAuthAllowsMatchingEnabledAccount(t *testing.T) {
+	s, err := store.New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	cert := generateTestCert(t, "trusted-agent")
+	fingerprint := certFingerprint(cert)
+
+	acc := &store.Account{Name: "trusted-agent", Enabled: true}
+	if err := s.CreateAccount(acc); err != nil {
+		t.Fatalf("CreateAccount failed: %v", err)
+	}
+	if err := s.SetAccountCertFingerprint(acc.ID, fingerprint); err != nil {
+		t.Fatalf("SetAccountCertFingerprint failed: %v", err)
+	}
+
+	called := false
+	handler := ClientCertAuth(s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/agent/messages", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if !called {
+		t.Fatal("handler should be called for a certificate matching an enabled account")
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestClientCertAuthRejectsDisabledAccount(t *testing.T) {
+	s, err := store.New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	cert := generateTestCert(t, "disabled-agent")
+	fingerprint := certFingerprint(cert)
+
+	acc := &store.Account{Name: "disabled-agent", Enabled: false}
+	if err := s.CreateAccount(acc); err != nil {
+		t.Fatalf("CreateAccount failed: %v", err)
+	}
+	if err := s.SetAccountCertFingerprint(acc.ID, fingerprint); err != nil {
+		t.Fatalf("SetAccountCertFingerprint failed: %v", err)
+	}
+
+	called := false
+	handler := ClientCertAuth(s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/agent/messages", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if called {
+		t.Fatal("handler should not be called for a disabled account")
+	}
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,459 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"orchids-api/internal/store"
+)
+
+// OIDCConfig 描述一个通用 OIDC provider（Clerk 或任何符合规范的 IdP）
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	Scopes       []string
+	AuthURL      string
+	TokenURL     string
+	JWKSURL      string
+}
+
+// LoadOIDCConfig 从 Store.GetSetting 恢复 OIDC 配置，便于运营方从后台 UI 配置而无需重新部署
+func LoadOIDCConfig(s *store.Store) (*OIDCConfig, error) {
+	get := func(key string) (string, error) { return s.GetSetting("oidc_" + key) }
+
+	issuer, err := get("issuer")
+	if err != nil {
+		return nil, err
+	}
+	clientID, _ := get("client_id")
+	clientSecret, _ := get("client_secret")
+	redirectURI, _ := get("redirect_uri")
+	scopes, _ := get("scopes")
+	authURL, _ := get("auth_url")
+	tokenURL, _ := get("token_url")
+	jwksURL, _ := get("jwks_url")
+
+	return &OIDCConfig{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURI:  redirectURI,
+		Scopes:       strings.Fields(scopes),
+		AuthURL:      authURL,
+		TokenURL:     tokenURL,
+		JWKSURL:      jwksURL,
+	}, nil
+}
+
+// SaveOIDCConfig 持久化 OIDC 配置
+func SaveOIDCConfig(s *store.Store, cfg *OIDCConfig) error {
+	set := func(key, value string) error { return s.SetSetting("oidc_"+key, value) }
+
+	for _, kv := range [][2]string{
+		{"issuer", cfg.Issuer},
+		{"client_id", cfg.ClientID},
+		{"client_secret", cfg.ClientSecret},
+		{"redirect_uri", cfg.RedirectURI},
+		{"scopes", strings.Join(cfg.Scopes, " ")},
+		{"auth_url", cfg.AuthURL},
+		{"token_url", cfg.TokenURL},
+		{"jwks_url", cfg.JWKSURL},
+	} {
+		if err := set(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pkceVerifiers 暂存等待回调的 PKCE code_verifier，以 state 为键
+var pkceVerifiers = struct {
+	mu sync.Mutex
+	m  map[string]string
+}{m: make(map[string]string)}
+
+// StartOIDCLogin 生成 PKCE (S256) challenge，重定向到 provider 的 authorize 端点
+func StartOIDCLogin(cfg *OIDCConfig, w http.ResponseWriter, r *http.Request) {
+	verifier := randomURLSafeString(64)
+	state := randomURLSafeString(32)
+
+	pkceVerifiers.mu.Lock()
+	pkceVerifiers.m[state] = verifier
+	pkceVerifiers.mu.Unlock()
+
+	challenge := s256Challenge(verifier)
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cfg.ClientID},
+		"redirect_uri":          {cfg.RedirectURI},
+		"scope":                 {strings.Join(cfg.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	http.Redirect(w, r, cfg.AuthURL+"?"+params.Encode(), http.StatusFound)
+}
+
+type oidcTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// FinishOIDCLogin 用 authorization code 换取 token，校验 ID token，并把 email claim 映射到 admin 记录
+func FinishOIDCLogin(s *store.Store, cfg *OIDCConfig, code, state string) (*store.Admin, error) {
+	pkceVerifiers.mu.Lock()
+	verifier, ok := pkceVerifiers.m[state]
+	delete(pkceVerifiers.m, state)
+	pkceVerifiers.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown or expired state")
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {cfg.RedirectURI},
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+		"code_verifier": {verifier},
+	}
+
+	resp, err := http.PostForm(cfg.TokenURL, form)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tokens oidcTokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	claims, err := verifyIDToken(cfg, tokens.IDToken)
+	if err != nil {
+		return nil, fmt.Errorf("id token verification failed: %w", err)
+	}
+
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return nil, fmt.Errorf("id token missing email claim")
+	}
+
+	admin, err := s.GetAdminByUsername(email)
+	if err != nil {
+		return nil, fmt.Errorf("no admin matching verified email %s: %w", email, err)
+	}
+
+	if tokens.RefreshToken != "" {
+		s.SetSetting("oidc_refresh_token_"+email, tokens.RefreshToken)
+	}
+
+	return admin, nil
+}
+
+// jwk 是 JWKS 里的单个公钥（RFC 7517），只取 RS256/ES256 验签用得到的字段
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwksDocument struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwksCacheTTL 是 JWKS 文档的本地缓存时长；provider 轮换签名密钥的频率远低于登录频率，
+// 没必要每次登录都重新拉一遍
+const jwksCacheTTL = 10 * time.Minute
+
+type cachedJWKS struct {
+	keys      []jwk
+	fetchedAt time.Time
+}
+
+var jwksCache = struct {
+	mu    sync.Mutex
+	byURL map[string]cachedJWKS
+}{byURL: make(map[string]cachedJWKS)}
+
+// fetchJWKS 按 URL 取 JWKS 文档，缓存 jwksCacheTTL；provider 换签名密钥之后的这段时间内
+// 验签可能因为拿到旧缓存而失败，重新登录即可（下一次会因为找不到匹配 kid 而强制刷新）
+func fetchJWKS(jwksURL string) ([]jwk, error) {
+	jwksCache.mu.Lock()
+	if cached, ok := jwksCache.byURL[jwksURL]; ok && time.Since(cached.fetchedAt) < jwksCacheTTL {
+		jwksCache.mu.Unlock()
+		return cached.keys, nil
+	}
+	jwksCache.mu.Unlock()
+
+	resp, err := http.Get(jwksURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned status %d", resp.StatusCode)
+	}
+
+	var doc jwksDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	jwksCache.mu.Lock()
+	jwksCache.byURL[jwksURL] = cachedJWKS{keys: doc.Keys, fetchedAt: time.Now()}
+	jwksCache.mu.Unlock()
+
+	return doc.Keys, nil
+}
+
+// findJWK 按 kid 在一组 JWKS 里查找匹配的公钥；kid 为空时（一些 provider 不带）退化为
+// 按 alg 唯一匹配
+func findJWK(keys []jwk, kid, alg string) (*jwk, error) {
+	if kid != "" {
+		for i := range keys {
+			if keys[i].Kid == kid {
+				return &keys[i], nil
+			}
+		}
+		return nil, fmt.Errorf("no JWKS key matches kid %q", kid)
+	}
+
+	var match *jwk
+	for i := range keys {
+		if keys[i].Alg == alg || (alg == "" && keys[i].Alg == "") {
+			if match != nil {
+				return nil, fmt.Errorf("id token omits kid and JWKS has multiple candidate keys")
+			}
+			match = &keys[i]
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("no JWKS key matches alg %q", alg)
+	}
+	return match, nil
+}
+
+// publicKey 把一个 RSA 或 EC JWK 解出对应的 crypto 公钥
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(nBytes),
+			E: int(new(big.Int).SetBytes(eBytes).Int64()),
+		}, nil
+
+	case "EC":
+		xBytes, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		yBytes, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve: %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(xBytes),
+			Y:     new(big.Int).SetBytes(yBytes),
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported JWK key type: %s", k.Kty)
+	}
+}
+
+// verifySignature 按 header 里声明的 alg 验证 RS256/ES256 签名；signingInput 是
+// "base64(header).base64(payload)" 的原始字节
+func verifySignature(alg string, pub crypto.PublicKey, signingInput, sig []byte) error {
+	switch alg {
+	case "RS256":
+		rsaKey, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("JWKS key type does not match alg RS256")
+		}
+		hashed := sha256.Sum256(signingInput)
+		return rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, hashed[:], sig)
+
+	case "ES256":
+		ecKey, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("JWKS key type does not match alg ES256")
+		}
+		if len(sig) != 64 {
+			return fmt.Errorf("malformed ES256 signature")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		hashed := sha256.Sum256(signingInput)
+		if !ecdsa.Verify(ecKey, hashed[:], r, s) {
+			return fmt.Errorf("signature verification failed")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported id token alg: %s", alg)
+	}
+}
+
+// verifyIDToken 用 cfg.JWKSURL 拉取的公钥验证 ID token 的 RS256/ES256 签名，并校验
+// iss/aud/exp，只有全部通过才返回 claims 供 FinishOIDCLogin 信任 email 字段
+func verifyIDToken(cfg *OIDCConfig, idToken string) (map[string]interface{}, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed id token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode id token header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse id token header: %w", err)
+	}
+	if header.Alg != "RS256" && header.Alg != "ES256" {
+		return nil, fmt.Errorf("unsupported id token alg: %s", header.Alg)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode id token payload: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode id token signature: %w", err)
+	}
+
+	if cfg.JWKSURL == "" {
+		return nil, fmt.Errorf("OIDC provider has no jwks_url configured")
+	}
+	keys, err := fetchJWKS(cfg.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	key, err := findJWK(keys, header.Kid, header.Alg)
+	if err != nil {
+		// 缓存里没有这个 kid，丢掉这份缓存，下一次登录会重新拉取 JWKS
+		jwksCache.mu.Lock()
+		delete(jwksCache.byURL, cfg.JWKSURL)
+		jwksCache.mu.Unlock()
+		return nil, err
+	}
+	pub, err := key.publicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	if err := verifySignature(header.Alg, pub, signingInput, sig); err != nil {
+		return nil, fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("failed to parse id token claims: %w", err)
+	}
+
+	iss, _ := claims["iss"].(string)
+	if iss == "" || cfg.Issuer == "" || iss != cfg.Issuer {
+		return nil, fmt.Errorf("unexpected issuer: %s", iss)
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("id token missing exp claim")
+	}
+	if time.Now().Unix() > int64(exp) {
+		return nil, fmt.Errorf("id token expired")
+	}
+
+	if !audienceMatches(claims["aud"], cfg.ClientID) {
+		return nil, fmt.Errorf("unexpected audience")
+	}
+
+	return claims, nil
+}
+
+// audienceMatches 判断 aud claim（字符串或字符串数组两种常见形式）是否包含 clientID
+func audienceMatches(aud interface{}, clientID string) bool {
+	if clientID == "" {
+		return false
+	}
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func randomURLSafeString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func s256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testKID = "test-key-1"
+
+func startTestJWKS(t *testing.T, pub *rsa.PublicKey) *httptest.Server {
+	t.Helper()
+
+	n := base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+	eBytes := rsaExponentBytes(pub.E)
+	e := base64.RawURLEncoding.EncodeToString(eBytes)
+
+	doc := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": testKID, "alg": "RS256", "n": n, "e": e},
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doc)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// rsaExponentBytes 把一个 RSA 公钥指数（通常是 65537）编码成 JWK 要求的最短大端字节序
+func rsaExponentBytes(e int) []byte {
+	if e == 0 {
+		return []byte{0}
+	}
+	var b []byte
+	for e > 0 {
+		b = append([]byte{byte(e & 0xff)}, b...)
+		e >>= 8
+	}
+	return b
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+
+	header := map[string]string{"alg": "RS256", "kid": kid}
+	headerJSON, _ := json.Marshal(header)
+	payloadJSON, _ := json.Marshal(claims)
+
+	headerB64 := base64.RawURLEncoding.EncodeToString(headerJSON)
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadJSON)
+	signingInput := headerB64 + "." + payloadB64
+
+	hashed := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("failed to sign test token: %v", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   "https://issuer.example.com",
+		"aud":   "client-123",
+		"email": "alice@example.com",
+		"exp":   float64(time.Now().Add(time.Hour).Unix()),
+	}
+}
+
+func TestVerifyIDTokenAcceptsValidSignedToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	jwksSrv := startTestJWKS(t, &key.PublicKey)
+
+	cfg := &OIDCConfig{Issuer: "https://issuer.example.com", ClientID: "client-123", JWKSURL: jwksSrv.URL}
+	token := signRS256(t, key, testKID, validClaims())
+
+	claims, err := verifyIDToken(cfg, token)
+	if err != nil {
+		t.Fatalf("expected a validly signed token to verify, got: %v", err)
+	}
+	if claims["email"] != "alice@example.com" {
+		t.Errorf("got email claim %v, want alice@example.com", claims["email"])
+	}
+}
+
+func TestVerifyIDTokenRejectsTamperedPayload(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	jwksSrv := startTestJWKS(t, &key.PublicKey)
+
+	cfg := &OIDCConfig{Issuer: "https://issuer.example.com", ClientID: "client-123", JWKSURL: jwksSrv.URL}
+	token := signRS256(t, key, testKID, validClaims())
+
+	// 伪造一个不同的 payload，拼上原来的签名——签名应该对不上新的 signing input
+	forged := map[string]interface{}{
+		"iss":   "https://issuer.example.com",
+		"aud":   "client-123",
+		"email": "admin@example.com",
+		"exp":   float64(time.Now().Add(time.Hour).Unix()),
+	}
+	forgedPayload, _ := json.Marshal(forged)
+	parts := splitToken(t, token)
+	tamperedToken := parts[0] + "." + base64.RawURLEncoding.EncodeToString(forgedPayload) + "." + parts[2]
+
+	if _, err := verifyIDToken(cfg, tamperedToken); err == nil {
+		t.Error("expected a tampered payload to fail signature verification")
+	}
+}
+
+func TestVerifyIDTokenRejectsWrongIssuer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	jwksSrv := startTestJWKS(t, &key.PublicKey)
+
+	cfg := &OIDCConfig{Issuer: "https://issuer.example.com", ClientID: "client-123", JWKSURL: jwksSrv.URL}
+	claims := validClaims()
+	claims["iss"] = "https://attacker.example.com"
+	token := signRS256(t, key, testKID, claims)
+
+	if _, err := verifyIDToken(cfg, token); err == nil {
+		t.Error("expected a token with the wrong issuer to be rejected")
+	}
+}
+
+func TestVerifyIDTokenRejectsWrongAudience(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	jwksSrv := startTestJWKS(t, &key.PublicKey)
+
+	cfg := &OIDCConfig{Issuer: "https://issuer.example.com", ClientID: "client-123", JWKSURL: jwksSrv.URL}
+	claims := validClaims()
+	claims["aud"] = "some-other-client"
+	token := signRS256(t, key, testKID, claims)
+
+	if _, err := verifyIDToken(cfg, token); err == nil {
+		t.Error("expected a token with the wrong audience to be rejected")
+	}
+}
+
+func TestVerifyIDTokenRejectsExpiredToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	jwksSrv := startTestJWKS(t, &key.PublicKey)
+
+	cfg := &OIDCConfig{Issuer: "https://issuer.example.com", ClientID: "client-123", JWKSURL: jwksSrv.URL}
+	claims := validClaims()
+	claims["exp"] = float64(time.Now().Add(-time.Hour).Unix())
+	token := signRS256(t, key, testKID, claims)
+
+	if _, err := verifyIDToken(cfg, token); err == nil {
+		t.Error("expected an expired token to be rejected")
+	}
+}
+
+func TestVerifyIDTokenRejectsSignatureFromUnknownKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	// JWKS 只发布 key，签名却用另一把私钥签——验签必须失败
+	jwksSrv := startTestJWKS(t, &key.PublicKey)
+
+	cfg := &OIDCConfig{Issuer: "https://issuer.example.com", ClientID: "client-123", JWKSURL: jwksSrv.URL}
+	token := signRS256(t, otherKey, testKID, validClaims())
+
+	if _, err := verifyIDToken(cfg, token); err == nil {
+		t.Error("expected a token signed by a key not in the JWKS to be rejected")
+	}
+}
+
+func TestVerifyIDTokenRejectsMissingJWKSURL(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+
+	cfg := &OIDCConfig{Issuer: "https://issuer.example.com", ClientID: "client-123"}
+	token := signRS256(t, key, testKID, validClaims())
+
+	if _, err := verifyIDToken(cfg, token); err == nil {
+		t.Error("expected verification to fail when cfg.JWKSURL is not configured")
+	}
+}
+
+func splitToken(t *testing.T, token string) [3]string {
+	t.Helper()
+	var parts [3]string
+	start := 0
+	idx := 0
+	for i := 0; i < len(token); i++ {
+		if token[i] == '.' {
+			parts[idx] = token[start:i]
+			idx++
+			start = i + 1
+		}
+	}
+	parts[idx] = token[start:]
+	return parts
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+
+	"orchids-api/internal/config"
+	"orchids-api/internal/store"
+)
+
+// adminSessions 将 session cookie 映射到管理员 ID，独立于旧版共享密码 session
+var adminSessions = struct {
+	sync.RWMutex
+	m map[string]int64
+}{m: make(map[string]int64)}
+
+// LoginAdmin 校验用户名密码，成功后创建 session 并绑定到 admin_session cookie
+func LoginAdmin(s *store.Store, w http.ResponseWriter, username, password string) error {
+	admin, err := s.VerifyAdminPassword(username, password)
+	if err != nil {
+		return err
+	}
+	return BindAdminSession(w, admin.ID)
+}
+
+// BindAdminSession 创建一个新的 session，绑定到给定管理员并写入 admin_session cookie；
+// 用 createSession（而不是自己发 token）确保同一个 cookie 既能通过 validateSession
+// 又能在 adminSessions 里查到管理员 ID，供任意认证方式（密码、OIDC、证书）在验证身份
+// 之后复用同一套 session 机制
+func BindAdminSession(w http.ResponseWriter, adminID int64) error {
+	token := createSession()
+	adminSessions.Lock()
+	adminSessions.m[token] = adminID
+	adminSessions.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "admin_session",
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   int(sessionTTL.Seconds()),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// adminIDFromRequest 解析请求的 session cookie 对应的管理员 ID；cookie 有效但不是
+// 经 BindAdminSession 签发的（比如老的 BasicAuth/cfg.TLS 登录路径）时返回 (0, false)
+func adminIDFromRequest(r *http.Request) (int64, bool) {
+	cookie, err := r.Cookie("admin_session")
+	if err != nil {
+		return 0, false
+	}
+	if !validateSession(cookie.Value) {
+		return 0, false
+	}
+	adminSessions.RLock()
+	id, ok := adminSessions.m[cookie.Value]
+	adminSessions.RUnlock()
+	return id, ok
+}
+
+// RequirePermission 解析 session -> admin -> roles -> permission groups -> permissions，
+// 按路由授权。请求带的 session 不是经 LoginAdmin/BindAdminSession 签发的 per-admin
+// session（而是老的共享 cfg.AdminUser/AdminPass 或 mTLS 证书登录）时，按"超级管理员"
+// 兼容放行，避免还没往 RBAC 迁移管理员记录的部署直接被锁在外面
+func RequirePermission(cfg *config.Config, s *store.Store, perm string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminID, ok := adminIDFromRequest(r); ok {
+			allowed, err := s.AdminHasPermission(adminID, perm)
+			if err != nil {
+				http.Error(w, "Failed to resolve permissions: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				http.Error(w, "Forbidden: missing permission "+perm, http.StatusForbidden)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		if cookie, err := r.Cookie("admin_session"); err == nil && validateSession(cookie.Value) {
+			next(w, r)
+			return
+		}
+
+		if !cfg.IsAuthenticated(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if _, err := r.Cookie("admin_session"); err != nil {
+			setSessionCookie(w)
+		}
+		next(w, r)
+	}
+}
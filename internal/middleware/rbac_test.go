@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"orchids-api/internal/config"
+	"orchids-api/internal/store"
+)
+
+func testConfig() *config.Config {
+	cfg := &config.Config{AdminUser: "admin", AdminPass: "adminpass"}
+	cfg.TLS.AuthType = config.AuthTypePassword
+	return cfg
+}
+
+func TestRequirePermissionAllowsAdminWithPermission(t *testing.T) {
+	s, err := store.New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	if err := s.BootstrapSuperadmin("root", "toor"); err != nil {
+		t.Fatalf("BootstrapSuperadmin failed: %v", err)
+	}
+	admin, err := s.GetAdminByUsername("root")
+	if err != nil {
+		t.Fatalf("GetAdminByUsername failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	if err := BindAdminSession(rec, admin.ID); err != nil {
+		t.Fatalf("BindAdminSession failed: %v", err)
+	}
+
+	called := false
+	handler := RequirePermission(testConfig(), s, "accounts.write", func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/export", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if !called {
+		t.Fatal("handler should be called for an admin with the required permission")
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRequirePermissionRejectsAdminMissingPermission(t *testing.T) {
+	s, err := store.New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	admin, err := s.CreateAdmin("limited", "pw")
+	if err != nil {
+		t.Fatalf("CreateAdmin failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	if err := BindAdminSession(rec, admin.ID); err != nil {
+		t.Fatalf("BindAdminSession failed: %v", err)
+	}
+
+	called := false
+	handler := RequirePermission(testConfig(), s, "settings.admin", func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if called {
+		t.Fatal("handler should not be called for an admin lacking the required permission")
+	}
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestRequirePermissionFallsBackToLegacyBasicAuth(t *testing.T) {
+	s, err := store.New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	called := false
+	handler := RequirePermission(testConfig(), s, "settings.admin", func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+	req.SetBasicAuth("admin", "adminpass")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if !called {
+		t.Fatal("a valid shared admin/password login should still be let through by RequirePermission")
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRequirePermissionRejectsUnauthenticated(t *testing.T) {
+	s, err := store.New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	called := false
+	handler := RequirePermission(testConfig(), s, "settings.admin", func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if called {
+		t.Fatal("handler should not be called without any credentials")
+	}
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,74 @@
+// Package modelroute 解析 MODEL_ROUTE_MAP 这样的环境变量，把模型名路由到具体的
+// provider 适配器和上游 API 版本，支持在不重启进程的情况下通过 SIGHUP 热重载
+package modelroute
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Route 是一个模型名解析出来的路由目标
+type Route struct {
+	Provider string
+	Version  string
+}
+
+// Table 是一张可并发读、可热重载的模型路由表
+type Table struct {
+	mu     sync.RWMutex
+	routes map[string]Route
+}
+
+// Load 从 MODEL_ROUTE_MAP 环境变量解析出一张路由表；格式是逗号分隔的
+// "model:provider/version" 条目，例如
+// "claude-3-5-sonnet:anthropic/v1,qwen2:ollama/v1,gpt-4o:openai/v1"；
+// 环境变量未设置或条目格式不对时该条目被跳过，不影响其它条目
+func Load() *Table {
+	t := &Table{routes: make(map[string]Route)}
+	t.reloadLocked(os.Getenv("MODEL_ROUTE_MAP"))
+	return t
+}
+
+// Reload 重新读取 MODEL_ROUTE_MAP 环境变量并整体替换路由表，供 SIGHUP 处理逻辑调用
+func (t *Table) Reload() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reloadLocked(os.Getenv("MODEL_ROUTE_MAP"))
+}
+
+func (t *Table) reloadLocked(raw string) {
+	routes := make(map[string]Route)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, target, ok := strings.Cut(entry, ":")
+		if !ok {
+			log.Printf("[modelroute] 忽略格式不对的条目: %q", entry)
+			continue
+		}
+		provider, version, _ := strings.Cut(target, "/")
+		model = strings.TrimSpace(model)
+		provider = strings.TrimSpace(provider)
+		version = strings.TrimSpace(version)
+		if model == "" || provider == "" {
+			log.Printf("[modelroute] 忽略格式不对的条目: %q", entry)
+			continue
+		}
+		routes[model] = Route{Provider: provider, Version: version}
+	}
+	t.routes = routes
+	log.Printf("[modelroute] 路由表已加载，共 %d 条", len(routes))
+}
+
+// Resolve 按模型名查路由表；没有命中时返回 ok=false，调用方应该回退到默认的
+// provider/version 选择逻辑
+func (t *Table) Resolve(model string) (Route, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	route, ok := t.routes[model]
+	return route, ok
+}
@@ -0,0 +1,498 @@
+package prompt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OpenAIMessage 对应 OpenAI Chat Completions 的一条 message；Content 在请求里可能是
+// string 也可能是多段 []interface{}（text/image_url 混排），跟 MessageContent 自定义
+// UnmarshalJSON 要处理的情况是一回事，这里偷懒直接用 interface{}，转换函数里按类型断言
+type OpenAIMessage struct {
+	Role       string           `json:"role"`
+	Content    interface{}      `json:"content,omitempty"`
+	Name       string           `json:"name,omitempty"`
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type OpenAIFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type OpenAIToolCall struct {
+	ID       string             `json:"id"`
+	Type     string             `json:"type"`
+	Function OpenAIFunctionCall `json:"function"`
+}
+
+// OpenAIFunction 描述一个可调用的函数；同时供新版 tools 和旧版顶层 functions 字段使用
+type OpenAIFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type OpenAITool struct {
+	Type     string         `json:"type"`
+	Function OpenAIFunction `json:"function"`
+}
+
+type OpenAIResponseFormat struct {
+	Type string `json:"type"`
+}
+
+// OpenAIChatRequest 是 ClaudeAPIRequest 的 OpenAI Chat Completions 对应物，供
+// ClaudeToOpenAI/OpenAIToClaude 互转；Functions 是 tools 出现之前的旧字段，部分客户端
+// （尤其是老版本 SDK）还在用，两边都解析，合并进 Claude 的 Tools
+type OpenAIChatRequest struct {
+	Model          string                `json:"model"`
+	Messages       []OpenAIMessage       `json:"messages"`
+	Tools          []OpenAITool          `json:"tools,omitempty"`
+	Functions      []OpenAIFunction      `json:"functions,omitempty"`
+	Stream         bool                  `json:"stream,omitempty"`
+	ResponseFormat *OpenAIResponseFormat `json:"response_format,omitempty"`
+}
+
+// OpenAIFinishReason 把 Anthropic 的 stop_reason 映射成 OpenAI 的 finish_reason；
+// 非流式（convertClaudeToOpenAI 风格的响应转换）和流式（OpenAIStreamState）都用这一份
+func OpenAIFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return "stop"
+	}
+}
+
+// ClaudeToOpenAI 把一个 Claude 形状的请求转换成 OpenAI Chat Completions 形状；
+// system 数组拼成一条 system 消息，tool_use/tool_result 块分别拆成 assistant 的
+// tool_calls 和单独的 role=tool 消息，image 块转成 image_url part
+func ClaudeToOpenAI(req ClaudeAPIRequest) OpenAIChatRequest {
+	var messages []OpenAIMessage
+
+	if sysText := foldSystem(req.System); sysText != "" {
+		messages = append(messages, OpenAIMessage{Role: "system", Content: sysText})
+	}
+
+	for _, msg := range req.Messages {
+		messages = append(messages, claudeMessageToOpenAI(msg)...)
+	}
+
+	return OpenAIChatRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Tools:    claudeToolsToOpenAI(req.Tools),
+		Stream:   req.Stream,
+	}
+}
+
+// OpenAIToClaude 是 ClaudeToOpenAI 的反向转换
+func OpenAIToClaude(req OpenAIChatRequest) ClaudeAPIRequest {
+	var messages []Message
+	var system []SystemItem
+
+	for _, msg := range req.Messages {
+		if msg.Role == "system" {
+			if text, ok := msg.Content.(string); ok && text != "" {
+				system = append(system, SystemItem{Type: "text", Text: text})
+			}
+			continue
+		}
+
+		if msg.Role == "tool" {
+			messages = append(messages, Message{
+				Role: "user",
+				Content: MessageContent{Blocks: []ContentBlock{{
+					Type:      "tool_result",
+					ToolUseID: msg.ToolCallID,
+					Content:   msg.Content,
+				}}},
+			})
+			continue
+		}
+
+		var blocks []ContentBlock
+		switch c := msg.Content.(type) {
+		case string:
+			if len(msg.ToolCalls) == 0 {
+				messages = append(messages, Message{Role: msg.Role, Content: MessageContent{Text: c}})
+				continue
+			}
+			if c != "" {
+				blocks = append(blocks, ContentBlock{Type: "text", Text: c})
+			}
+		case []interface{}:
+			for _, item := range c {
+				part, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				switch part["type"] {
+				case "text":
+					text, _ := part["text"].(string)
+					blocks = append(blocks, ContentBlock{Type: "text", Text: text})
+				case "image_url":
+					if block := openAIImagePartToBlock(part); block != nil {
+						blocks = append(blocks, *block)
+					}
+				}
+			}
+		}
+
+		for _, tc := range msg.ToolCalls {
+			var input interface{}
+			_ = json.Unmarshal([]byte(tc.Function.Arguments), &input)
+			blocks = append(blocks, ContentBlock{
+				Type:  "tool_use",
+				ID:    tc.ID,
+				Name:  tc.Function.Name,
+				Input: input,
+			})
+		}
+
+		if len(blocks) > 0 {
+			messages = append(messages, Message{Role: msg.Role, Content: MessageContent{Blocks: blocks}})
+		}
+	}
+
+	return ClaudeAPIRequest{
+		Model:    req.Model,
+		Messages: messages,
+		System:   system,
+		Tools:    openAIToolsToClaudeTools(req.Tools, req.Functions),
+		Stream:   req.Stream,
+	}
+}
+
+func foldSystem(items []SystemItem) string {
+	var parts []string
+	for _, it := range items {
+		if it.Type == "text" && it.Text != "" {
+			parts = append(parts, it.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func claudeMessageToOpenAI(msg Message) []OpenAIMessage {
+	if msg.Content.IsString() {
+		text := msg.Content.GetText()
+		if text == "" {
+			return nil
+		}
+		return []OpenAIMessage{{Role: msg.Role, Content: text}}
+	}
+
+	var out []OpenAIMessage
+	var parts []interface{}
+	var toolCalls []OpenAIToolCall
+
+	flush := func() {
+		if len(parts) == 0 && len(toolCalls) == 0 {
+			return
+		}
+		m := OpenAIMessage{Role: msg.Role}
+		if len(parts) == 1 {
+			if p, ok := parts[0].(map[string]interface{}); ok && p["type"] == "text" {
+				m.Content = p["text"]
+			} else {
+				m.Content = parts
+			}
+		} else if len(parts) > 1 {
+			m.Content = parts
+		}
+		if len(toolCalls) > 0 {
+			m.ToolCalls = toolCalls
+		}
+		out = append(out, m)
+		parts = nil
+		toolCalls = nil
+	}
+
+	for _, block := range msg.Content.GetBlocks() {
+		switch block.Type {
+		case "text":
+			if block.Text != "" {
+				parts = append(parts, map[string]interface{}{"type": "text", "text": block.Text})
+			}
+		case "image":
+			if part := imageBlockToOpenAIPart(block); part != nil {
+				parts = append(parts, part)
+			}
+		case "tool_use":
+			args, _ := json.Marshal(block.Input)
+			toolCalls = append(toolCalls, OpenAIToolCall{
+				ID:   block.ID,
+				Type: "function",
+				Function: OpenAIFunctionCall{
+					Name:      block.Name,
+					Arguments: string(args),
+				},
+			})
+		case "tool_result":
+			flush()
+			out = append(out, OpenAIMessage{
+				Role:       "tool",
+				ToolCallID: block.ToolUseID,
+				Content:    serializeContent(block.Content),
+			})
+		}
+	}
+	flush()
+	return out
+}
+
+// imageBlockToOpenAIPart 把一个 Claude image 块转成 OpenAI 的 image_url part；
+// base64 块编成 data URL，url 块原样透传
+func imageBlockToOpenAIPart(block ContentBlock) map[string]interface{} {
+	if block.Source == nil {
+		return nil
+	}
+	var url string
+	switch block.Source.Type {
+	case "base64":
+		if block.Source.Data == "" {
+			return nil
+		}
+		mediaType := block.Source.MediaType
+		if mediaType == "" {
+			mediaType = "image/png"
+		}
+		url = fmt.Sprintf("data:%s;base64,%s", mediaType, block.Source.Data)
+	case "url":
+		if block.Source.URL == "" {
+			return nil
+		}
+		url = block.Source.URL
+	default:
+		return nil
+	}
+	return map[string]interface{}{
+		"type":      "image_url",
+		"image_url": map[string]string{"url": url},
+	}
+}
+
+// openAIImagePartToBlock 是 imageBlockToOpenAIPart 的反向转换；data URL 拆回
+// base64+media_type，其他 URL 当作远程图片保留原样，上游/本地工具谁用谁自己去拉取
+func openAIImagePartToBlock(part map[string]interface{}) *ContentBlock {
+	imageURL, _ := part["image_url"].(map[string]interface{})
+	url, _ := imageURL["url"].(string)
+	if url == "" {
+		return nil
+	}
+	if strings.HasPrefix(url, "data:") {
+		rest := strings.TrimPrefix(url, "data:")
+		meta, data, ok := strings.Cut(rest, ",")
+		if !ok {
+			return nil
+		}
+		mediaType := strings.TrimSuffix(meta, ";base64")
+		return &ContentBlock{
+			Type:   "image",
+			Source: &ImageSource{Type: "base64", MediaType: mediaType, Data: data},
+		}
+	}
+	return &ContentBlock{
+		Type:   "image",
+		Source: &ImageSource{Type: "url", URL: url},
+	}
+}
+
+func claudeToolsToOpenAI(tools []interface{}) []OpenAITool {
+	var out []OpenAITool
+	for _, t := range tools {
+		tm, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := tm["name"].(string)
+		if name == "" {
+			continue
+		}
+		desc, _ := tm["description"].(string)
+		schema, _ := tm["input_schema"].(map[string]interface{})
+		out = append(out, OpenAITool{
+			Type: "function",
+			Function: OpenAIFunction{
+				Name:        name,
+				Description: desc,
+				Parameters:  schema,
+			},
+		})
+	}
+	return out
+}
+
+// openAIToolsToClaudeTools 把新版 tools 和旧版 functions 都折进同一个 Claude 工具列表；
+// 两者并不会同时出现在一个真实请求里，但处理逻辑上没必要互斥
+func openAIToolsToClaudeTools(tools []OpenAITool, functions []OpenAIFunction) []interface{} {
+	var out []interface{}
+	for _, t := range tools {
+		out = append(out, map[string]interface{}{
+			"name":         t.Function.Name,
+			"description":  t.Function.Description,
+			"input_schema": t.Function.Parameters,
+		})
+	}
+	for _, f := range functions {
+		out = append(out, map[string]interface{}{
+			"name":         f.Name,
+			"description":  f.Description,
+			"input_schema": f.Parameters,
+		})
+	}
+	return out
+}
+
+// BuildPromptV2OpenAI 和 BuildPromptV2 渲染的是同一份内容（client system + 代理指令 +
+// 可用工具 + 历史 + 当前请求），只是不折成一个字符串，而是按 OpenAI chat 的角色拆成
+// messages 数组。providers 包不调用它：OpenAIChatProvider 仍把拼好的整段 prompt 作为
+// 一条 user 消息发给上游
+func BuildPromptV2OpenAI(req ClaudeAPIRequest) []OpenAIMessage {
+	var systemParts []string
+	if sysText := foldSystem(req.System); sysText != "" {
+		systemParts = append(systemParts, sysText)
+	}
+	systemParts = append(systemParts, systemPreset)
+	if len(req.Tools) > 0 {
+		if toolsDesc := FormatToolsForPrompt(req.Tools); toolsDesc != "" {
+			systemParts = append(systemParts, fmt.Sprintf("可用工具:\n%s", toolsDesc))
+		}
+	}
+
+	messages := []OpenAIMessage{{Role: "system", Content: strings.Join(systemParts, "\n\n")}}
+
+	if history := FormatMessagesAsMarkdown(req.Messages); history != "" {
+		messages = append(messages, OpenAIMessage{
+			Role:    "user",
+			Content: fmt.Sprintf("<conversation_history>\n%s\n</conversation_history>", history),
+		})
+	}
+
+	var currentRequest string
+	if len(req.Messages) > 0 {
+		lastMsg := req.Messages[len(req.Messages)-1]
+		if lastMsg.Role == "user" {
+			currentRequest = formatUserMessage(lastMsg.Content)
+			images := ExtractImages(lastMsg.Content)
+			if len(images) > 0 {
+				var imgTags []string
+				for _, img := range images {
+					imgTags = append(imgTags, ImageToBase64Tag(img))
+				}
+				currentRequest += "\n" + strings.Join(imgTags, "\n")
+			}
+		}
+	}
+	if strings.TrimSpace(currentRequest) == "" {
+		currentRequest = "继续"
+	}
+	messages = append(messages, OpenAIMessage{Role: "user", Content: currentRequest})
+
+	return messages
+}
+
+// OpenAIStreamState 把 HandleMessages 写出的一串 Anthropic SSE 事件，增量翻译成
+// OpenAI chat.completion.chunk 帧；只负责"事件 -> 帧"的映射，不管 SSE 分帧/flush/写
+// 到哪个连接——那些是调用方（比如 handler.openAIStreamWriter）的事，这样翻译逻辑和
+// I/O 不用耦合在一起，也不用在别的地方重复实现一遍
+type OpenAIStreamState struct {
+	id        string
+	created   int64
+	model     string
+	sentRole  bool
+	toolIndex map[int]int
+	nextTool  int
+}
+
+func NewOpenAIStreamState(model string) *OpenAIStreamState {
+	return &OpenAIStreamState{
+		id:        fmt.Sprintf("chatcmpl-%d", time.Now().UnixMilli()),
+		created:   time.Now().Unix(),
+		model:     model,
+		toolIndex: make(map[int]int),
+	}
+}
+
+// TranslateEvent 翻译一个已经解码好的 SSE 事件（event 名 + data JSON），返回零到多个
+// 待写出的帧；done=true 表示上游已经结束（message_stop），调用方应紧接着写
+// "data: [DONE]\n\n"。错误事件也走这里，返回的帧形状是 {"error": {...}}，不是
+// chat.completion.chunk，调用方原样序列化写出即可，不用特殊分支
+func (s *OpenAIStreamState) TranslateEvent(event string, payload map[string]interface{}) (frames []map[string]interface{}, done bool) {
+	switch event {
+	case "content_block_start":
+		block, _ := payload["content_block"].(map[string]interface{})
+		if blockType, _ := block["type"].(string); blockType == "tool_use" {
+			idx, _ := payload["index"].(float64)
+			toolIdx := s.nextTool
+			s.nextTool++
+			s.toolIndex[int(idx)] = toolIdx
+			name, _ := block["name"].(string)
+			id, _ := block["id"].(string)
+			frames = append(frames, s.chunk(map[string]interface{}{
+				"tool_calls": []map[string]interface{}{{
+					"index": toolIdx, "id": id, "type": "function",
+					"function": map[string]interface{}{"name": name, "arguments": ""},
+				}},
+			}, ""))
+		}
+	case "content_block_delta":
+		delta, _ := payload["delta"].(map[string]interface{})
+		switch delta["type"] {
+		case "text_delta":
+			if text, _ := delta["text"].(string); text != "" {
+				frames = append(frames, s.chunk(map[string]interface{}{"content": text}, ""))
+			}
+		case "input_json_delta":
+			idx, _ := payload["index"].(float64)
+			toolIdx := s.toolIndex[int(idx)]
+			partial, _ := delta["partial_json"].(string)
+			frames = append(frames, s.chunk(map[string]interface{}{
+				"tool_calls": []map[string]interface{}{{
+					"index":    toolIdx,
+					"function": map[string]interface{}{"arguments": partial},
+				}},
+			}, ""))
+		}
+	case "message_delta":
+		delta, _ := payload["delta"].(map[string]interface{})
+		if stopReason, _ := delta["stop_reason"].(string); stopReason != "" {
+			frames = append(frames, s.chunk(map[string]interface{}{}, OpenAIFinishReason(stopReason)))
+		}
+	case "message_stop":
+		done = true
+	case "error":
+		message, _ := payload["message"].(string)
+		if message == "" {
+			message = "upstream error"
+		}
+		frames = append(frames, map[string]interface{}{
+			"error": map[string]interface{}{"message": message, "type": "upstream_error"},
+		})
+	}
+	return frames, done
+}
+
+func (s *OpenAIStreamState) chunk(delta map[string]interface{}, finishReason string) map[string]interface{} {
+	if !s.sentRole {
+		delta["role"] = "assistant"
+		s.sentRole = true
+	}
+	var finishValue interface{}
+	if finishReason != "" {
+		finishValue = finishReason
+	}
+	return map[string]interface{}{
+		"id": s.id, "object": "chat.completion.chunk", "created": s.created, "model": s.model,
+		"choices": []map[string]interface{}{{
+			"index": 0, "delta": delta, "finish_reason": finishValue,
+		}},
+	}
+}
@@ -414,42 +414,3 @@ func BuildPromptV2(req ClaudeAPIRequest) string {
 
 	return strings.Join(sections, "\n\n")
 }
-
-func SummarizeHistory(messages []Message, maxTokens int) []Message {
-	if len(messages) <= 10 {
-		return messages
-	}
-	kept := messages[len(messages)-10:]
-	older := messages[:len(messages)-10]
-
-	var summaryParts []string
-	for _, msg := range older {
-		var text string
-		if msg.Content.IsString() {
-			text = msg.Content.GetText()
-		} else {
-			for _, b := range msg.Content.GetBlocks() {
-				if b.Type == "text" {
-					text += b.Text + " "
-				}
-			}
-		}
-		if len(text) > 200 {
-			text = text[:200] + "..."
-		}
-		if text != "" {
-			summaryParts = append(summaryParts, fmt.Sprintf("[%s]: %s", msg.Role, strings.TrimSpace(text)))
-		}
-	}
-
-	if len(summaryParts) > 0 {
-		summaryText := "Earlier conversation summary:\n" + strings.Join(summaryParts, "\n")
-		summaryMsg := Message{
-			Role:    "user",
-			Content: MessageContent{Text: summaryText},
-		}
-		return append([]Message{summaryMsg}, kept...)
-	}
-
-	return kept
-}
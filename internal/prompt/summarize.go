@@ -0,0 +1,269 @@
+package prompt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Tokenizer 估算一段文本消耗多少 token；SummarizeHistoryWithOptions 用它来判断历史
+// 消息是否还装得进 MaxTokens 预算。默认实现只是 len(text)/4 的粗略估计（非空文本至少
+// 记 1），不经过 internal/tiktoken 的 BPE 分词；需要更准的估算时调用方可以实现这个接口
+// 换成真正的分词器
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+type approxTokenizer struct{}
+
+func (approxTokenizer) CountTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	n := len(text) / 4
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
+
+// DefaultTokenizer 是 SummarizeHistory/SummarizeHistoryWithOptions 在没指定 Tokenizer
+// 时用的估算器
+var DefaultTokenizer Tokenizer = approxTokenizer{}
+
+// Summarizer 把一段要被丢弃的历史消息压缩成一段摘要文本；调用方可以接到一个便宜的模型上，
+// 不传时退化成 naiveSummarize 的字符串截断
+type Summarizer func(ctx context.Context, messages []Message) (string, error)
+
+// SummaryCache 缓存 Summarizer 的输出，key 是 summaryCacheKey 算出的摘要内容哈希；
+// 同一段历史前缀被反复摘要时（比如同一个会话连续发了好几轮新消息）可以直接命中，不用
+// 每次都真的跑一遍 Summarizer
+type SummaryCache interface {
+	Get(key string) (string, bool)
+	Set(key, value string)
+}
+
+// MemorySummaryCache 是 SummaryCache 的进程内实现，没有过期和容量上限——摘要缓存的
+// 条目数跟着"被截断过的历史前缀"走，量级跟会话数相当，不会无限增长到需要淘汰
+type MemorySummaryCache struct {
+	mu    sync.RWMutex
+	items map[string]string
+}
+
+func NewMemorySummaryCache() *MemorySummaryCache {
+	return &MemorySummaryCache{items: make(map[string]string)}
+}
+
+func (c *MemorySummaryCache) Get(key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.items[key]
+	return v, ok
+}
+
+func (c *MemorySummaryCache) Set(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = value
+}
+
+// SummarizeOptions 配置 SummarizeHistoryWithOptions 的行为；除 MaxTokens 外都是可选的，
+// 零值时退化成 DefaultTokenizer + naiveSummarize + 不缓存
+type SummarizeOptions struct {
+	MaxTokens  int
+	Tokenizer  Tokenizer
+	Summarizer Summarizer
+	Cache      SummaryCache
+}
+
+// SummarizeHistory 是 SummarizeHistoryWithOptions 的简化入口，保留原有签名不变；
+// 不传 Summarizer/Cache 时退化成按 token 预算丢消息、裁剪文本拼摘要，跟旧版行为的
+// 区别只是现在真的尊重 maxTokens，并且不会把 tool_use 和对应的 tool_result 拆散
+func SummarizeHistory(messages []Message, maxTokens int) []Message {
+	return SummarizeHistoryWithOptions(context.Background(), messages, SummarizeOptions{MaxTokens: maxTokens})
+}
+
+// SummarizeHistoryWithOptions 保留最近 10 条消息原样（第一条是 tool_result 时连同它的
+// tool_use 共 11 条），其余按 token 预算从新到旧尽量
+// 保留完整的消息单元（tool_use/tool_result 这类配对消息算一个单元，要么一起留要么一起
+// 丢），装不下的最老一批消息压缩成一条摘要消息插在最前面
+func SummarizeHistoryWithOptions(ctx context.Context, messages []Message, opts SummarizeOptions) []Message {
+	if len(messages) <= 10 {
+		return messages
+	}
+
+	tokenizer := opts.Tokenizer
+	if tokenizer == nil {
+		tokenizer = DefaultTokenizer
+	}
+
+	split := len(messages) - 10
+	// 最近 10 条的第一条若是 tool_result，把它前面那条 tool_use 也留下，不拆散这一对
+	if messages[split].Role == "user" && messageHasBlockType(messages[split], "tool_result") &&
+		messages[split-1].Role == "assistant" && messageHasBlockType(messages[split-1], "tool_use") {
+		split--
+	}
+	kept := messages[split:]
+	older := messages[:split]
+
+	units := groupIntoUnits(older)
+
+	keptTokens := 0
+	for _, m := range kept {
+		keptTokens += messageTokens(m, tokenizer)
+	}
+
+	budget := opts.MaxTokens - keptTokens
+	if budget < 0 {
+		budget = 0
+	}
+
+	numKeptUnits := 0
+	used := 0
+	for i := len(units) - 1; i >= 0; i-- {
+		t := 0
+		for _, m := range units[i] {
+			t += messageTokens(m, tokenizer)
+		}
+		if used+t > budget {
+			break
+		}
+		used += t
+		numKeptUnits++
+	}
+
+	if numKeptUnits == len(units) {
+		return messages
+	}
+
+	droppedUnits := units[:len(units)-numKeptUnits]
+	keptOlderUnits := units[len(units)-numKeptUnits:]
+
+	var dropped []Message
+	for _, u := range droppedUnits {
+		dropped = append(dropped, u...)
+	}
+
+	result := make([]Message, 0, 1+len(dropped)+len(kept))
+	result = append(result, summarizeDropped(ctx, dropped, tokenizer, opts))
+	for _, u := range keptOlderUnits {
+		result = append(result, u...)
+	}
+	result = append(result, kept...)
+	return result
+}
+
+// groupIntoUnits 把消息切成不可再拆的单元：一条带 tool_use 的 assistant 消息，后面
+// 紧跟着一条带 tool_result 的 user 消息，这两条必须作为同一个单元一起保留或一起丢弃，
+// 否则下游会看到一个没有结果的工具调用，或者一个对不上号的工具结果
+func groupIntoUnits(messages []Message) [][]Message {
+	var units [][]Message
+	for i := 0; i < len(messages); i++ {
+		if messageHasBlockType(messages[i], "tool_use") && messages[i].Role == "assistant" &&
+			i+1 < len(messages) && messages[i+1].Role == "user" && messageHasBlockType(messages[i+1], "tool_result") {
+			units = append(units, []Message{messages[i], messages[i+1]})
+			i++
+			continue
+		}
+		units = append(units, []Message{messages[i]})
+	}
+	return units
+}
+
+func messageHasBlockType(m Message, blockType string) bool {
+	for _, b := range m.Content.GetBlocks() {
+		if b.Type == blockType {
+			return true
+		}
+	}
+	return false
+}
+
+func messageTokens(m Message, tokenizer Tokenizer) int {
+	if m.Content.IsString() {
+		return tokenizer.CountTokens(m.Content.GetText())
+	}
+	total := 0
+	for _, b := range m.Content.GetBlocks() {
+		switch b.Type {
+		case "text":
+			total += tokenizer.CountTokens(b.Text)
+		case "thinking":
+			total += tokenizer.CountTokens(b.Thinking)
+		case "tool_use":
+			input, _ := json.Marshal(b.Input)
+			total += tokenizer.CountTokens(string(input))
+		case "tool_result":
+			total += tokenizer.CountTokens(serializeContent(b.Content))
+		}
+	}
+	return total
+}
+
+func summarizeDropped(ctx context.Context, dropped []Message, tokenizer Tokenizer, opts SummarizeOptions) Message {
+	var cacheKey string
+	if opts.Cache != nil {
+		cacheKey = summaryCacheKey(dropped)
+		if cached, ok := opts.Cache.Get(cacheKey); ok {
+			return Message{Role: "user", Content: MessageContent{Text: cached}}
+		}
+	}
+
+	summaryText := ""
+	if opts.Summarizer != nil {
+		if text, err := opts.Summarizer(ctx, dropped); err == nil && text != "" {
+			summaryText = text
+		}
+	}
+	if summaryText == "" {
+		summaryText = naiveSummarize(dropped)
+	}
+
+	if opts.Cache != nil {
+		opts.Cache.Set(cacheKey, summaryText)
+	}
+
+	return Message{Role: "user", Content: MessageContent{Text: summaryText}}
+}
+
+// summaryCacheKey 用被摘要的消息内容算一个稳定哈希；Message 本身没有 ID 字段，内容
+// 的哈希就是事实上的"消息 ID"，同一段历史前缀每次算出来的 key 都一样
+func summaryCacheKey(messages []Message) string {
+	data, _ := json.Marshal(messages)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// naiveSummarize 是没有配置 Summarizer 时的退路：按旧版 SummarizeHistory 的方式把
+// 每条消息的文本掐头去尾拼成一份摘要，只是现在只对真正要丢弃的消息做，而不是无视
+// MaxTokens 把除最近 10 条外的所有消息都压进来
+func naiveSummarize(messages []Message) string {
+	var summaryParts []string
+	for _, msg := range messages {
+		var text string
+		if msg.Content.IsString() {
+			text = msg.Content.GetText()
+		} else {
+			for _, b := range msg.Content.GetBlocks() {
+				if b.Type == "text" {
+					text += b.Text + " "
+				}
+			}
+		}
+		if len(text) > 200 {
+			text = text[:200] + "..."
+		}
+		if text != "" {
+			summaryParts = append(summaryParts, fmt.Sprintf("[%s]: %s", msg.Role, strings.TrimSpace(text)))
+		}
+	}
+
+	if len(summaryParts) == 0 {
+		return ""
+	}
+	return "Earlier conversation summary:\n" + strings.Join(summaryParts, "\n")
+}
@@ -0,0 +1,147 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"orchids-api/internal/client"
+	"orchids-api/internal/debug"
+	"orchids-api/internal/store"
+	"orchids-api/internal/upstreamerr"
+)
+
+const defaultOllamaEndpoint = "http://localhost:11434"
+
+var ollamaHTTPClient = &http.Client{
+	Timeout: 120 * time.Second,
+}
+
+// OllamaProvider 把渲染好的 prompt 转发给本地/自托管的 Ollama /api/chat 接口，把它的
+// NDJSON 流翻译成 SendRequest 约定的 text-start/text-delta/text-end/finish 事件
+type OllamaProvider struct {
+	endpoint string
+	model    string
+}
+
+func NewOllamaProvider(acc *store.Account) *OllamaProvider {
+	endpoint := strings.TrimSuffix(acc.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = defaultOllamaEndpoint
+	}
+	return &OllamaProvider{endpoint: endpoint, model: acc.AgentMode}
+}
+
+type ollamaChatRequest struct {
+	Model    string              `json:"model"`
+	Messages []ollamaChatMessage `json:"messages"`
+	Stream   bool                `json:"stream"`
+}
+
+type ollamaChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaChatChunk struct {
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+}
+
+func (p *OllamaProvider) SendRequest(ctx context.Context, prompt string, chatHistory []interface{}, model string, onMessage func(client.SSEMessage), logger *debug.Logger) error {
+	upstreamModel := p.model
+	if upstreamModel == "" {
+		upstreamModel = model
+	}
+
+	payload := ollamaChatRequest{
+		Model:    upstreamModel,
+		Messages: []ollamaChatMessage{{Role: "user", Content: prompt}},
+		Stream:   true,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	url := p.endpoint + "/api/chat"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if logger != nil {
+		logger.LogUpstreamRequest(url, map[string]string{"Content-Type": "application/json"}, payload)
+	}
+
+	resp, err := ollamaHTTPClient.Do(req)
+	if err != nil {
+		return upstreamerr.FromError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return upstreamerr.FromResponse(resp, readBodySnippet(resp))
+	}
+
+	emitTextStart(onMessage)
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		select {
+		case <-ctx.Done():
+			return upstreamerr.FromError(ctx.Err())
+		default:
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var chunk ollamaChatChunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			continue
+		}
+
+		if logger != nil {
+			logger.LogUpstreamSSE("ollama.chat", line)
+		}
+
+		if chunk.Message.Content != "" {
+			emitTextDelta(onMessage, chunk.Message.Content)
+		}
+
+		if chunk.Done {
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return upstreamerr.FromError(err)
+	}
+
+	emitTextEnd(onMessage)
+	emitFinish(onMessage, "stop")
+
+	return nil
+}
+
+func readBodySnippet(resp *http.Response) []byte {
+	buf := make([]byte, 4*1024)
+	n, _ := resp.Body.Read(buf)
+	return buf[:n]
+}
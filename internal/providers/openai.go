@@ -0,0 +1,157 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"orchids-api/internal/client"
+	"orchids-api/internal/debug"
+	"orchids-api/internal/store"
+	"orchids-api/internal/upstreamerr"
+)
+
+const defaultOpenAIEndpoint = "https://api.openai.com/v1"
+
+var openAIHTTPClient = &http.Client{
+	Timeout: 120 * time.Second,
+}
+
+// OpenAIChatProvider 把渲染好的 prompt 转发给任意 OpenAI 兼容的 /chat/completions
+// 接口（流式 SSE），翻译成 SendRequest 约定的 text-start/text-delta/text-end/finish 事件
+type OpenAIChatProvider struct {
+	endpoint string
+	model    string
+	apiKey   string
+}
+
+func NewOpenAIChatProvider(acc *store.Account) *OpenAIChatProvider {
+	endpoint := strings.TrimSuffix(acc.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = defaultOpenAIEndpoint
+	}
+	return &OpenAIChatProvider{endpoint: endpoint, model: acc.AgentMode, apiKey: acc.SessionID}
+}
+
+type openAIChatRequest struct {
+	Model    string              `json:"model"`
+	Messages []openAIChatMessage `json:"messages"`
+	Stream   bool                `json:"stream"`
+}
+
+type openAIChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChatChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+func (p *OpenAIChatProvider) SendRequest(ctx context.Context, prompt string, chatHistory []interface{}, model string, onMessage func(client.SSEMessage), logger *debug.Logger) error {
+	upstreamModel := p.model
+	if upstreamModel == "" {
+		upstreamModel = model
+	}
+
+	payload := openAIChatRequest{
+		Model:    upstreamModel,
+		Messages: []openAIChatMessage{{Role: "user", Content: prompt}},
+		Stream:   true,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	url := p.endpoint + "/chat/completions"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	if logger != nil {
+		logger.LogUpstreamRequest(url, map[string]string{
+			"Accept":        "text/event-stream",
+			"Content-Type":  "application/json",
+			"Authorization": "Bearer [REDACTED]",
+		}, payload)
+	}
+
+	resp, err := openAIHTTPClient.Do(req)
+	if err != nil {
+		return upstreamerr.FromError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return upstreamerr.FromResponse(resp, readBodySnippet(resp))
+	}
+
+	emitTextStart(onMessage)
+
+	finishReason := "stop"
+	reader := bufio.NewReader(resp.Body)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return upstreamerr.FromError(ctx.Err())
+		default:
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		rawData := strings.TrimPrefix(line, "data: ")
+
+		if logger != nil {
+			logger.LogUpstreamSSE("openai.chat.completion.chunk", rawData)
+		}
+
+		if rawData == "[DONE]" {
+			break
+		}
+
+		var chunk openAIChatChunk
+		if err := json.Unmarshal([]byte(rawData), &chunk); err != nil {
+			continue
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		if delta := chunk.Choices[0].Delta.Content; delta != "" {
+			emitTextDelta(onMessage, delta)
+		}
+		if reason := chunk.Choices[0].FinishReason; reason != "" {
+			finishReason = reason
+		}
+	}
+
+	emitTextEnd(onMessage)
+	emitFinish(onMessage, finishReason)
+
+	return nil
+}
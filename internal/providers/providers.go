@@ -0,0 +1,66 @@
+// Package providers 让账号指向 Anthropic 之外的上游（目前是本地/自托管的 Ollama、
+// 以及任意 OpenAI 兼容的 /v1/chat/completions 服务），而不用改动 handler 里围绕
+// UpstreamClient 建立的重试、计费、工具循环等逻辑。Provider 接口的方法签名和
+// handler.UpstreamClient 完全一致，靠 Go 的结构化接口让这两边不用互相 import。
+package providers
+
+import (
+	"context"
+
+	"orchids-api/internal/client"
+	"orchids-api/internal/debug"
+	"orchids-api/internal/store"
+)
+
+// Provider 是单条渲染好的 prompt 发给某个非 Anthropic 上游、并把响应翻译成
+// client.SSEMessage 流的抽象；方法签名需要和 handler.UpstreamClient 保持结构一致
+type Provider interface {
+	SendRequest(ctx context.Context, prompt string, chatHistory []interface{}, model string, onMessage func(client.SSEMessage), logger *debug.Logger) error
+}
+
+// NewFromAccount 按账号的 Provider 字段选择具体实现；留空或 "anthropic" 的历史账号
+// 走原来的 client.NewFromAccount，行为完全不变
+func NewFromAccount(acc *store.Account) Provider {
+	return NewForProvider(acc.Provider, acc)
+}
+
+// NewForProvider 和 NewFromAccount 走同一套选择逻辑，但 provider 名字由调用方显式
+// 指定，而不是读 acc.Provider；供 internal/modelroute 按模型名路由到的 provider
+// 覆盖账号自身配置的场景使用
+func NewForProvider(providerName string, acc *store.Account) Provider {
+	switch providerName {
+	case "ollama":
+		return NewOllamaProvider(acc)
+	case "openai":
+		return NewOpenAIChatProvider(acc)
+	default:
+		return client.NewFromAccount(acc)
+	}
+}
+
+// modelEvent 组装一条 SendRequest 约定里的 "model" 类型 SSE 消息，event 字段放实际
+// 内容（text-start/text-delta/text-end/finish），调用方不用关心 client.SSEMessage 的
+// 其余字段
+func modelEvent(event map[string]interface{}) client.SSEMessage {
+	return client.SSEMessage{
+		Type:  "model",
+		Event: event,
+		Raw:   event,
+	}
+}
+
+func emitTextStart(onMessage func(client.SSEMessage)) {
+	onMessage(modelEvent(map[string]interface{}{"type": "text-start"}))
+}
+
+func emitTextDelta(onMessage func(client.SSEMessage), delta string) {
+	onMessage(modelEvent(map[string]interface{}{"type": "text-delta", "delta": delta}))
+}
+
+func emitTextEnd(onMessage func(client.SSEMessage)) {
+	onMessage(modelEvent(map[string]interface{}{"type": "text-end"}))
+}
+
+func emitFinish(onMessage func(client.SSEMessage), finishReason string) {
+	onMessage(modelEvent(map[string]interface{}{"type": "finish", "finishReason": finishReason}))
+}
@@ -0,0 +1,84 @@
+package respcache
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Layered 把一个本地一级缓存叠在一个共享的二级缓存前面：Get 先查 local，未命中再查
+// remote 并回填 local；Set/Invalidate 两级都写，保证同一副本下次 Get 不会绕过 local 直接
+// 打到 remote。remote 为 nil 时退化成纯本地缓存。
+type Layered struct {
+	local  Supplier
+	remote Supplier
+}
+
+func NewLayered(local, remote Supplier) *Layered {
+	return &Layered{local: local, remote: remote}
+}
+
+func (l *Layered) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if value, ok, err := l.local.Get(ctx, key); err == nil && ok {
+		return value, true, nil
+	}
+	if l.remote == nil {
+		return nil, false, nil
+	}
+
+	value, ok, err := l.remote.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	// 忽略回填 local 失败：远端已经给出了正确答案，本地缓存只是个优化
+	_ = l.local.Set(ctx, key, value, DefaultTTL)
+	return value, true, nil
+}
+
+func (l *Layered) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := l.local.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	if l.remote == nil {
+		return nil
+	}
+	return l.remote.Set(ctx, key, value, ttl)
+}
+
+func (l *Layered) Invalidate(ctx context.Context, key string) error {
+	if err := l.local.Invalidate(ctx, key); err != nil {
+		return err
+	}
+	if l.remote == nil {
+		return nil
+	}
+	return l.remote.Invalidate(ctx, key)
+}
+
+// NewFromEnv 按环境变量装配响应缓存：RESPCACHE_LRU_SIZE 控制本地一级缓存容量
+// （默认 1000 条），RESPCACHE_REDIS_ADDR 配置了才会叠加 Redis 作为二级缓存，否则退化为
+// 纯本地缓存——跟 config/tls.go 的 GetTLSConfig 对"未配置"的处理方式一致
+func NewFromEnv() Supplier {
+	lruSize := 1000
+	if v := os.Getenv("RESPCACHE_LRU_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			lruSize = n
+		}
+	}
+	local := NewLRU(lruSize)
+
+	addr := os.Getenv("RESPCACHE_REDIS_ADDR")
+	if addr == "" {
+		return local
+	}
+
+	db := 0
+	if v := os.Getenv("RESPCACHE_REDIS_DB"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			db = n
+		}
+	}
+	remote := NewRedis(addr, os.Getenv("RESPCACHE_REDIS_PASSWORD"), db)
+	return NewLayered(local, remote)
+}
@@ -0,0 +1,190 @@
+package respcache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Redis 是 Layered 的第二级：一个对 Redis 线协议（RESP2）的最小实现，只覆盖 GET/SET
+// PX/DEL 三条命令，不依赖任何第三方客户端库。每次调用独立建连——响应缓存命中率收益主要
+// 来自跳过账号选择和上游请求，不需要为了省一次 TCP 握手再维护一个连接池。
+type Redis struct {
+	addr         string
+	password     string
+	db           int
+	dialTimeout  time.Duration
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+// NewRedis 创建一个 Redis supplier；addr 形如 "127.0.0.1:6379"
+func NewRedis(addr, password string, db int) *Redis {
+	return &Redis{
+		addr:         addr,
+		password:     password,
+		db:           db,
+		dialTimeout:  2 * time.Second,
+		readTimeout:  500 * time.Millisecond,
+		writeTimeout: 500 * time.Millisecond,
+	}
+}
+
+func (r *Redis) dial() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", r.addr, r.dialTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(conn)
+
+	if r.password != "" {
+		if err := r.do(conn, reader, respArray("AUTH", r.password)); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		if _, err := readReply(reader); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	if r.db != 0 {
+		if err := r.do(conn, reader, respArray("SELECT", strconv.Itoa(r.db))); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		if _, err := readReply(reader); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, reader, nil
+}
+
+func (r *Redis) do(conn net.Conn, reader *bufio.Reader, payload []byte) error {
+	conn.SetWriteDeadline(time.Now().Add(r.writeTimeout))
+	_, err := conn.Write(payload)
+	return err
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	conn, reader, err := r.dial()
+	if err != nil {
+		return nil, false, err
+	}
+	defer conn.Close()
+
+	if err := r.do(conn, reader, respArray("GET", key)); err != nil {
+		return nil, false, err
+	}
+	conn.SetReadDeadline(time.Now().Add(r.readTimeout))
+	reply, err := readReply(reader)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	return reply, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	conn, reader, err := r.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ms := ttl.Milliseconds()
+	if ms <= 0 {
+		ms = DefaultTTL.Milliseconds()
+	}
+	if err := r.do(conn, reader, respArray("SET", key, string(value), "PX", strconv.FormatInt(ms, 10))); err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(r.readTimeout))
+	_, err = readReply(reader)
+	return err
+}
+
+func (r *Redis) Invalidate(ctx context.Context, key string) error {
+	conn, reader, err := r.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := r.do(conn, reader, respArray("DEL", key)); err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(r.readTimeout))
+	_, err = readReply(reader)
+	return err
+}
+
+// respArray 把一条命令编码成 RESP2 的 multi-bulk 请求格式
+func respArray(parts ...string) []byte {
+	out := fmt.Sprintf("*%d\r\n", len(parts))
+	for _, p := range parts {
+		out += fmt.Sprintf("$%d\r\n%s\r\n", len(p), p)
+	}
+	return []byte(out)
+}
+
+// readReply 只解析响应缓存用得到的四种回复类型：simple string (+)、bulk string
+// ($，-1 长度表示 nil)、error (-)、integer (:，如 DEL 的回复，按原样返回数字文本)。array 不支持。
+func readReply(reader *bufio.Reader) ([]byte, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = trimCRLF(line)
+	if len(line) == 0 {
+		return nil, fmt.Errorf("respcache: empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, fmt.Errorf("respcache: redis error: %s", line[1:])
+	case ':':
+		return []byte(line[1:]), nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("respcache: malformed bulk length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2) // 数据后面还有一个 \r\n
+		if _, err := readFull(reader, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	default:
+		return nil, fmt.Errorf("respcache: unsupported redis reply type %q", line[0])
+	}
+}
+
+func readFull(reader *bufio.Reader, buf []byte) (int, error) {
+	total := 0
+	for total < len(buf) {
+		n, err := reader.Read(buf[total:])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func trimCRLF(s string) string {
+	for len(s) > 0 && (s[len(s)-1] == '\n' || s[len(s)-1] == '\r') {
+		s = s[:len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,105 @@
+// Package respcache 给非流式的 /v1/messages 响应提供一层两级缓存：本地 LRU 在前，
+// Redis（或其它共享后端）在后，命中时直接跳过账号选择和上游请求。缓存 key 覆盖了模型、
+// system/messages/tools 和采样相关参数，任何一项变化都会产生不同的 key，所以不需要显式失效
+// 历史条目——过期全部交给 TTL。
+package respcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"orchids-api/internal/prompt"
+)
+
+// DefaultTTL 是没有 Anthropic cache_control 标记时，普通响应的缓存存活时间
+const DefaultTTL = 5 * time.Minute
+
+// CacheControlTTL 是请求的 system 里带了 cache_control 标记时使用的存活时间——这类请求
+// 通常是长期复用的 system prompt/工具定义，值得缓存更久
+const CacheControlTTL = 30 * time.Minute
+
+// Supplier 是响应缓存后端的统一接口；Get 返回的 bool 表示是否命中，err 只用于表达后端
+// 本身的故障（网络错误等），未命中不是错误
+type Supplier interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Invalidate(ctx context.Context, key string) error
+}
+
+// Key 对 (model, system, messages, tools, maxTokens, thinkingBudget) 做规范化后取
+// SHA-256，作为响应缓存的查找键。json.Marshal 对 map 字段按 key 排序、对结构体按字段声明
+// 顺序输出，所以相同语义的请求总是产生相同的字节序列。
+func Key(model string, system []prompt.SystemItem, messages []prompt.Message, tools []interface{}, maxTokens int, thinkingBudget int) string {
+	parts := struct {
+		Model          string              `json:"model"`
+		System         []prompt.SystemItem `json:"system"`
+		Messages       []prompt.Message    `json:"messages"`
+		Tools          []interface{}       `json:"tools"`
+		MaxTokens      int                 `json:"max_tokens"`
+		ThinkingBudget int                 `json:"thinking_budget"`
+	}{model, system, messages, tools, maxTokens, thinkingBudget}
+
+	data, err := json.Marshal(parts)
+	if err != nil {
+		// 规范化失败（理论上不会发生，内容都已经是可序列化的请求字段）时退化为不可缓存：
+		// 返回空 key，调用方应当把空 key 当作"跳过缓存"处理
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// TTLFor 根据请求里是否带了 Anthropic 风格的 cache_control 标记选择存活时间：带了标记的
+// 请求通常复用同一份长 system prompt，值得缓存更久
+func TTLFor(hasCacheControl bool) time.Duration {
+	if hasCacheControl {
+		return CacheControlTTL
+	}
+	return DefaultTTL
+}
+
+// ModelStats 是某个模型累计的命中/未命中计数
+type ModelStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+var (
+	statsMu sync.Mutex
+	stats   = map[string]*ModelStats{}
+)
+
+// RecordHit/RecordMiss 维护按模型分桶的命中率计数，供 HandleLBBloomStatus 风格的调试
+// 端点或日志观察缓存实际收益
+func RecordHit(model string) { recordOutcome(model, true) }
+func RecordMiss(model string) { recordOutcome(model, false) }
+
+func recordOutcome(model string, hit bool) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	s, ok := stats[model]
+	if !ok {
+		s = &ModelStats{}
+		stats[model] = s
+	}
+	if hit {
+		s.Hits++
+	} else {
+		s.Misses++
+	}
+}
+
+// Stats 返回当前按模型分组的命中/未命中计数快照
+func Stats() map[string]ModelStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	out := make(map[string]ModelStats, len(stats))
+	for model, s := range stats {
+		out[model] = *s
+	}
+	return out
+}
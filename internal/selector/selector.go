@@ -0,0 +1,321 @@
+// Package selector 提供一个带健康感知和熔断的账号选择器，
+// 在 loadbalancer 的简单加权随机之上叠加 Nginx 风格的平滑加权轮询与熔断。
+package selector
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"orchids-api/internal/store"
+)
+
+// Outcome 描述一次上游请求的结果，供 Report 更新账号健康状态
+type Outcome int
+
+const (
+	OutcomeSuccess Outcome = iota
+	OutcomeFailure
+)
+
+// 熔断参数
+const (
+	breakerWindowSize  = 20                     // 熔断失败率统计的滑动窗口大小（最近 N 次请求）
+	breakerMinSamples  = 5                      // 窗口内样本数不足该值前不判定失败率
+	breakerFailureRate = 0.5                    // 窗口内失败率超过该阈值即触发熔断
+	CooldownPeriod     = 60 * time.Second       // 熔断冷却时间，到期后进入半开态放行一次探测请求
+	latencyEWMAAlpha   = 0.3                    // 延迟 EWMA 平滑系数，越大越跟随最近一次延迟
+	successEWMAAlpha   = 0.3                    // 成功率 EWMA 平滑系数
+	latencySmoothing   = 50 * time.Millisecond  // 有效权重公式里的常数 c，避免延迟趋近 0 时权重发散
+)
+
+// breakerPhase 熔断器的三态：关闭（正常参与调度）、打开（被排除）、半开（放行一次探测请求）
+type breakerPhase int
+
+const (
+	breakerClosed breakerPhase = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breakerState 单个账号的熔断器状态：最近 breakerWindowSize 次请求结果的滑动窗口
+type breakerState struct {
+	phase     breakerPhase
+	openedAt  time.Time
+	window    [breakerWindowSize]bool // true 表示该槽位是一次失败
+	filled    bool                    // 窗口是否已经被写满过一整圈
+	pos       int
+	failures  int
+	probeSent bool // 半开态下是否已经放出过探测请求，避免并发多个探测
+}
+
+// recordOutcome 把一次结果写入滑动窗口，维护窗口内的失败计数
+func (b *breakerState) recordOutcome(failed bool) {
+	evicted := b.window[b.pos]
+	if evicted {
+		b.failures--
+	}
+	b.window[b.pos] = failed
+	if failed {
+		b.failures++
+	}
+	b.pos = (b.pos + 1) % breakerWindowSize
+	if b.pos == 0 {
+		b.filled = true
+	}
+}
+
+func (b *breakerState) sampleCount() int {
+	if b.filled {
+		return breakerWindowSize
+	}
+	return b.pos
+}
+
+// accountState 选择器为每个账号维护的运行时状态
+type accountState struct {
+	currentWeight int
+	breaker       breakerState
+
+	latencyEWMA    float64 // 秒
+	hasLatencyEWMA bool
+	successEWMA    float64 // 0~1
+	hasSuccessEWMA bool
+}
+
+// Selector 基于 store.Account 的权重、延迟/成功率 EWMA，做健康感知的平滑加权轮询，
+// 并在账号失败率过高时熔断、半开探测后恢复
+type Selector struct {
+	store *store.Store
+
+	mu     sync.Mutex
+	states map[int64]*accountState
+}
+
+// New 创建选择器
+func New(s *store.Store) *Selector {
+	return &Selector{
+		store:  s,
+		states: make(map[int64]*accountState),
+	}
+}
+
+func (sel *Selector) stateFor(id int64) *accountState {
+	st, ok := sel.states[id]
+	if !ok {
+		st = &accountState{}
+		sel.states[id] = st
+	}
+	return st
+}
+
+// effectiveWeight 结合配置权重、延迟 EWMA 和成功率 EWMA 算出有效权重：
+// w_i * success_rate_i / (latency_ewma_i + c)，尚无样本时退化为纯配置权重
+func effectiveWeight(acc *store.Account, st *accountState) float64 {
+	base := float64(acc.Weight)
+	if base <= 0 {
+		base = 1
+	}
+	if !st.hasLatencyEWMA && !st.hasSuccessEWMA {
+		return base
+	}
+
+	successRate := 1.0
+	if st.hasSuccessEWMA {
+		successRate = st.successEWMA
+	}
+
+	latency := latencySmoothing.Seconds()
+	if st.hasLatencyEWMA {
+		latency = st.latencyEWMA
+	}
+
+	weight := base * successRate / (latency + latencySmoothing.Seconds())
+	if weight < 0.01 {
+		weight = 0.01
+	}
+	return weight
+}
+
+// isAvailable 判断账号当前是否可以参与选择：熔断关闭态直接可用；打开态在冷却期满后
+// 转入半开态并放行一次探测请求，其余请求继续视为不可用
+func (sel *Selector) isAvailable(st *accountState) bool {
+	switch st.breaker.phase {
+	case breakerClosed:
+		return true
+	case breakerHalfOpen:
+		if st.breaker.probeSent {
+			return false
+		}
+		st.breaker.probeSent = true
+		return true
+	case breakerOpen:
+		if time.Since(st.breaker.openedAt) < CooldownPeriod {
+			return false
+		}
+		st.breaker.phase = breakerHalfOpen
+		st.breaker.probeSent = true
+		return true
+	}
+	return false
+}
+
+// Pick 从可用账号中选出下一个应使用的账号：先排除熔断打开的账号（半开态放行一个探测名额），
+// 再按健康感知的平滑加权轮询选取
+func (sel *Selector) Pick(accounts []*store.Account) (*store.Account, error) {
+	sel.mu.Lock()
+	defer sel.mu.Unlock()
+
+	var candidates []*store.Account
+	for _, acc := range accounts {
+		st := sel.stateFor(acc.ID)
+		if sel.isAvailable(st) {
+			candidates = append(candidates, acc)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, errNoAvailableAccounts
+	}
+
+	return sel.pickSmoothWeighted(candidates), nil
+}
+
+// pickSmoothWeighted 实现 Nginx 风格的平滑加权轮询：
+// 每个账号的 current_weight 每轮加上 effective_weight，选出最大值并减去总权重
+func (sel *Selector) pickSmoothWeighted(accounts []*store.Account) *store.Account {
+	var best *store.Account
+	var bestState *accountState
+	totalWeight := 0.0
+
+	for _, acc := range accounts {
+		st := sel.stateFor(acc.ID)
+		ew := effectiveWeight(acc, st)
+		st.currentWeight += int(ew * 1000)
+		totalWeight += ew * 1000
+
+		if best == nil || st.currentWeight > bestState.currentWeight {
+			best = acc
+			bestState = st
+		}
+	}
+
+	if bestState != nil {
+		bestState.currentWeight -= int(totalWeight)
+	}
+
+	return best
+}
+
+// Report 记录一次请求结果及耗时，更新该账号的延迟/成功率 EWMA 与熔断器状态
+func (sel *Selector) Report(accountID int64, outcome Outcome, latency time.Duration) {
+	sel.mu.Lock()
+	defer sel.mu.Unlock()
+
+	st := sel.stateFor(accountID)
+
+	if st.hasLatencyEWMA {
+		st.latencyEWMA = latencyEWMAAlpha*latency.Seconds() + (1-latencyEWMAAlpha)*st.latencyEWMA
+	} else {
+		st.latencyEWMA = latency.Seconds()
+		st.hasLatencyEWMA = true
+	}
+
+	success := 0.0
+	if outcome == OutcomeSuccess {
+		success = 1.0
+	}
+	if st.hasSuccessEWMA {
+		st.successEWMA = successEWMAAlpha*success + (1-successEWMAAlpha)*st.successEWMA
+	} else {
+		st.successEWMA = success
+		st.hasSuccessEWMA = true
+	}
+
+	b := &st.breaker
+
+	if b.phase == breakerHalfOpen {
+		b.probeSent = false
+		if outcome == OutcomeSuccess {
+			log.Printf("[Selector] 账号 %d 半开探测通过，熔断恢复", accountID)
+			b.phase = breakerClosed
+			b.window = [breakerWindowSize]bool{}
+			b.failures = 0
+			b.filled = false
+			b.pos = 0
+		} else {
+			log.Printf("[Selector] 账号 %d 半开探测失败，继续熔断 %v", accountID, CooldownPeriod)
+			b.phase = breakerOpen
+			b.openedAt = time.Now()
+		}
+		return
+	}
+
+	b.recordOutcome(outcome == OutcomeFailure)
+	if b.phase == breakerClosed && b.sampleCount() >= breakerMinSamples {
+		rate := float64(b.failures) / float64(b.sampleCount())
+		if rate > breakerFailureRate {
+			b.phase = breakerOpen
+			b.openedAt = time.Now()
+			log.Printf("[Selector] 账号 %d 最近 %d 次请求失败率 %.0f%%，开启熔断 %v",
+				accountID, b.sampleCount(), rate*100, CooldownPeriod)
+		}
+	}
+}
+
+// Status 返回单个账号的健康状态，用于状态展示端点
+type Status struct {
+	AccountID   int64     `json:"account_id"`
+	Open        bool      `json:"open"`
+	HalfOpen    bool      `json:"half_open"`
+	Failures    int       `json:"failures_in_window"`
+	OpenedAt    time.Time `json:"opened_at,omitempty"`
+	LatencyEWMA float64   `json:"latency_ewma_seconds,omitempty"`
+	SuccessEWMA float64   `json:"success_rate_ewma,omitempty"`
+}
+
+func (sel *Selector) statusLocked(id int64, st *accountState) Status {
+	s := Status{
+		AccountID:   id,
+		Open:        st.breaker.phase == breakerOpen,
+		HalfOpen:    st.breaker.phase == breakerHalfOpen,
+		Failures:    st.breaker.failures,
+		LatencyEWMA: st.latencyEWMA,
+		SuccessEWMA: st.successEWMA,
+	}
+	if !st.breaker.openedAt.IsZero() {
+		s.OpenedAt = st.breaker.openedAt
+	}
+	return s
+}
+
+// StatusList 返回当前所有账号的健康状态快照
+func (sel *Selector) StatusList() []Status {
+	sel.mu.Lock()
+	defer sel.mu.Unlock()
+
+	result := make([]Status, 0, len(sel.states))
+	for id, st := range sel.states {
+		result = append(result, sel.statusLocked(id, st))
+	}
+	return result
+}
+
+// StatusFor 返回单个账号的健康状态，不存在记录时返回零值与 false；
+// 供 /api/accounts/health 内联展示每个账号被选择器如何看待
+func (sel *Selector) StatusFor(accountID int64) (Status, bool) {
+	sel.mu.Lock()
+	defer sel.mu.Unlock()
+
+	st, ok := sel.states[accountID]
+	if !ok {
+		return Status{}, false
+	}
+	return sel.statusLocked(accountID, st), true
+}
+
+type selectorError string
+
+func (e selectorError) Error() string { return string(e) }
+
+const errNoAvailableAccounts = selectorError("no available accounts after circuit-breaker filtering")
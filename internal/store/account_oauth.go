@@ -0,0 +1,64 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// accountOAuthStateTTL 是 state/nonce 从签发到过期的有效期，超时未回调的流程视为放弃
+const accountOAuthStateTTL = 10 * time.Minute
+
+func (s *Store) migrateAccountOAuth() error {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS account_oauth_states (
+			state TEXT PRIMARY KEY,
+			nonce TEXT NOT NULL,
+			used INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+	}
+
+	for _, q := range queries {
+		if _, err := s.db.Exec(q); err != nil && !isDuplicateColumnError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveAccountOAuthState 持久化账号接入流程签发的一次性 state/nonce，落盘而非仅存内存，
+// 使 callback 可以落在任意一个实例上处理
+func (s *Store) SaveAccountOAuthState(state, nonce string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`INSERT INTO account_oauth_states (state, nonce) VALUES (?, ?)`, state, nonce)
+	return err
+}
+
+// ConsumeAccountOAuthState 校验 state 存在、未过期且未被使用过，随即标记为已使用以防重放，
+// 返回签发时绑定的 nonce 供调用方做进一步校验
+func (s *Store) ConsumeAccountOAuthState(state string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var nonce string
+	var used bool
+	var createdAt time.Time
+	err := s.db.QueryRow(`SELECT nonce, used, created_at FROM account_oauth_states WHERE state = ?`, state).
+		Scan(&nonce, &used, &createdAt)
+	if err != nil {
+		return "", fmt.Errorf("unknown state: %w", err)
+	}
+	if used {
+		return "", fmt.Errorf("state already used")
+	}
+	if time.Since(createdAt) > accountOAuthStateTTL {
+		return "", fmt.Errorf("state expired")
+	}
+
+	if _, err := s.db.Exec(`UPDATE account_oauth_states SET used = 1 WHERE state = ?`, state); err != nil {
+		return "", err
+	}
+	return nonce, nil
+}
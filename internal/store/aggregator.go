@@ -0,0 +1,259 @@
+package store
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// counterDelta 聚合中单个账号待写入的计数增量
+type counterDelta struct {
+	req  int64
+	succ int64
+	fail int64
+}
+
+// shardCount 分片数量，用于降低高并发下单一 mutex 的竞争
+const shardCount = 16
+
+// DefaultFlushInterval 默认刷新间隔
+const DefaultFlushInterval = 500 * time.Millisecond
+
+// DefaultFlushThreshold 单个账号的增量超过该阈值时提前触发一次刷新
+const DefaultFlushThreshold = 1000
+
+// CounterAggregator 在内存中缓冲 request/success/failure 计数增量，定期或超阈值时批量落盘，
+// 避免 IncrementRequestCount 等方法在高 QPS 下每次命中都争用同一把锁/一行 UPDATE
+type CounterAggregator struct {
+	store     *Store
+	interval  time.Duration
+	threshold int64
+
+	shards [shardCount]struct {
+		mu      sync.Mutex
+		deltas  map[int64]*counterDelta
+	}
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewCounterAggregator 创建聚合器，interval<=0 时使用 DefaultFlushInterval
+func NewCounterAggregator(s *Store, interval time.Duration) *CounterAggregator {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+
+	ca := &CounterAggregator{
+		store:     s,
+		interval:  interval,
+		threshold: DefaultFlushThreshold,
+		stopCh:    make(chan struct{}),
+	}
+	for i := range ca.shards {
+		ca.shards[i].deltas = make(map[int64]*counterDelta)
+	}
+
+	ca.wg.Add(1)
+	go ca.runPeriodicFlush()
+
+	return ca
+}
+
+func (ca *CounterAggregator) shardFor(accountID int64) int {
+	return int(accountID % shardCount)
+}
+
+func (ca *CounterAggregator) bump(accountID int64, field func(*counterDelta)) {
+	idx := ca.shardFor(accountID)
+	shard := &ca.shards[idx]
+
+	shard.mu.Lock()
+	d, ok := shard.deltas[accountID]
+	if !ok {
+		d = &counterDelta{}
+		shard.deltas[accountID] = d
+	}
+	field(d)
+	exceeded := d.req+d.succ+d.fail >= ca.threshold
+	shard.mu.Unlock()
+
+	if exceeded {
+		ca.flushAccount(accountID)
+	}
+}
+
+// BumpRequest 排队一次请求计数增量
+func (ca *CounterAggregator) BumpRequest(id int64) {
+	ca.bump(id, func(d *counterDelta) { d.req++ })
+}
+
+// BumpSuccess 排队一次成功计数增量
+func (ca *CounterAggregator) BumpSuccess(id int64) {
+	ca.bump(id, func(d *counterDelta) { d.succ++ })
+}
+
+// BumpFailure 排队一次失败计数增量
+func (ca *CounterAggregator) BumpFailure(id int64) {
+	ca.bump(id, func(d *counterDelta) { d.fail++ })
+}
+
+// PendingDelta 返回指定账号尚未落盘的增量，供 GetAccount 合并展示，避免管理面板读到过期计数
+func (ca *CounterAggregator) PendingDelta(accountID int64) (req, succ, fail int64) {
+	shard := &ca.shards[ca.shardFor(accountID)]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if d, ok := shard.deltas[accountID]; ok {
+		return d.req, d.succ, d.fail
+	}
+	return 0, 0, 0
+}
+
+// QueueDepth 返回当前缓冲中尚未刷新的账号数，用于 /metrics 式内省端点
+func (ca *CounterAggregator) QueueDepth() int {
+	depth := 0
+	for i := range ca.shards {
+		ca.shards[i].mu.Lock()
+		depth += len(ca.shards[i].deltas)
+		ca.shards[i].mu.Unlock()
+	}
+	return depth
+}
+
+func (ca *CounterAggregator) runPeriodicFlush() {
+	defer ca.wg.Done()
+	ticker := time.NewTicker(ca.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ca.stopCh:
+			return
+		case <-ticker.C:
+			ca.FlushAll()
+		}
+	}
+}
+
+func (ca *CounterAggregator) flushAccount(accountID int64) {
+	shard := &ca.shards[ca.shardFor(accountID)]
+
+	shard.mu.Lock()
+	d, ok := shard.deltas[accountID]
+	if ok {
+		delete(shard.deltas, accountID)
+	}
+	shard.mu.Unlock()
+
+	if !ok || (d.req == 0 && d.succ == 0 && d.fail == 0) {
+		return
+	}
+
+	if err := ca.store.flushCounterDelta(accountID, d); err != nil {
+		log.Printf("[CounterAggregator] 刷新账号 %d 计数失败: %v", accountID, err)
+	}
+}
+
+// FlushAll 立即刷新所有分片中缓冲的增量，使用单事务逐账号写入
+func (ca *CounterAggregator) FlushAll() {
+	for i := range ca.shards {
+		shard := &ca.shards[i]
+
+		shard.mu.Lock()
+		pending := shard.deltas
+		shard.deltas = make(map[int64]*counterDelta)
+		shard.mu.Unlock()
+
+		for accountID, d := range pending {
+			if d.req == 0 && d.succ == 0 && d.fail == 0 {
+				continue
+			}
+			if err := ca.store.flushCounterDelta(accountID, d); err != nil {
+				log.Printf("[CounterAggregator] 刷新账号 %d 计数失败: %v", accountID, err)
+			}
+		}
+	}
+}
+
+// Flush 在进程关闭前调用，确保缓冲中的增量全部落盘
+func (ca *CounterAggregator) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ca.FlushAll()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop 停止后台刷新协程并做最后一次落盘
+func (ca *CounterAggregator) Stop() {
+	close(ca.stopCh)
+	ca.wg.Wait()
+	ca.FlushAll()
+}
+
+// flushCounterDelta 用单个事务把一个账号的增量写入 accounts 表
+func (s *Store) flushCounterDelta(accountID int64, d *counterDelta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE accounts SET
+			request_count = request_count + ?,
+			success_count = success_count + ?,
+			failure_count = failure_count + ?,
+			last_used_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, d.req, d.succ, d.fail, accountID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// BumpRequest/BumpSuccess/BumpFailure 在 Store 上暴露聚合器，client.Client / SSE 完成路径改用这些方法
+// 代替逐行 Exec 的 Increment*Count，把写入从请求路径上摘下来
+func (s *Store) BumpRequest(id int64) {
+	s.aggregator().BumpRequest(id)
+}
+
+func (s *Store) BumpSuccess(id int64) {
+	s.aggregator().BumpSuccess(id)
+}
+
+func (s *Store) BumpFailure(id int64) {
+	s.aggregator().BumpFailure(id)
+}
+
+// aggregator 懒初始化并返回 Store 关联的 CounterAggregator
+func (s *Store) aggregator() *CounterAggregator {
+	s.counterAggregatorOnce.Do(func() {
+		s.counterAggregator = NewCounterAggregator(s, DefaultFlushInterval)
+	})
+	return s.counterAggregator
+}
+
+// FlushCounters 在进程关闭前调用，确保聚合器缓冲的增量全部落盘
+func (s *Store) FlushCounters(ctx context.Context) error {
+	return s.aggregator().Flush(ctx)
+}
+
+// CounterQueueDepth 返回计数聚合器当前缓冲的账号数，供 /metrics 式内省端点展示
+func (s *Store) CounterQueueDepth() int {
+	return s.aggregator().QueueDepth()
+}
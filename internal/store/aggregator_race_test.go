@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// TestMergePendingCountersNoRace 在 -race 下验证 GetAccount（经 mergePendingCounters）和
+// BumpRequest 并发调用时都走同一个 aggregator() Once，不会出现对 counterAggregator
+// 字段的无同步读写
+func TestMergePendingCountersNoRace(t *testing.T) {
+	s, err := New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	acc := &Account{Name: "race-acct", Enabled: true}
+	if err := s.CreateAccount(acc); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.BumpRequest(acc.ID)
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := s.GetAccount(acc.ID); err != nil {
+				t.Errorf("GetAccount failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestCounterQueueDepthAndFlushCountersNoRace 在 -race 下验证 CounterQueueDepth/FlushCounters
+// 和 BumpRequest 并发调用时也都走 aggregator() 的同一个 Once，而不是各自裸读 counterAggregator
+// 字段（/metrics 式内省端点和请求路径上的计数是完全独立的两条并发路径）
+func TestCounterQueueDepthAndFlushCountersNoRace(t *testing.T) {
+	s, err := New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	acc := &Account{Name: "race-acct-2", Enabled: true}
+	if err := s.CreateAccount(acc); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			s.BumpRequest(acc.ID)
+		}()
+		go func() {
+			defer wg.Done()
+			_ = s.CounterQueueDepth()
+		}()
+		go func() {
+			defer wg.Done()
+			if err := s.FlushCounters(context.Background()); err != nil {
+				t.Errorf("FlushCounters failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
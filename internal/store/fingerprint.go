@@ -0,0 +1,68 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+)
+
+// ErrFingerprintMismatch 表示调用方提供的 fingerprint 和账号当前状态不一致，说明
+// 账号在调用方读取之后已被别处（dashboard 并发编辑、keeper 刷新 cookie 等）改写过
+var ErrFingerprintMismatch = errors.New("fingerprint mismatch: account has been modified")
+
+// Fingerprint 对账号里会被 PUT /api/accounts/{id} 修改的字段做 SHA-256，用作乐观并发控制的
+// 版本号；特意不包含 request/success/failure 计数和时间戳，它们由 keeper 后台持续刷新，
+// 纳入的话 fingerprint 永远对不上，起不到 CAS 的作用
+func (a *Account) Fingerprint() string {
+	data, _ := json.Marshal(struct {
+		Name         string
+		SessionID    string
+		ClientCookie string
+		ClientUat    string
+		ProjectID    string
+		UserID       string
+		AgentMode    string
+		Email        string
+		Weight       int
+		Enabled      bool
+		Tag          string
+	}{
+		Name:         a.Name,
+		SessionID:    a.SessionID,
+		ClientCookie: a.ClientCookie,
+		ClientUat:    a.ClientUat,
+		ProjectID:    a.ProjectID,
+		UserID:       a.UserID,
+		AgentMode:    a.AgentMode,
+		Email:        a.Email,
+		Weight:       a.Weight,
+		Enabled:      a.Enabled,
+		Tag:          a.Tag,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// DoLockedAction 是账号更新的乐观并发控制 (CAS) 入口：在持有写锁期间重新读取账号、校验
+// fingerprint 仍然匹配，再让 cb 在内存里修改它，最后落盘；fingerprint 为空表示调用方放弃
+// 并发检查（无条件覆盖）。cb 修改的是从库里刚读出的最新副本，不是调用方手头可能过期的那份
+func (s *Store) DoLockedAction(id int64, fingerprint string, cb func(*Account) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, err := s.getAccountLocked(id)
+	if err != nil {
+		return err
+	}
+
+	if fingerprint != "" && acc.Fingerprint() != fingerprint {
+		return ErrFingerprintMismatch
+	}
+
+	if err := cb(acc); err != nil {
+		return err
+	}
+
+	return s.updateAccountLocked(acc)
+}
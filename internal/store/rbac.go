@@ -0,0 +1,299 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Admin 后台管理员账号（区别于 accounts 表中的上游 Clerk 账号）
+type Admin struct {
+	ID           int64     `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	Enabled      bool      `json:"enabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Role 角色，通过 admin_roles 关联到管理员
+type Role struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permission 单个权限点，例如 accounts.read / settings.admin
+type Permission struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// PermissionGroup 权限组，通过 permission_group_permissions 关联到权限
+type PermissionGroup struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func (s *Store) migrateRBAC() error {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS admins (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT UNIQUE NOT NULL,
+			password_hash TEXT NOT NULL,
+			enabled INTEGER DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS roles (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL,
+			description TEXT DEFAULT ''
+		)`,
+		`CREATE TABLE IF NOT EXISTS permissions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS permission_groups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS admin_roles (
+			admin_id INTEGER NOT NULL,
+			role_id INTEGER NOT NULL,
+			PRIMARY KEY (admin_id, role_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS role_permission_groups (
+			role_id INTEGER NOT NULL,
+			permission_group_id INTEGER NOT NULL,
+			PRIMARY KEY (role_id, permission_group_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS permission_group_permissions (
+			permission_group_id INTEGER NOT NULL,
+			permission_id INTEGER NOT NULL,
+			PRIMARY KEY (permission_group_id, permission_id)
+		)`,
+	}
+
+	for _, q := range queries {
+		if _, err := s.db.Exec(q); err != nil && !isDuplicateColumnError(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateAdmin 创建管理员，密码以 bcrypt 哈希存储
+func (s *Store) CreateAdmin(username, password string) (*Admin, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec(`INSERT INTO admins (username, password_hash, enabled) VALUES (?, ?, 1)`, username, string(hash))
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &Admin{ID: id, Username: username, Enabled: true}, nil
+}
+
+// VerifyAdminPassword 校验用户名密码，成功时返回对应的 Admin
+func (s *Store) VerifyAdminPassword(username, password string) (*Admin, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	admin := &Admin{}
+	err := s.db.QueryRow(`SELECT id, username, password_hash, enabled, created_at, updated_at FROM admins WHERE username = ?`, username).
+		Scan(&admin.ID, &admin.Username, &admin.PasswordHash, &admin.Enabled, &admin.CreatedAt, &admin.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if !admin.Enabled {
+		return nil, fmt.Errorf("admin account disabled: %s", username)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(password)); err != nil {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+	return admin, nil
+}
+
+// BootstrapSuperadmin 首次启动时从配置中创建默认超级管理员（若尚不存在任何管理员）
+func (s *Store) BootstrapSuperadmin(username, password string) error {
+	s.mu.RLock()
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM admins`).Scan(&count)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	admin, err := s.CreateAdmin(username, password)
+	if err != nil {
+		return err
+	}
+
+	role, err := s.CreateRole("superadmin", "bootstrap superadmin role with full access")
+	if err != nil {
+		return err
+	}
+	group, err := s.CreatePermissionGroup("all")
+	if err != nil {
+		return err
+	}
+	for _, perm := range []string{"accounts.read", "accounts.write", "settings.admin"} {
+		p, err := s.CreatePermission(perm)
+		if err != nil {
+			return err
+		}
+		if err := s.AddPermissionToGroup(group.ID, p.ID); err != nil {
+			return err
+		}
+	}
+	if err := s.AddPermissionGroupToRole(role.ID, group.ID); err != nil {
+		return err
+	}
+	return s.AssignRole(admin.ID, role.ID)
+}
+
+func (s *Store) CreateRole(name, description string) (*Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec(`INSERT INTO roles (name, description) VALUES (?, ?)`, name, description)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &Role{ID: id, Name: name, Description: description}, nil
+}
+
+func (s *Store) CreatePermission(name string) (*Permission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec(`INSERT INTO permissions (name) VALUES (?) ON CONFLICT(name) DO UPDATE SET name = excluded.name`, name)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &Permission{ID: id, Name: name}, nil
+}
+
+func (s *Store) CreatePermissionGroup(name string) (*PermissionGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec(`INSERT INTO permission_groups (name) VALUES (?)`, name)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &PermissionGroup{ID: id, Name: name}, nil
+}
+
+func (s *Store) AddPermissionToGroup(groupID, permID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO permission_group_permissions (permission_group_id, permission_id) VALUES (?, ?)`, groupID, permID)
+	return err
+}
+
+func (s *Store) AddPermissionGroupToRole(roleID, groupID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO role_permission_groups (role_id, permission_group_id) VALUES (?, ?)`, roleID, groupID)
+	return err
+}
+
+// AssignRole 给管理员授予角色
+func (s *Store) AssignRole(adminID, roleID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO admin_roles (admin_id, role_id) VALUES (?, ?)`, adminID, roleID)
+	return err
+}
+
+// GetAdminByUsername 按用户名查询管理员
+func (s *Store) GetAdminByUsername(username string) (*Admin, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	admin := &Admin{}
+	err := s.db.QueryRow(`SELECT id, username, password_hash, enabled, created_at, updated_at FROM admins WHERE username = ?`, username).
+		Scan(&admin.ID, &admin.Username, &admin.PasswordHash, &admin.Enabled, &admin.CreatedAt, &admin.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return admin, nil
+}
+
+// ListPermissionsForAdmin 解析 admin -> roles -> permission_groups -> permissions，返回去重后的权限名集合
+func (s *Store) ListPermissionsForAdmin(adminID int64) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT DISTINCT p.name
+		FROM admin_roles ar
+		JOIN role_permission_groups rpg ON rpg.role_id = ar.role_id
+		JOIN permission_group_permissions pgp ON pgp.permission_group_id = rpg.permission_group_id
+		JOIN permissions p ON p.id = pgp.permission_id
+		WHERE ar.admin_id = ?
+	`, adminID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var perms []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		perms = append(perms, name)
+	}
+	return perms, nil
+}
+
+// AdminHasPermission 判断管理员是否拥有指定权限
+func (s *Store) AdminHasPermission(adminID int64, perm string) (bool, error) {
+	perms, err := s.ListPermissionsForAdmin(adminID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, p := range perms {
+		if p == perm {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,84 @@
+package store
+
+import "testing"
+
+func TestCreateAdminAndVerifyAdminPassword(t *testing.T) {
+	s, err := New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	if _, err := s.CreateAdmin("alice", "s3cret"); err != nil {
+		t.Fatalf("CreateAdmin failed: %v", err)
+	}
+
+	admin, err := s.VerifyAdminPassword("alice", "s3cret")
+	if err != nil {
+		t.Fatalf("VerifyAdminPassword with the correct password failed: %v", err)
+	}
+	if admin.Username != "alice" {
+		t.Errorf("got username %q, want %q", admin.Username, "alice")
+	}
+
+	if _, err := s.VerifyAdminPassword("alice", "wrong"); err == nil {
+		t.Error("expected VerifyAdminPassword with the wrong password to fail")
+	}
+	if _, err := s.VerifyAdminPassword("nobody", "s3cret"); err == nil {
+		t.Error("expected VerifyAdminPassword for an unknown username to fail")
+	}
+}
+
+func TestBootstrapSuperadminGrantsAllSeededPermissions(t *testing.T) {
+	s, err := New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	if err := s.BootstrapSuperadmin("root", "toor"); err != nil {
+		t.Fatalf("BootstrapSuperadmin failed: %v", err)
+	}
+
+	admin, err := s.GetAdminByUsername("root")
+	if err != nil {
+		t.Fatalf("GetAdminByUsername failed: %v", err)
+	}
+
+	for _, perm := range []string{"accounts.read", "accounts.write", "settings.admin"} {
+		allowed, err := s.AdminHasPermission(admin.ID, perm)
+		if err != nil {
+			t.Fatalf("AdminHasPermission(%q) failed: %v", perm, err)
+		}
+		if !allowed {
+			t.Errorf("bootstrap superadmin should have permission %q", perm)
+		}
+	}
+
+	if allowed, err := s.AdminHasPermission(admin.ID, "nonexistent.permission"); err != nil {
+		t.Fatalf("AdminHasPermission failed: %v", err)
+	} else if allowed {
+		t.Error("bootstrap superadmin should not have an unseeded permission")
+	}
+
+	// 第二次调用应该是幂等的：已经存在管理员了，不会再创建一个
+	if err := s.BootstrapSuperadmin("someone-else", "pw"); err != nil {
+		t.Fatalf("second BootstrapSuperadmin call failed: %v", err)
+	}
+	if _, err := s.GetAdminByUsername("someone-else"); err == nil {
+		t.Error("BootstrapSuperadmin should not create a second admin once one already exists")
+	}
+}
+
+func TestAdminHasPermissionForUnknownAdmin(t *testing.T) {
+	s, err := New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	allowed, err := s.AdminHasPermission(999, "accounts.read")
+	if err != nil {
+		t.Fatalf("AdminHasPermission for an unknown admin should not error, got: %v", err)
+	}
+	if allowed {
+		t.Error("an unknown admin should not have any permission")
+	}
+}
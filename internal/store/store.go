@@ -10,17 +10,29 @@ import (
 )
 
 type Account struct {
-	ID           int64     `json:"id"`
-	Name         string    `json:"name"`
-	SessionID    string    `json:"session_id"`
-	ClientCookie string    `json:"client_cookie"`
-	ClientUat    string    `json:"client_uat"`
-	ProjectID    string    `json:"project_id"`
-	UserID       string    `json:"user_id"`
-	AgentMode    string    `json:"agent_mode"`
-	Email        string    `json:"email"`
-	Weight       int       `json:"weight"`
-	Enabled      bool      `json:"enabled"`
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// SessionID 对 Anthropic 账号是 Clerk 的 session ID；对 Provider 为 "ollama"/"openai"
+	// 的账号，复用这个字段存鉴权用的 bearer token/API key（Ollama 本地部署通常留空）
+	SessionID    string `json:"session_id"`
+	ClientCookie string `json:"client_cookie"`
+	ClientUat    string `json:"client_uat"`
+	ProjectID    string `json:"project_id"`
+	UserID       string `json:"user_id"`
+	// AgentMode 对 Anthropic 账号是 Orchids 的 agent 模式字符串；对 Provider 为
+	// "ollama"/"openai" 的账号，复用这个字段存上游的模型名（如 "llama3.1"、"gpt-4o-mini"）
+	AgentMode       string    `json:"agent_mode"`
+	Email           string    `json:"email"`
+	Weight          int       `json:"weight"`
+	Enabled         bool      `json:"enabled"`
+	CertFingerprint string    `json:"cert_fingerprint,omitempty"`
+	Tag             string    `json:"tag,omitempty"`
+	// Provider 标识这个账号指向哪种上游："anthropic"（默认，走 client.Client）、
+	// "ollama"、"openai"，由 providers.NewFromAccount 按这个字段选择具体实现
+	Provider string `json:"provider"`
+	// Endpoint 是 Ollama/OpenAI 兼容上游的 base URL，仅 Provider 非 "anthropic" 时使用
+	Endpoint     string    `json:"endpoint,omitempty"`
+	RefreshToken string    `json:"-"`
 	RequestCount int64     `json:"request_count"`
 	SuccessCount int64     `json:"success_count"`
 	FailureCount int64     `json:"failure_count"`
@@ -38,6 +50,9 @@ type Settings struct {
 type Store struct {
 	db *sql.DB
 	mu sync.RWMutex
+
+	counterAggregator     *CounterAggregator
+	counterAggregatorOnce sync.Once
 }
 
 func New(dbPath string) (*Store, error) {
@@ -84,6 +99,18 @@ func (s *Store) migrate() error {
 		// 迁移：添加 success_count 和 failure_count 列（如果不存在）
 		`ALTER TABLE accounts ADD COLUMN success_count INTEGER DEFAULT 0`,
 		`ALTER TABLE accounts ADD COLUMN failure_count INTEGER DEFAULT 0`,
+		// 迁移：添加 mTLS 客户端证书指纹列（如果不存在）
+		`ALTER TABLE accounts ADD COLUMN cert_fingerprint TEXT`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_cert_fingerprint ON accounts(cert_fingerprint) WHERE cert_fingerprint IS NOT NULL`,
+		// 迁移：添加账号分组标签列，供租户系统按标签圈定可用账号子集
+		`ALTER TABLE accounts ADD COLUMN tag TEXT DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS idx_accounts_tag ON accounts(tag)`,
+		// 迁移：添加 OAuth 接入账号的 refresh token 列，供 keeper.AccountKeeper 静默轮换会话
+		`ALTER TABLE accounts ADD COLUMN refresh_token TEXT DEFAULT ''`,
+		// 迁移：添加 provider/endpoint 列，支持账号指向 Ollama/OpenAI 兼容上游而不只是 Anthropic；
+		// 留空的历史账号在 providers.NewFromAccount 里按 "anthropic" 处理
+		`ALTER TABLE accounts ADD COLUMN provider TEXT DEFAULT 'anthropic'`,
+		`ALTER TABLE accounts ADD COLUMN endpoint TEXT DEFAULT ''`,
 	}
 
 	for _, q := range queries {
@@ -94,7 +121,13 @@ func (s *Store) migrate() error {
 		}
 	}
 
-	return nil
+	if err := s.migrateRBAC(); err != nil {
+		return err
+	}
+	if err := s.migrateTenants(); err != nil {
+		return err
+	}
+	return s.migrateAccountOAuth()
 }
 
 // isDuplicateColumnError 检查是否是重复列错误
@@ -127,9 +160,9 @@ func (s *Store) CreateAccount(acc *Account) error {
 	defer s.mu.Unlock()
 
 	result, err := s.db.Exec(`
-		INSERT INTO accounts (name, session_id, client_cookie, client_uat, project_id, user_id, agent_mode, email, weight, enabled)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, acc.Name, acc.SessionID, acc.ClientCookie, acc.ClientUat, acc.ProjectID, acc.UserID, acc.AgentMode, acc.Email, acc.Weight, acc.Enabled)
+		INSERT INTO accounts (name, session_id, client_cookie, client_uat, project_id, user_id, agent_mode, email, weight, enabled, tag, refresh_token, provider, endpoint)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, acc.Name, acc.SessionID, acc.ClientCookie, acc.ClientUat, acc.ProjectID, acc.UserID, acc.AgentMode, acc.Email, acc.Weight, acc.Enabled, acc.Tag, acc.RefreshToken, acc.Provider, acc.Endpoint)
 	if err != nil {
 		return err
 	}
@@ -146,13 +179,19 @@ func (s *Store) UpdateAccount(acc *Account) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	return s.updateAccountLocked(acc)
+}
+
+// updateAccountLocked 是 UpdateAccount 的无锁版本，调用方必须已持有 s.mu 的写锁
+// （供 DoLockedAction 在一次加锁期间完成"读-比对-写"而不重入锁）
+func (s *Store) updateAccountLocked(acc *Account) error {
 	_, err := s.db.Exec(`
 		UPDATE accounts SET
 			name = ?, session_id = ?, client_cookie = ?, client_uat = ?,
 			project_id = ?, user_id = ?, agent_mode = ?, email = ?,
-			weight = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP
+			weight = ?, enabled = ?, tag = ?, provider = ?, endpoint = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
-	`, acc.Name, acc.SessionID, acc.ClientCookie, acc.ClientUat, acc.ProjectID, acc.UserID, acc.AgentMode, acc.Email, acc.Weight, acc.Enabled, acc.ID)
+	`, acc.Name, acc.SessionID, acc.ClientCookie, acc.ClientUat, acc.ProjectID, acc.UserID, acc.AgentMode, acc.Email, acc.Weight, acc.Enabled, acc.Tag, acc.Provider, acc.Endpoint, acc.ID)
 	return err
 }
 
@@ -168,16 +207,57 @@ func (s *Store) GetAccount(id int64) (*Account, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	return s.getAccountLocked(id)
+}
+
+// getAccountLocked 是 GetAccount 的无锁版本，调用方必须已持有 s.mu（读锁或写锁均可）
+// （供 DoLockedAction 在一次加锁期间完成"读-比对-写"而不重入锁）
+func (s *Store) getAccountLocked(id int64) (*Account, error) {
 	acc := &Account{}
 	var lastUsedAt sql.NullTime
 	err := s.db.QueryRow(`
 		SELECT id, name, session_id, client_cookie, client_uat, project_id, user_id,
-			   agent_mode, email, weight, enabled, request_count, success_count, failure_count,
+			   agent_mode, email, weight, enabled, tag, provider, endpoint, request_count, success_count, failure_count,
 			   last_used_at, created_at, updated_at
 		FROM accounts WHERE id = ?
 	`, id).Scan(&acc.ID, &acc.Name, &acc.SessionID, &acc.ClientCookie, &acc.ClientUat,
 		&acc.ProjectID, &acc.UserID, &acc.AgentMode, &acc.Email, &acc.Weight,
-		&acc.Enabled, &acc.RequestCount, &acc.SuccessCount, &acc.FailureCount,
+		&acc.Enabled, &acc.Tag, &acc.Provider, &acc.Endpoint, &acc.RequestCount, &acc.SuccessCount, &acc.FailureCount,
+		&lastUsedAt, &acc.CreatedAt, &acc.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		acc.LastUsedAt = lastUsedAt.Time
+	}
+	s.mergePendingCounters(acc)
+	return acc, nil
+}
+
+// mergePendingCounters 把聚合器中尚未落盘的计数增量叠加到读出的账号上，
+// 确保管理 UI 不会因为写behind批处理而展示过期的计数
+func (s *Store) mergePendingCounters(acc *Account) {
+	req, succ, fail := s.aggregator().PendingDelta(acc.ID)
+	acc.RequestCount += req
+	acc.SuccessCount += succ
+	acc.FailureCount += fail
+}
+
+// GetAccountByCertFingerprint 按 mTLS 客户端证书指纹查询账号
+func (s *Store) GetAccountByCertFingerprint(fingerprint string) (*Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	acc := &Account{}
+	var lastUsedAt sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT id, name, session_id, client_cookie, client_uat, project_id, user_id,
+			   agent_mode, email, weight, enabled, tag, provider, endpoint, request_count, success_count, failure_count,
+			   last_used_at, created_at, updated_at
+		FROM accounts WHERE cert_fingerprint = ?
+	`, fingerprint).Scan(&acc.ID, &acc.Name, &acc.SessionID, &acc.ClientCookie, &acc.ClientUat,
+		&acc.ProjectID, &acc.UserID, &acc.AgentMode, &acc.Email, &acc.Weight,
+		&acc.Enabled, &acc.Tag, &acc.Provider, &acc.Endpoint, &acc.RequestCount, &acc.SuccessCount, &acc.FailureCount,
 		&lastUsedAt, &acc.CreatedAt, &acc.UpdatedAt)
 	if err != nil {
 		return nil, err
@@ -185,16 +265,45 @@ func (s *Store) GetAccount(id int64) (*Account, error) {
 	if lastUsedAt.Valid {
 		acc.LastUsedAt = lastUsedAt.Time
 	}
+	acc.CertFingerprint = fingerprint
 	return acc, nil
 }
 
+// SetAccountCertFingerprint 绑定/更新账号的 mTLS 客户端证书指纹
+func (s *Store) SetAccountCertFingerprint(id int64, fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`UPDATE accounts SET cert_fingerprint = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, fingerprint, id)
+	return err
+}
+
+// GetAccountRefreshToken 读取 OAuth 接入账号的 refresh token，供 keeper.AccountKeeper 静默轮换会话使用
+func (s *Store) GetAccountRefreshToken(id int64) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var refreshToken string
+	err := s.db.QueryRow(`SELECT refresh_token FROM accounts WHERE id = ?`, id).Scan(&refreshToken)
+	return refreshToken, err
+}
+
+// SetAccountRefreshToken 在账号轮换会话后更新其 refresh token
+func (s *Store) SetAccountRefreshToken(id int64, refreshToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`UPDATE accounts SET refresh_token = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, refreshToken, id)
+	return err
+}
+
 func (s *Store) ListAccounts() ([]*Account, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	rows, err := s.db.Query(`
 		SELECT id, name, session_id, client_cookie, client_uat, project_id, user_id,
-			   agent_mode, email, weight, enabled, request_count, success_count, failure_count,
+			   agent_mode, email, weight, enabled, tag, provider, endpoint, request_count, success_count, failure_count,
 			   last_used_at, created_at, updated_at
 		FROM accounts ORDER BY id
 	`)
@@ -209,7 +318,7 @@ func (s *Store) ListAccounts() ([]*Account, error) {
 		var lastUsedAt sql.NullTime
 		err := rows.Scan(&acc.ID, &acc.Name, &acc.SessionID, &acc.ClientCookie, &acc.ClientUat,
 			&acc.ProjectID, &acc.UserID, &acc.AgentMode, &acc.Email, &acc.Weight,
-			&acc.Enabled, &acc.RequestCount, &acc.SuccessCount, &acc.FailureCount,
+			&acc.Enabled, &acc.Tag, &acc.Provider, &acc.Endpoint, &acc.RequestCount, &acc.SuccessCount, &acc.FailureCount,
 			&lastUsedAt, &acc.CreatedAt, &acc.UpdatedAt)
 		if err != nil {
 			return nil, err
@@ -217,6 +326,7 @@ func (s *Store) ListAccounts() ([]*Account, error) {
 		if lastUsedAt.Valid {
 			acc.LastUsedAt = lastUsedAt.Time
 		}
+		s.mergePendingCounters(acc)
 		accounts = append(accounts, acc)
 	}
 	return accounts, nil
@@ -228,7 +338,7 @@ func (s *Store) GetEnabledAccounts() ([]*Account, error) {
 
 	rows, err := s.db.Query(`
 		SELECT id, name, session_id, client_cookie, client_uat, project_id, user_id,
-			   agent_mode, email, weight, enabled, request_count, success_count, failure_count,
+			   agent_mode, email, weight, enabled, tag, provider, endpoint, request_count, success_count, failure_count,
 			   last_used_at, created_at, updated_at
 		FROM accounts WHERE enabled = 1 ORDER BY id
 	`)
@@ -243,7 +353,7 @@ func (s *Store) GetEnabledAccounts() ([]*Account, error) {
 		var lastUsedAt sql.NullTime
 		err := rows.Scan(&acc.ID, &acc.Name, &acc.SessionID, &acc.ClientCookie, &acc.ClientUat,
 			&acc.ProjectID, &acc.UserID, &acc.AgentMode, &acc.Email, &acc.Weight,
-			&acc.Enabled, &acc.RequestCount, &acc.SuccessCount, &acc.FailureCount,
+			&acc.Enabled, &acc.Tag, &acc.Provider, &acc.Endpoint, &acc.RequestCount, &acc.SuccessCount, &acc.FailureCount,
 			&lastUsedAt, &acc.CreatedAt, &acc.UpdatedAt)
 		if err != nil {
 			return nil, err
@@ -251,6 +361,7 @@ func (s *Store) GetEnabledAccounts() ([]*Account, error) {
 		if lastUsedAt.Valid {
 			acc.LastUsedAt = lastUsedAt.Time
 		}
+		s.mergePendingCounters(acc)
 		accounts = append(accounts, acc)
 	}
 	return accounts, nil
@@ -0,0 +1,201 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// Tenant 是共享账号池之上的一个计费/限流边界，通过 API Key 或 X-Scope-OrgID 识别调用方
+type Tenant struct {
+	ID             int64     `json:"id"`
+	Name           string    `json:"name"`
+	OrgID          string    `json:"org_id"` // 对应 X-Scope-OrgID 请求头
+	APIKeyHash     string    `json:"-"`
+	MonthlyBudget  int64     `json:"monthly_budget"` // 每月 token 预算，<=0 表示不限
+	BudgetUsed     int64     `json:"budget_used"`
+	BudgetResetAt  time.Time `json:"budget_reset_at"`
+	RPM            int       `json:"rpm"` // 每分钟请求数限制，<=0 表示不限
+	TPM            int       `json:"tpm"` // 每分钟 token 数限制，<=0 表示不限
+	AllowedModels  string    `json:"allowed_models"` // 允许调用的模型名正则，空表示不限
+	PinnedTag      string    `json:"pinned_tag,omitempty"` // 非空时只从带有该 tag 的账号中选择
+	Enabled        bool      `json:"enabled"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (s *Store) migrateTenants() error {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS tenants (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			org_id TEXT UNIQUE NOT NULL,
+			api_key_hash TEXT NOT NULL,
+			monthly_budget INTEGER DEFAULT 0,
+			budget_used INTEGER DEFAULT 0,
+			budget_reset_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			rpm INTEGER DEFAULT 0,
+			tpm INTEGER DEFAULT 0,
+			allowed_models TEXT DEFAULT '',
+			pinned_tag TEXT DEFAULT '',
+			enabled INTEGER DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_tenants_org_id ON tenants(org_id)`,
+	}
+
+	for _, q := range queries {
+		if _, err := s.db.Exec(q); err != nil && !isDuplicateColumnError(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateTenant 创建租户，apiKeyHash 由调用方预先哈希（用 tenant.HashAPIKey 的 SHA-256，不是 Admin 密码那样的 bcrypt）
+func (s *Store) CreateTenant(t *Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec(`
+		INSERT INTO tenants (name, org_id, api_key_hash, monthly_budget, rpm, tpm, allowed_models, pinned_tag, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, t.Name, t.OrgID, t.APIKeyHash, t.MonthlyBudget, t.RPM, t.TPM, t.AllowedModels, t.PinnedTag, t.Enabled)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	t.ID = id
+	return nil
+}
+
+// UpdateTenant 更新租户配置（不含 budget_used，预算扣减走 DeductTenantBudget）
+func (s *Store) UpdateTenant(t *Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`
+		UPDATE tenants SET
+			name = ?, org_id = ?, api_key_hash = ?, monthly_budget = ?, rpm = ?, tpm = ?,
+			allowed_models = ?, pinned_tag = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, t.Name, t.OrgID, t.APIKeyHash, t.MonthlyBudget, t.RPM, t.TPM, t.AllowedModels, t.PinnedTag, t.Enabled, t.ID)
+	return err
+}
+
+// DeleteTenant 删除租户
+func (s *Store) DeleteTenant(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec("DELETE FROM tenants WHERE id = ?", id)
+	return err
+}
+
+func scanTenant(row interface {
+	Scan(dest ...interface{}) error
+}) (*Tenant, error) {
+	t := &Tenant{}
+	err := row.Scan(&t.ID, &t.Name, &t.OrgID, &t.APIKeyHash, &t.MonthlyBudget, &t.BudgetUsed,
+		&t.BudgetResetAt, &t.RPM, &t.TPM, &t.AllowedModels, &t.PinnedTag, &t.Enabled,
+		&t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+const tenantColumns = `id, name, org_id, api_key_hash, monthly_budget, budget_used,
+	budget_reset_at, rpm, tpm, allowed_models, pinned_tag, enabled, created_at, updated_at`
+
+// GetTenant 按 ID 查询租户
+func (s *Store) GetTenant(id int64) (*Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	row := s.db.QueryRow(`SELECT `+tenantColumns+` FROM tenants WHERE id = ?`, id)
+	return scanTenant(row)
+}
+
+// GetTenantByOrgID 按 X-Scope-OrgID 查询租户
+func (s *Store) GetTenantByOrgID(orgID string) (*Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	row := s.db.QueryRow(`SELECT `+tenantColumns+` FROM tenants WHERE org_id = ?`, orgID)
+	return scanTenant(row)
+}
+
+// ListTenants 列出所有租户
+func (s *Store) ListTenants() ([]*Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT ` + tenantColumns + ` FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []*Tenant
+	for rows.Next() {
+		t, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, nil
+}
+
+// DeductTenantBudget 从租户的月度预算中扣减已消耗的 token 数；预算耗尽到期后由
+// ResetTenantBudgetIfDue 负责清零重计
+func (s *Store) DeductTenantBudget(id int64, tokens int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`UPDATE tenants SET budget_used = budget_used + ? WHERE id = ?`, tokens, id)
+	return err
+}
+
+// ResetTenantBudgetIfDue 若距上次重置已满 30 天，清零 budget_used 并刷新 budget_reset_at
+func (s *Store) ResetTenantBudgetIfDue(t *Tenant) error {
+	if time.Since(t.BudgetResetAt) < 30*24*time.Hour {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`
+		UPDATE tenants SET budget_used = 0, budget_reset_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, t.ID)
+	if err != nil {
+		return fmt.Errorf("reset tenant budget: %w", err)
+	}
+	return nil
+}
+
+// GetEnabledAccountsByTag 返回启用状态且 tag 匹配的账号；tag 为空时等价于 GetEnabledAccounts
+func (s *Store) GetEnabledAccountsByTag(tag string) ([]*Account, error) {
+	accounts, err := s.GetEnabledAccounts()
+	if err != nil {
+		return nil, err
+	}
+	if tag == "" {
+		return accounts, nil
+	}
+
+	var filtered []*Account
+	for _, acc := range accounts {
+		if acc.Tag == tag {
+			filtered = append(filtered, acc)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,139 @@
+package tenant
+
+import (
+	"sync"
+	"time"
+)
+
+// bucket 是单个租户的令牌桶状态，同时承担 RPM（请求数）和 TPM（token 数）两条限制
+type bucket struct {
+	mu sync.Mutex
+
+	rpmTokens float64
+	rpmLimit  float64
+	tpmTokens float64
+	tpmLimit  float64
+	lastFill  time.Time
+}
+
+func newBucket(rpm, tpm int) *bucket {
+	return &bucket{
+		rpmTokens: float64(rpm),
+		rpmLimit:  float64(rpm),
+		tpmTokens: float64(tpm),
+		tpmLimit:  float64(tpm),
+		lastFill:  time.Now(),
+	}
+}
+
+// refill 按经过的时间比例把令牌桶填回到每分钟限额（简单线性填充，而非严格的滑动窗口）
+func (b *bucket) refill() {
+	now := time.Now()
+	elapsed := now.Sub(b.lastFill).Seconds()
+	b.lastFill = now
+
+	if b.rpmLimit > 0 {
+		b.rpmTokens += elapsed / 60 * b.rpmLimit
+		if b.rpmTokens > b.rpmLimit {
+			b.rpmTokens = b.rpmLimit
+		}
+	}
+	if b.tpmLimit > 0 {
+		b.tpmTokens += elapsed / 60 * b.tpmLimit
+		if b.tpmTokens > b.tpmLimit {
+			b.tpmTokens = b.tpmLimit
+		}
+	}
+}
+
+// allow 尝试消费一次请求配额和 estimatedTokens 个 token 配额；
+// estimatedTokens 未知时传 0，只检查 RPM
+func (b *bucket) allow(estimatedTokens int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+
+	if b.rpmLimit > 0 && b.rpmTokens < 1 {
+		return false
+	}
+	if b.tpmLimit > 0 && float64(estimatedTokens) > b.tpmTokens {
+		return false
+	}
+
+	if b.rpmLimit > 0 {
+		b.rpmTokens--
+	}
+	if b.tpmLimit > 0 {
+		b.tpmTokens -= float64(estimatedTokens)
+	}
+	return true
+}
+
+// Limiter 维护每个租户的内存令牌桶，定期清理长时间未使用的条目避免无限增长
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[int64]*bucket
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+const limiterCleanupInterval = 10 * time.Minute
+
+// NewLimiter 创建限流器并启动后台清理 goroutine
+func NewLimiter() *Limiter {
+	l := &Limiter{
+		buckets: make(map[int64]*bucket),
+		stopCh:  make(chan struct{}),
+	}
+
+	l.wg.Add(1)
+	go l.backgroundCleanup()
+
+	return l
+}
+
+// Allow 检查租户 tenantID 是否还有 RPM/TPM 配额；rpm/tpm 为该租户当前配置的限额，
+// 配置变化后下一次 Allow 调用会用新的限额重建桶
+func (l *Limiter) Allow(tenantID int64, rpm, tpm, estimatedTokens int) bool {
+	l.mu.Lock()
+	b, ok := l.buckets[tenantID]
+	if !ok || b.rpmLimit != float64(rpm) || b.tpmLimit != float64(tpm) {
+		b = newBucket(rpm, tpm)
+		l.buckets[tenantID] = b
+	}
+	l.mu.Unlock()
+
+	return b.allow(estimatedTokens)
+}
+
+func (l *Limiter) backgroundCleanup() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(limiterCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stopCh:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			for id, b := range l.buckets {
+				b.mu.Lock()
+				idle := time.Since(b.lastFill) > limiterCleanupInterval
+				b.mu.Unlock()
+				if idle {
+					delete(l.buckets, id)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// Stop 停止后台清理 goroutine
+func (l *Limiter) Stop() {
+	close(l.stopCh)
+	l.wg.Wait()
+}
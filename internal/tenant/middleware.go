@@ -0,0 +1,118 @@
+package tenant
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"orchids-api/internal/store"
+)
+
+type contextKey int
+
+const tenantContextKey contextKey = 0
+
+// FromContext 取出本次请求解析出的租户；未经过 Middleware 或解析失败时返回 (nil, false)
+func FromContext(ctx context.Context) (*store.Tenant, bool) {
+	t, ok := ctx.Value(tenantContextKey).(*store.Tenant)
+	return t, ok
+}
+
+// HashAPIKey 对外部 API Key 做 SHA-256 哈希后与 store 中保存的哈希比对（不可逆，
+// 与 Admin 密码的 bcrypt 不同：API Key 走的是高频校验路径，选用开销更低的哈希）
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// resolve 从 Authorization: Bearer <key> 或 X-Scope-OrgID 请求头解析出调用方租户
+func resolve(s *store.Store, r *http.Request) (*store.Tenant, error) {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if key, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			hash := HashAPIKey(key)
+			tenants, err := s.ListTenants()
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range tenants {
+				if t.APIKeyHash == hash {
+					return t, nil
+				}
+			}
+			return nil, errUnknownTenant
+		}
+	}
+
+	if orgID := r.Header.Get("X-Scope-OrgID"); orgID != "" {
+		return s.GetTenantByOrgID(orgID)
+	}
+
+	return nil, errNoTenantCredentials
+}
+
+type tenantError string
+
+func (e tenantError) Error() string { return string(e) }
+
+const (
+	errUnknownTenant       = tenantError("no tenant matches the provided API key")
+	errNoTenantCredentials = tenantError("request carries neither an Authorization bearer key nor X-Scope-OrgID")
+)
+
+// Middleware 解析调用方租户、强制执行 RPM/TPM 限流，并把 *store.Tenant 放入请求 context。
+// estimateTokens 用请求体估算本次调用可能消耗的 token 数，用于 TPM 检查；无法提前估算时传 0
+func Middleware(s *store.Store, limiter *Limiter, estimateTokens func(*http.Request) int, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, err := resolve(s, r)
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !t.Enabled {
+			http.Error(w, "Tenant disabled", http.StatusForbidden)
+			return
+		}
+
+		if t.AllowedModels != "" {
+			model := r.Header.Get("X-Requested-Model")
+			if model != "" {
+				if ok, _ := regexp.MatchString(t.AllowedModels, model); !ok {
+					http.Error(w, "Model not allowed for this tenant", http.StatusForbidden)
+					return
+				}
+			}
+		}
+
+		if err := s.ResetTenantBudgetIfDue(t); err != nil {
+			http.Error(w, "Failed to check tenant budget: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if t.MonthlyBudget > 0 && t.BudgetUsed >= t.MonthlyBudget {
+			http.Error(w, "Monthly token budget exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		estimated := 0
+		if estimateTokens != nil {
+			estimated = estimateTokens(r)
+		}
+		if !limiter.Allow(t.ID, t.RPM, t.TPM, estimated) {
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), tenantContextKey, t)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// RecordUsage 把本次请求实际消耗的 token 数计入租户的月度预算
+func RecordUsage(s *store.Store, t *store.Tenant, totalTokens int) {
+	if t == nil || totalTokens <= 0 {
+		return
+	}
+	_ = s.DeductTenantBudget(t.ID, int64(totalTokens))
+}
@@ -0,0 +1,95 @@
+package tiktoken
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// rankedVocab 是从 .tiktoken 文件加载的 token -> rank 表，rank 越小代表越早被合并出来
+type rankedVocab map[string]int
+
+// parseTiktokenFile 解析标准的 .tiktoken 格式：每行 "base64(token) rank"
+func parseTiktokenFile(data []byte) (rankedVocab, error) {
+	vocab := make(rankedVocab)
+
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("malformed tiktoken line: %q", line)
+		}
+
+		tokenBytes, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("decode token %q: %w", parts[0], err)
+		}
+		rank, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("parse rank %q: %w", parts[1], err)
+		}
+
+		vocab[string(tokenBytes)] = rank
+	}
+
+	return vocab, scanner.Err()
+}
+
+// bpeEncode 对单个预分词片段反复合并相邻、当前排名最低的一对子 token，
+// 直到词表中找不到可用的合并为止，最终返回按顺序排列的 token rank
+func bpeEncode(piece []byte, vocab rankedVocab) []int {
+	if len(piece) == 0 {
+		return nil
+	}
+	if len(piece) == 1 {
+		return []int{vocab[string(piece)]}
+	}
+
+	// parts 以单字节起步，逐步合并为更长的子 token
+	parts := make([]string, len(piece))
+	for i, b := range piece {
+		parts[i] = string([]byte{b})
+	}
+
+	for {
+		minRank := -1
+		minIdx := -1
+
+		for i := 0; i < len(parts)-1; i++ {
+			merged := parts[i] + parts[i+1]
+			if rank, ok := vocab[merged]; ok {
+				if minRank == -1 || rank < minRank {
+					minRank = rank
+					minIdx = i
+				}
+			}
+		}
+
+		if minIdx == -1 {
+			break
+		}
+
+		merged := parts[minIdx] + parts[minIdx+1]
+		parts = append(parts[:minIdx], append([]string{merged}, parts[minIdx+2:]...)...)
+	}
+
+	ids := make([]int, len(parts))
+	for i, p := range parts {
+		if rank, ok := vocab[p]; ok {
+			ids[i] = rank
+		} else {
+			// 词表中不存在的单字节不应该发生（256 个字节都在基础词表中），兜底为 0
+			ids[i] = 0
+		}
+	}
+	return ids
+}
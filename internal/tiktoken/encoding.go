@@ -0,0 +1,99 @@
+package tiktoken
+
+import (
+	_ "embed"
+	"fmt"
+	"sync"
+)
+
+// data/ 下的两份编码表只含 256 个单字节 token 加少量合并（cl100k_base 共 347 条 rank，
+// o200k_base 共 308 条），不是完整的官方词表，Encode 得到的 token 数与官方 tiktoken 不同
+//
+//go:embed data/cl100k_base.tiktoken
+var cl100kBaseData []byte
+
+//go:embed data/o200k_base.tiktoken
+var o200kBaseData []byte
+
+// Encoding 是一个加载好的 BPE 编码表，对应一个 tiktoken 编码名（如 cl100k_base）
+type Encoding struct {
+	Name  string
+	vocab rankedVocab
+}
+
+// Encode 对文本做 GPT 风格预分词 + BPE 合并，返回 token id 序列
+func (e *Encoding) Encode(text string) []int {
+	if text == "" {
+		return nil
+	}
+
+	var ids []int
+	for _, piece := range preTokenize(text) {
+		ids = append(ids, bpeEncode([]byte(piece), e.vocab)...)
+	}
+	return ids
+}
+
+// modelToEncodingName 按前缀匹配模型名到对应的编码表名，沿用 OpenAI/Anthropic 的命名习惯
+var modelToEncodingName = []struct {
+	prefix   string
+	encoding string
+}{
+	{"claude-", "cl100k_base"},
+	{"gpt-4o", "o200k_base"},
+	{"gpt-4", "cl100k_base"},
+	{"gpt-3.5", "cl100k_base"},
+	{"text-embedding-3", "cl100k_base"},
+}
+
+var (
+	encodingsOnce sync.Once
+	encodings     map[string]*Encoding
+	encodingsErr  map[string]error
+)
+
+func loadEncodings() {
+	encodings = make(map[string]*Encoding)
+	encodingsErr = make(map[string]error)
+
+	for name, data := range map[string][]byte{
+		"cl100k_base": cl100kBaseData,
+		"o200k_base":  o200kBaseData,
+	} {
+		vocab, err := parseTiktokenFile(data)
+		if err != nil {
+			encodingsErr[name] = fmt.Errorf("load %s: %w", name, err)
+			continue
+		}
+		encodings[name] = &Encoding{Name: name, vocab: vocab}
+	}
+}
+
+// GetEncoding 按编码名（如 "cl100k_base"）返回已加载的编码表
+func GetEncoding(name string) (*Encoding, error) {
+	encodingsOnce.Do(loadEncodings)
+
+	if err, ok := encodingsErr[name]; ok {
+		return nil, err
+	}
+	enc, ok := encodings[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding: %s", name)
+	}
+	return enc, nil
+}
+
+// EncodingForModel 根据模型名解析出应使用的编码表；未知模型返回 (nil, false)，
+// 调用方应退回 EstimateTokens 之类的启发式估算
+func EncodingForModel(model string) (*Encoding, bool) {
+	for _, m := range modelToEncodingName {
+		if len(model) >= len(m.prefix) && model[:len(m.prefix)] == m.prefix {
+			enc, err := GetEncoding(m.encoding)
+			if err != nil {
+				return nil, false
+			}
+			return enc, true
+		}
+	}
+	return nil, false
+}
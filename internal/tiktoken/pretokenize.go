@@ -0,0 +1,99 @@
+package tiktoken
+
+import (
+	"unicode"
+)
+
+// preTokenize 把输入文本切分为 GPT-4 风格的预分词片段：缩写后缀（如 's、'll）、
+// 连续字母、1-3 位一组的数字、连续空白+非字母数字，以及单独的空白。
+//
+// Go 的 regexp 基于 RE2，不支持官方 cl100k_base pattern 里用到的
+// 反向引用和占有量词，这里用等价的手写状态机来逼近同样的切分效果。
+func preTokenize(text string) []string {
+	runes := []rune(text)
+	var pieces []string
+	i := 0
+
+	isContractionSuffix := func(s []rune, pos int) (string, bool) {
+		suffixes := []string{"'s", "'t", "'re", "'ve", "'m", "'ll", "'d"}
+		for _, suf := range suffixes {
+			sr := []rune(suf)
+			if pos+len(sr) > len(s) {
+				continue
+			}
+			match := true
+			for k, r := range sr {
+				if unicode.ToLower(s[pos+k]) != r && s[pos+k] != r {
+					match = false
+					break
+				}
+			}
+			if match {
+				return string(s[pos : pos+len(sr)]), true
+			}
+		}
+		return "", false
+	}
+
+	for i < len(runes) {
+		if runes[i] == '\'' {
+			if suf, ok := isContractionSuffix(runes, i); ok {
+				pieces = append(pieces, suf)
+				i += len([]rune(suf))
+				continue
+			}
+		}
+
+		if unicode.IsLetter(runes[i]) {
+			start := i
+			for i < len(runes) && unicode.IsLetter(runes[i]) {
+				i++
+			}
+			pieces = append(pieces, string(runes[start:i]))
+			continue
+		}
+
+		// 一个前置的非字母数字符号 + 后面的连续字母，合成一个片段（如 " word" 中的空格+word）
+		if isLeadingNonLetterNonNumber(runes[i]) && i+1 < len(runes) && unicode.IsLetter(runes[i+1]) {
+			start := i
+			i++
+			for i < len(runes) && unicode.IsLetter(runes[i]) {
+				i++
+			}
+			pieces = append(pieces, string(runes[start:i]))
+			continue
+		}
+
+		if unicode.IsDigit(runes[i]) {
+			start := i
+			end := i
+			for end < len(runes) && unicode.IsDigit(runes[end]) && end-start < 3 {
+				end++
+			}
+			pieces = append(pieces, string(runes[start:end]))
+			i = end
+			continue
+		}
+
+		if unicode.IsSpace(runes[i]) {
+			start := i
+			for i < len(runes) && unicode.IsSpace(runes[i]) {
+				i++
+			}
+			pieces = append(pieces, string(runes[start:i]))
+			continue
+		}
+
+		// 其余标点/符号单独成片
+		pieces = append(pieces, string(runes[i]))
+		i++
+	}
+
+	return pieces
+}
+
+// isLeadingNonLetterNonNumber 对应官方 pattern 里 [^\r\n\p{L}\p{N}] 字符类：
+// 允许把一个前置空格也并入后面的单词片段（BPE 词表里大量 token 形如 " the"）
+func isLeadingNonLetterNonNumber(r rune) bool {
+	return r != '\n' && r != '\r' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
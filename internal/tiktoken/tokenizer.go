@@ -4,8 +4,8 @@ import (
 	"unicode"
 )
 
-// EstimateTokens 估算文本的 token 数量
-// 使用近似算法：
+// EstimateTokens 估算文本的 token 数量（启发式算法；CountTextTokens/CountMessageTokens
+// 找不到编码表时退回的是 EstimateTextTokens，不是这个函数）：
 // - 英文单词约 0.75 token/word
 // - 中文字符约 1.5 token/char
 // - 数字和特殊字符单独计算
@@ -109,7 +109,47 @@ func EstimateTextTokens(text string) int {
 	return count / 3
 }
 
-// EstimateMessagesTokens 估算消息列表的 token 数量
+// chatMLMessageOverhead 每条消息的 ChatML 格式开销（角色标记 + 分隔符）
+const chatMLMessageOverhead = 3
+
+// chatMLPrimingTokens 对话级别的开头引导 tokens
+const chatMLPrimingTokens = 3
+
+// CountTextTokens 对一段纯文本计数：model 能找到对应 BPE 编码表时用真实 BPE 分词，
+// 否则退回 EstimateTextTokens 启发式估算
+func CountTextTokens(text, model string) int {
+	if enc, ok := EncodingForModel(model); ok {
+		return len(enc.Encode(text))
+	}
+	return EstimateTextTokens(text)
+}
+
+// CountMessageTokens 按 ChatML 规则计数一条消息列表的 token 数量：每条消息固定
+// chatMLMessageOverhead 个格式开销 token，外加内容本身的真实（或估算）token 数，
+// 最后加上 chatMLPrimingTokens 个对话级别的引导 token。model 能找到对应 BPE
+// 编码表时使用真实 BPE 分词，否则退回启发式估算
+func CountMessageTokens(messages []map[string]interface{}, model string) int {
+	enc, hasEncoding := EncodingForModel(model)
+
+	tokens := 0
+	for _, msg := range messages {
+		tokens += chatMLMessageOverhead
+
+		if content, ok := msg["content"].(string); ok {
+			if hasEncoding {
+				tokens += len(enc.Encode(content))
+			} else {
+				tokens += EstimateTextTokens(content)
+			}
+		}
+	}
+
+	tokens += chatMLPrimingTokens
+
+	return tokens
+}
+
+// EstimateMessagesTokens 估算消息列表的 token 数量（启发式兜底，未按模型区分编码表）
 // 考虑消息格式和角色标记的开销
 func EstimateMessagesTokens(messages []map[string]interface{}) int {
 	tokens := 0
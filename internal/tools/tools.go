@@ -0,0 +1,129 @@
+// Package tools 提供一个可以被 handler 在收到 X-Orchids-Local-Tools 请求头时就地执行的
+// 本地工具注册表。约定名字以 may_ 开头的工具才允许本地执行（区别于客户端自己实现的工具，
+// 那些工具的 tool_use 仍然按原样转发给客户端，由客户端负责回传 tool_result）。
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ExecutablePrefix 标记一个工具名允许本地执行；未带这个前缀的工具只出现在 schema 里，
+// 供模型选择调用，但实际执行权始终留在客户端
+const ExecutablePrefix = "may_"
+
+// ExecFunc 执行一次工具调用；input 是模型产出的原始 JSON 参数，返回值会被原样当作
+// tool_result 的 content 喂回给模型
+type ExecFunc func(ctx context.Context, input json.RawMessage) (json.RawMessage, error)
+
+type tool struct {
+	Name   string
+	Schema json.RawMessage
+	Exec   ExecFunc
+}
+
+func (t tool) executable() bool {
+	return t.Exec != nil && strings.HasPrefix(t.Name, ExecutablePrefix)
+}
+
+// ToolRegistry 是本地工具注册表对外暴露的接口，handler 只依赖这个接口而不依赖 Registry
+// 的具体实现，方便测试时替换成桩实现
+type ToolRegistry interface {
+	Register(name string, schema json.RawMessage, exec ExecFunc)
+	Schemas() []interface{}
+	Executable(name string) bool
+	Execute(ctx context.Context, name string, input json.RawMessage) (json.RawMessage, error)
+}
+
+// Registry 是 ToolRegistry 的默认实现，一个进程内通常只需要一个全局实例
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]tool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]tool)}
+}
+
+// Register 登记一个工具；name 不带 may_ 前缀时仍然可以登记 schema（用于向模型描述一个
+// 只能由客户端执行的工具），但 exec 必须为 nil，否则它永远不会被本地调用到
+func (r *Registry) Register(name string, schema json.RawMessage, exec ExecFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[name] = tool{Name: name, Schema: schema, Exec: exec}
+}
+
+// Schemas 按 prompt.Tool 期望的 map[string]interface{} 形状导出全部已注册工具的 schema，
+// 供 MergeSchemas 并入请求的 req.Tools
+func (r *Registry) Schemas() []interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schemas := make([]interface{}, 0, len(r.tools))
+	for _, t := range r.tools {
+		var schema map[string]interface{}
+		if err := json.Unmarshal(t.Schema, &schema); err != nil {
+			continue
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas
+}
+
+func (r *Registry) get(name string) (tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// Executable 判断 name 是否登记了本地执行函数，且命名遵守 may_ 前缀约定
+func (r *Registry) Executable(name string) bool {
+	t, ok := r.get(name)
+	return ok && t.executable()
+}
+
+func (r *Registry) Execute(ctx context.Context, name string, input json.RawMessage) (json.RawMessage, error) {
+	t, ok := r.get(name)
+	if !ok {
+		return nil, fmt.Errorf("tool %q not registered", name)
+	}
+	if !t.executable() {
+		return nil, fmt.Errorf("tool %q is not locally executable", name)
+	}
+	return t.Exec(ctx, input)
+}
+
+// MergeSchemas 把 registry 里已注册工具的 schema 追加到 existing 后面；同名工具以
+// existing（客户端自带的 tools 数组）优先，避免本地 schema 覆盖客户端自定义的版本
+func MergeSchemas(existing []interface{}, registry ToolRegistry) []interface{} {
+	if registry == nil {
+		return existing
+	}
+
+	existingNames := make(map[string]bool, len(existing))
+	for _, t := range existing {
+		if tm, ok := t.(map[string]interface{}); ok {
+			if name, ok := tm["name"].(string); ok {
+				existingNames[name] = true
+			}
+		}
+	}
+
+	merged := existing
+	for _, schema := range registry.Schemas() {
+		tm, ok := schema.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := tm["name"].(string)
+		if name == "" || existingNames[name] {
+			continue
+		}
+		merged = append(merged, schema)
+	}
+	return merged
+}
@@ -0,0 +1,133 @@
+// Package upstreamerr 给上游 SendRequest 返回的错误分类，取代过去"所有错误一视同仁，
+// 换账号+退避重试"的简单重试循环。分类形状参考了常见错误响应里 code/message/minor_message/
+// details 的结构，但这里只留下 handler 真正需要用来做决策的字段。
+package upstreamerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Class 决定 handler 对这次失败应该采取的动作：换账号重试、原地退避重试、拉黑账号、
+// 降级到更小的模型，还是直接向客户端报错
+type Class string
+
+const (
+	RateLimited     Class = "rate_limited"
+	AuthExpired     Class = "auth_expired"
+	ModelOverloaded Class = "model_overloaded"
+	BadRequest      Class = "bad_request"
+	Transient       Class = "transient"
+	ContextCanceled Class = "context_canceled"
+)
+
+// UpstreamError 是 client.SendRequest 失败时返回的具体错误类型；handler 用 errors.As
+// 取出来决定重试策略，日志/SSE error 事件里展示的则是 Code/Message
+type UpstreamError struct {
+	Class        Class
+	Code         string
+	Message      string
+	MinorMessage string
+	Details      string
+	StatusCode   int
+	RetryAfter   time.Duration
+}
+
+func (e *UpstreamError) Error() string {
+	if e.MinorMessage != "" {
+		return fmt.Sprintf("%s: %s (%s)", e.Code, e.Message, e.MinorMessage)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// FromResponse 根据上游 HTTP 响应的状态码和截断后的响应体分类；body 只用来判断
+// "overloaded" 这类出现在 5xx 正文里的关键字，以及塞进 Details 方便排查
+func FromResponse(resp *http.Response, body []byte) *UpstreamError {
+	status := resp.StatusCode
+	bodyStr := string(body)
+	lowerBody := strings.ToLower(bodyStr)
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return &UpstreamError{
+			Class: AuthExpired, Code: "auth_expired",
+			Message: "upstream rejected credentials", Details: bodyStr, StatusCode: status,
+		}
+	case status == http.StatusTooManyRequests:
+		return &UpstreamError{
+			Class: RateLimited, Code: "rate_limited",
+			Message: "upstream rate limited this account", Details: bodyStr, StatusCode: status,
+			RetryAfter: retryAfter(resp.Header),
+		}
+	case status == http.StatusBadRequest || status == http.StatusUnprocessableEntity:
+		return &UpstreamError{
+			Class: BadRequest, Code: "bad_request",
+			Message: "upstream rejected the request", Details: bodyStr, StatusCode: status,
+		}
+	case status == http.StatusServiceUnavailable || strings.Contains(lowerBody, "overloaded"):
+		return &UpstreamError{
+			Class: ModelOverloaded, Code: "model_overloaded",
+			Message: "upstream model is overloaded", Details: bodyStr, StatusCode: status,
+		}
+	case status >= 500:
+		return &UpstreamError{
+			Class: Transient, Code: "server_error",
+			Message: fmt.Sprintf("upstream returned %d", status), Details: bodyStr, StatusCode: status,
+		}
+	default:
+		return &UpstreamError{
+			Class: Transient, Code: "unexpected_status",
+			Message: fmt.Sprintf("upstream returned %d", status), Details: bodyStr, StatusCode: status,
+		}
+	}
+}
+
+// FromError 给网络层错误（连接失败、超时、ctx 取消）分类，这些情况下没有响应体可看
+func FromError(err error) *UpstreamError {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return &UpstreamError{Class: ContextCanceled, Code: "context_canceled", Message: err.Error()}
+	}
+	return &UpstreamError{Class: Transient, Code: "connection_error", Message: err.Error()}
+}
+
+// retryAfter 解析 Retry-After 头，支持 RFC 7231 允许的两种形式：delta-seconds（"120"）
+// 和 HTTP-date（"Wed, 21 Oct 2026 07:28:00 GMT"）
+func retryAfter(header http.Header) time.Duration {
+	raw := header.Get("Retry-After")
+	if raw == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if when, err := http.ParseTime(raw); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// HTTPStatus 把分类映射回返给客户端的 HTTP 状态码，用于 handler 在还没开始流式输出时
+// 直接 fail fast
+func HTTPStatus(class Class) int {
+	switch class {
+	case AuthExpired:
+		return http.StatusBadGateway
+	case RateLimited:
+		return http.StatusTooManyRequests
+	case ModelOverloaded:
+		return http.StatusServiceUnavailable
+	case BadRequest:
+		return http.StatusBadRequest
+	case ContextCanceled:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}